@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log/slog"
+	"npoleon/internal/archive"
+	"npoleon/internal/clock"
+	"npoleon/internal/http"
+	"npoleon/internal/lastfm"
+	"npoleon/internal/locking"
+	"npoleon/internal/nporadio"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Keep a local archive of the playlists of NPO radio stations",
+	Long: `Mirror the playlists of one or more stations into a local archive. Npoleon
+first archives today's plays, and then walks back through each station's
+history, one day at a time, for as long as NPO serves older playlists. In the
+meantime it keeps archiving new plays, until you terminate the command.
+
+  npoleon archive --stations all
+  npoleon archive --stations radio2,3fm
+
+Progress is saved, so the archive picks up where it left off when you run the
+command again. All stations share a single limit on the number of requests
+sent to NPO, which can be changed with --rate-limit.
+
+The archive is kept in ~/.npoleon/archive unless you choose another --dir.
+Each station has its own directory, with a file per day that contains a JSON
+object for each play (JSON Lines), so that the archive can be searched and
+exported with other tools.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		stationNames, _ := cmd.Flags().GetString("stations")
+		dir, _ := cmd.Flags().GetString("dir")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		rateLimit, _ := cmd.Flags().GetDuration("rate-limit")
+
+		stations, err := selectStations(stationNames)
+		exitOnError(err)
+		if interval < time.Minute {
+			exitOnError(errors.New("--interval must be at least 1m"))
+		}
+		if dir == "" {
+			dir = lastfm.GetApplicationPath("archive")
+		}
+
+		store, err := archive.OpenStore(dir)
+		exitOnError(err)
+
+		// The store can only be written by one process at a time
+		instance, err := locking.AcquireInstance(filepath.Join(dir, "npoleon.pid"))
+		exitOnError(err)
+		defer instance.Unlock()
+
+		httpClient := http.CreateRateLimitedClient(&http.Client{}, clock.Real{}, rateLimit)
+		var clients []nporadio.Client
+		for _, station := range stations {
+			client, err := nporadio.CreateClient(httpClient, station)
+			exitOnError(err)
+			clients = append(clients, client)
+		}
+
+		slog.Info(fmt.Sprintf("Archiving %d station(s) in %s", len(clients), dir), "stations", stations)
+		crawler := archive.CreateCrawler(store, clients)
+		crawler.SetInterval(interval)
+		exitOnError(crawler.Run())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(archiveCmd)
+
+	archiveCmd.Flags().String(
+		"stations",
+		"all",
+		`Comma-separated stations to archive, or "all"`,
+	)
+	archiveCmd.Flags().String(
+		"dir",
+		"",
+		"Directory in which the archive is kept (default ~/.npoleon/archive)",
+	)
+	archiveCmd.Flags().Duration(
+		"interval",
+		archive.DefaultInterval,
+		"How often to check for new plays",
+	)
+	archiveCmd.Flags().Duration(
+		"rate-limit",
+		time.Second,
+		"Minimum time between two requests to NPO, for all stations together",
+	)
+}
+
+// selectStations accepts "all" or a comma-separated list of station names
+func selectStations(names string) ([]nporadio.StationId, error) {
+	if strings.TrimSpace(names) == "all" {
+		return nporadio.Stations(), nil
+	}
+
+	var stations []nporadio.StationId
+	seen := map[nporadio.StationId]bool{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		station, err := nporadio.GetStationId(name)
+		if err != nil {
+			return nil, fmt.Errorf(`"%v" is not a valid station name`, name)
+		}
+		if !seen[station] {
+			stations = append(stations, station)
+			seen[station] = true
+		}
+	}
+	if len(stations) == 0 {
+		return nil, errors.New(`you must specify at least one station, or "all"`)
+	}
+	return stations, nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"npoleon/internal/config"
+	"os"
+	"strings"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show, change or check settings in the config file",
+	Long: `Settings are stored in profiles in the config file, which is located at
+$XDG_CONFIG_HOME/npoleon/config.json (usually ~/.config/npoleon/config.json)
+unless NPOLEON_CONFIG points somewhere else. Use --profile or NPOLEON_PROFILE to
+select a profile other than the default one.
+
+Available settings:
+
+  account.apiKey     Your Last.fm API key
+  stations           Comma-separated stations, the first is scrobbled by default
+  filters            Filters as JSON, see the README for the format
+  schedule.from      Default value for --from
+  schedule.until     Default value for --until
+  polling.interval   Default value for --poll-interval
+  polling.adaptive   Default value for --adaptive
+  timezone           Default value for --tz
+
+Each setting can be overridden with an environment variable, e.g.
+NPOLEON_POLLING_INTERVAL for polling.interval.`,
+	// Checking the config must also work when it is invalid
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupLogging()
+	},
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Show where the config file is located",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := config.GetPath()
+		exitOnError(err)
+		fmt.Println(path)
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get [KEY]",
+	Short: "Show the value of a setting, or of all settings",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(loadProfile())
+
+		keys := config.Keys()
+		if len(args) == 1 {
+			keys = args
+		}
+
+		for _, key := range keys {
+			value, err := profile.Get(key)
+			exitOnError(err)
+
+			if len(args) == 1 {
+				fmt.Println(value)
+			} else {
+				fmt.Printf("%s=%s\n", key, value)
+			}
+		}
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Change a setting in the selected profile",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := config.GetPath()
+		exitOnError(err)
+
+		cfg, err := config.Load(path)
+		if err != nil {
+			exitOnError(fmt.Errorf("%w\nfix the config file before changing it", err))
+		}
+
+		name := profileName
+		if name == "" {
+			name = os.Getenv("NPOLEON_PROFILE")
+		}
+		if name == "" {
+			name, _, err = cfg.SelectProfile("")
+			exitOnError(err)
+		}
+
+		err = cfg.Set(name, args[0], args[1])
+		exitOnError(err)
+		exitOnError(config.Save(path, cfg))
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file for mistakes",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := config.GetPath()
+		exitOnError(err)
+
+		contents, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("There is no config file at %s, default settings are used.\n", path)
+			return
+		}
+		exitOnError(err)
+
+		problems := config.Validate(path, contents)
+		if len(problems) == 0 {
+			fmt.Printf("%s is valid.\n", path)
+			return
+		}
+
+		var lines []string
+		for _, problem := range problems {
+			lines = append(lines, problem.Error())
+		}
+		fmt.Println(strings.Join(lines, "\n"))
+		os.Exit(1)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configPathCmd, configGetCmd, configSetCmd, configValidateCmd)
+}
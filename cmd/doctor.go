@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"npoleon/internal/config"
+	"npoleon/internal/credentials"
+	"npoleon/internal/doctor"
+	"npoleon/internal/http"
+	"npoleon/internal/lastfm"
+	"npoleon/internal/nporadio"
+	"os"
+	"time"
+)
+
+const websiteChangedHint = "NPO has probably changed its website. Check whether there is a newer version of Npoleon."
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [STATION]",
+	Short: "Check whether everything Npoleon needs is working",
+	Long: `Check the config file, your Last.fm credentials and session, the website of an
+NPO station and the local clock. Each check is reported as it runs, with a hint
+on how to fix it when it fails. The station defaults to the first station in
+the profile, or NPO Radio 2.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MaximumNArgs(1)(cmd, args); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			if _, err := nporadio.GetStationId(args[0]); err != nil {
+				return fmt.Errorf(`"%v" is not a valid station name`, args[0])
+			}
+		}
+		return nil
+	},
+	// The doctor must also run when the config can't be loaded
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupLogging(); err != nil {
+			return err
+		}
+		profileErr = loadProfile()
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		station, err := selectStation(args)
+		if err != nil {
+			station = string(nporadio.NpoRadio2)
+		}
+		stationId, err := nporadio.GetStationId(station)
+		exitOnError(err)
+
+		if _, healthy := doctor.Run(createDoctorChecks(stationId), os.Stdout); !healthy {
+			os.Exit(1)
+		}
+	},
+}
+
+// profileErr is the reason the profile could not be loaded, if any
+var profileErr error
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// createDoctorChecks returns the checks in the order in which they run. Later
+// checks use what earlier ones found, e.g. the main page of the station.
+func createDoctorChecks(stationId nporadio.StationId) []doctor.Check {
+	var store credentials.Store
+	var apiKey string
+	var page []byte
+	httpClient := http.Client{}
+	stationUrl := nporadio.GetStationUrl(stationId) + "/"
+
+	return []doctor.Check{
+		{
+			Name: "Config file",
+			Hint: `Run "npoleon config validate" to see all problems in the config file.`,
+			Run: func() (string, error) {
+				path, err := config.GetPath()
+				if err != nil {
+					return "", err
+				}
+				if profileErr != nil {
+					return "", profileErr
+				}
+				// Others shouldn't be able to change which account is used
+				return doctor.CheckPermissions(path, 0022)
+			},
+		},
+		{
+			Name: "Credentials file",
+			Hint: fmt.Sprintf(`Run "chmod 600 %s" to make it readable only by you.`, lastfm.GetApplicationPath("config")),
+			Run: func() (string, error) {
+				return doctor.CheckPermissions(lastfm.GetApplicationPath("config"), 0077)
+			},
+		},
+		{
+			Name: "Encrypted credentials file",
+			Hint: fmt.Sprintf(`Run "chmod 600 %s" to make it readable only by you.`, lastfm.GetApplicationPath("credentials")),
+			Run: func() (string, error) {
+				return doctor.CheckPermissions(lastfm.GetApplicationPath("credentials"), 0077)
+			},
+		},
+		{
+			Name: "Key file",
+			Hint: fmt.Sprintf(`Run "chmod 600 %s" to make it readable only by you.`, os.Getenv("NPOLEON_KEY_FILE")),
+			Run: func() (string, error) {
+				keyPath := os.Getenv("NPOLEON_KEY_FILE")
+				if keyPath == "" {
+					return "NPOLEON_KEY_FILE is not set", nil
+				}
+				return doctor.CheckPermissions(keyPath, 0077)
+			},
+		},
+		{
+			Name: "Last.fm API key and secret",
+			Hint: "Create an API account at https://www.last.fm/api/account/create, and add LASTFM_API_KEY " +
+				"and LASTFM_API_SECRET to " + lastfm.GetApplicationPath("config") + ".",
+			Run: func() (string, error) {
+				var err error
+				if store, err = openCredentialStore(); err != nil {
+					return "", err
+				}
+
+				apiKey = profile.Account.ApiKey
+				if apiKey == "" {
+					if apiKey, err = credentials.Lookup(store, credentials.ApiKey); err != nil {
+						return "", err
+					}
+				}
+				secret, err := credentials.Lookup(store, credentials.ApiSecret)
+				if err != nil {
+					return "", err
+				}
+
+				if apiKey == "" || secret == "" {
+					return "", errors.New("the API key or secret is missing")
+				}
+				return fmt.Sprintf("the secret is kept in the %s", store.Describe()), nil
+			},
+		},
+		{
+			Name:     "Last.fm session",
+			Hint:     `Run "npoleon login" to give Npoleon access to your Last.fm account again.`,
+			Requires: "Last.fm API key and secret",
+			Run: func() (string, error) {
+				client, err := lastfm.CreateClientFromStore(store, apiKey)
+				if err != nil {
+					return "", err
+				}
+				name, err := client.VerifySession()
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("logged in as %s", name), nil
+			},
+		},
+		{
+			Name: "NPO website",
+			Hint: fmt.Sprintf("Check your internet connection, and whether %s opens in a browser.", stationUrl),
+			Run: func() (string, error) {
+				var err error
+				if page, err = httpClient.Fetch(stationUrl); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%s is reachable", stationUrl), nil
+			},
+		},
+		{
+			Name:     "NPO buildId",
+			Hint:     websiteChangedHint,
+			Requires: "NPO website",
+			Run: func() (string, error) {
+				buildId, err := nporadio.ParseBuildId(page, stationId)
+				if err != nil {
+					return "", err
+				}
+				return buildId, nil
+			},
+		},
+		{
+			Name:     "NPO playlist",
+			Hint:     websiteChangedHint,
+			Requires: "NPO buildId",
+			Run: func() (string, error) {
+				client, err := nporadio.CreateClient(httpClient, stationId)
+				if err != nil {
+					return "", err
+				}
+				latest, err := client.FetchLatest()
+				if err != nil {
+					return "", err
+				}
+				if latest == nil {
+					return "no plays have been listed yet today", nil
+				}
+				return fmt.Sprintf("the latest play is %s", latest.String()), nil
+			},
+		},
+		{
+			Name:     "Clock",
+			Hint:     "Turn on automatic time synchronisation (NTP) on this computer.",
+			Requires: "NPO website",
+			Run: func() (string, error) {
+				server, err := httpClient.FetchDate(stationUrl)
+				if err != nil {
+					return "", err
+				}
+				return doctor.CheckClockSkew(time.Now(), server)
+			},
+		},
+	}
+}
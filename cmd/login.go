@@ -3,8 +3,10 @@ package cmd
 import (
 	"fmt"
 	"github.com/spf13/cobra"
+	"log/slog"
+	"npoleon/internal/config"
+	"npoleon/internal/credentials"
 	"npoleon/internal/lastfm"
-	"os"
 )
 
 var loginCmd = &cobra.Command{
@@ -13,20 +15,17 @@ var loginCmd = &cobra.Command{
 	Long: `Npoleon needs permissions to scrobble tracks on your behalf. Log in to Last.fm
 to provide permission to Npoleon.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if os.Getenv("LASTFM_SESSION_KEY") != "" {
-			err := restoreLastFmSession()
-			if err != nil {
-				fmt.Println("Error:", err)
-				os.Exit(1)
-			}
+		store, err := openCredentialStore()
+		exitOnError(err)
+
+		session, _ := credentials.Lookup(store, credentials.SessionKey)
+		if session != "" {
+			err = restoreLastFmSession(store)
 		} else {
-			err := startNewSession()
-			if err != nil {
-				fmt.Println("Error:", err)
-				os.Exit(1)
-			}
+			err = startNewSession(store)
 		}
-		fmt.Println("Great success! You can now scrobble tracks for NPO Radio 1, 2 and 3FM.")
+		exitOnError(err)
+		slog.Info("Great success! You can now scrobble tracks for NPO Radio 1, 2 and 3FM.")
 	},
 }
 
@@ -34,20 +33,34 @@ func init() {
 	rootCmd.AddCommand(loginCmd)
 }
 
-func restoreLastFmSession() error {
-	_, err := lastfm.CreateAuthenticatedClient(
-		os.Getenv("LASTFM_API_KEY"),
-		os.Getenv("LASTFM_API_SECRET"),
-		os.Getenv("LASTFM_SESSION_KEY"),
-	)
+// openCredentialStore also moves secrets that older versions kept in the config
+// file into the store
+func openCredentialStore() (credentials.Store, error) {
+	keyringProfile := ""
+	if profileName != config.DefaultProfile {
+		keyringProfile = profileName
+	}
+
+	store, err := credentials.Open(lastfm.GetApplicationDir(), keyringProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := credentials.CreateConfigFile(lastfm.GetApplicationPath("config"))
+	moved, err := credentials.Migrate(config, store)
+	for _, name := range moved {
+		slog.Info(fmt.Sprintf("Moved %s from the config file to the %s", name, store.Describe()))
+	}
+	return store, err
+}
+
+func restoreLastFmSession(store credentials.Store) error {
+	_, err := lastfm.CreateClientFromStore(store, profile.Account.ApiKey)
 	return err
 }
 
-func startNewSession() error {
-	scrobbler, err := lastfm.CreateClient(
-		os.Getenv("LASTFM_API_KEY"),
-		os.Getenv("LASTFM_API_SECRET"),
-	)
+func startNewSession(store credentials.Store) error {
+	scrobbler, err := lastfm.CreateClientFromStore(store, profile.Account.ApiKey)
 	if err != nil {
 		return err
 	}
@@ -1,12 +1,30 @@
 package cmd
 
 import (
+	"io"
+	"log/slog"
+	"npoleon/internal/config"
 	"npoleon/internal/lastfm"
+	"npoleon/internal/logging"
+	"npoleon/internal/util"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+// profileName and profile are set before any command runs
+var profileName string
+var profile config.Profile
+
+// timezone overrides the time zone in the profile
+var timezone string
+
+// Logging is set up before any command runs
+var verbose, quiet bool
+var logFile, logFormat string
+var logLevel slog.Level
+var logCloser io.Closer
+
 var rootCmd = &cobra.Command{
 	Use:   "npoleon",
 	Short: "Npoleon scrobbles tracks from NPO Radio 1, 2, and 3FM to Last.fm",
@@ -14,15 +32,120 @@ var rootCmd = &cobra.Command{
 being, have been, or will be played on NPO Radio 1, 2 and 3FM to Last.fm, a
 social network centred around music that – like 3FM – inexplicably still exists
 despite more than a decade of declining market share.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupLogging(); err != nil {
+			return err
+		}
+		return loadProfile()
+	},
+	SilenceUsage: true,
 }
 
 func Execute() {
 	err := rootCmd.Execute()
+	if logCloser != nil {
+		_ = logCloser.Close()
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(
+		&profileName,
+		"profile",
+		"",
+		"Use the settings and Last.fm account of a profile in the config file",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&timezone,
+		"tz",
+		"",
+		`Time zone in which times are entered and shown, e.g. "Europe/London" or "Local"`,
+	)
+	rootCmd.PersistentFlags().BoolVarP(
+		&verbose,
+		"verbose",
+		"v",
+		false,
+		"Also show debug messages, including every request to NPO and Last.fm",
+	)
+	rootCmd.PersistentFlags().BoolVarP(
+		&quiet,
+		"quiet",
+		"q",
+		false,
+		"Only show warnings and errors",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&logFile,
+		"log-file",
+		"",
+		"Also write all messages, with their fields, to a file",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&logFormat,
+		"log-format",
+		logging.TextFormat,
+		`Format of the messages: "text" or "json"`,
+	)
+}
+
+func setupLogging() error {
+	level, err := logging.GetLevel(verbose, quiet)
+	if err != nil {
+		return err
+	}
+	logLevel = level
+
+	logCloser, err = logging.Setup(logging.Options{
+		Level:  level,
+		Format: logFormat,
+		File:   logFile,
+	}, os.Stdout)
+	return err
+}
+
+// loadProfile selects the profile from the config file, applies overrides from
+// the environment and loads the credentials of older versions of Npoleon
+func loadProfile() error {
+	path, err := config.GetPath()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	name, selected, err := cfg.SelectProfile(profileName)
+	if err != nil {
+		return err
+	}
+	selected, err = selected.ApplyEnv()
+	if err != nil {
+		return err
+	}
+
+	profileName = name
+	profile = selected
+
+	if timezone == "" {
+		timezone = profile.Timezone
+	}
+	if timezone != "" {
+		location, err := util.LoadLocation(timezone)
+		if err != nil {
+			return err
+		}
+		util.SetLocation(location)
+	}
+
+	if name != config.DefaultProfile {
+		lastfm.SetProfile(name)
+	}
 	lastfm.Initialize()
+	return nil
 }
@@ -4,16 +4,22 @@ import (
 	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"log/slog"
+	"npoleon/internal/credentials"
+	"npoleon/internal/filtering"
 	"npoleon/internal/http"
 	"npoleon/internal/lastfm"
+	"npoleon/internal/logging"
 	"npoleon/internal/nporadio"
+	"npoleon/internal/rewriting"
 	"npoleon/internal/scrobbling"
 	"npoleon/internal/util"
 	"os"
+	"time"
 )
 
 var scrobbleCmd = &cobra.Command{
-	Use:   "scrobble STATION",
+	Use:   "scrobble [STATION]",
 	Short: "Scrobble tracks for an NPO radio station",
 	Long: `Scrobble tracks that have been, are being, or will be played on an NPO radio
 station. Valid station names are "nporadio1", "nporadio2", and "npo3fm".
@@ -22,6 +28,10 @@ To scrobble a single track that’s currently being played, execute:
 
   npoleon scrobble 3fm --once
 
+As Last.fm requires, a track can only be scrobbled once it has been played for
+half its length, or for four minutes. Until then, --once tells you when to try
+again.
+
 To keep scrobbling tracks indefinitely (at least until you terminate the
 command), simply execute:
 
@@ -39,14 +49,65 @@ Or ask Npoleon to scrobble tracks until a specific time:
 --from and --until can be combined to scrobble tracks for specific periods:
 
   npoleon scrobble 3fm --from "2024-01-20 14:30:00" --until "2024-01-20 20:55:00"
+
+Besides dates and times, --from and --until understand relative expressions
+like "2h ago", "yesterday 18:00", "last friday 08:00", "gisteravond" or
+"vanochtend". Use --for instead of --until to scrobble for a while, starting
+from --from (or now):
+
+  npoleon scrobble 3fm --from "yesterday 18:00" --for 90m
+
+Npoleon remembers the last play it scrobbled for each station. Use --catch-up
+to first scrobble everything that was played since then, e.g. after your
+computer has been off, and then keep scrobbling live:
+
+  npoleon scrobble 3fm --catch-up
+
+A long backfill that is interrupted continues where it stopped when the same
+command is run again, even if its period was given relative to now.
+
+While scrobbling tracks that have already been played, Npoleon shows how many
+days of playlists it has fetched, how many tracks it has scrobbled, skipped or
+failed to scrobble, and how long it expects to take. When the output isn't a
+terminal, the progress is logged every 30 seconds instead.
+
+Last.fm ignores tracks that were played more than two weeks ago. By default
+these are skipped with a warning. Use --outdated refuse to abort instead, or
+--outdated retime to import them back to back at the start of the two-week
+window.
+
+Featured artists in titles like "I Love It (feat. Charli XCX)" are kept as-is
+by default. Use --featuring artist to move them into the artist field,
+--featuring strip to remove them, or --featuring album-artist to also submit the
+main artist as the album artist.
+
+While scrobbling live, Npoleon checks which track is being played every 15
+seconds. Use --poll-interval to change this, or --adaptive to let Npoleon
+figure out when to check, based on when the current track is expected to end.
+
+Artist and title rewrite rules can be defined in ~/.npoleon/rules.json. Use
+--dry-run to see which tracks would be scrobbled and which rules were applied.
+
+Npoleon never scrobbles the same play twice, even when several processes run
+at the same time. Use --single-instance to refuse to start at all while
+another process is scrobbling for the same profile.
+
+Tracks can be excluded from scrobbling, or only specific tracks included, by
+defining filters in ~/.npoleon/filters.json.
+
+The station, filters, polling settings and default --from and --until can
+also be set in a profile in the config file, see "npoleon config".
 `,
 	Args: func(cmd *cobra.Command, args []string) error {
-		if err := cobra.ExactArgs(1)(cmd, args); err != nil {
-			return errors.New(`you must specify a station name, e.g. "nporadio" or "3fm"`)
+		// The station may also be configured in the profile
+		if err := cobra.MaximumNArgs(1)(cmd, args); err != nil {
+			return errors.New(`you must specify a single station name, e.g. "nporadio" or "3fm"`)
 		}
 
-		if _, err := nporadio.GetStationId(args[0]); err != nil {
-			return fmt.Errorf(`"%v" is not a valid station name`, args[0])
+		if len(args) == 1 {
+			if _, err := nporadio.GetStationId(args[0]); err != nil {
+				return fmt.Errorf(`"%v" is not a valid station name`, args[0])
+			}
 		}
 
 		return nil
@@ -55,22 +116,114 @@ Or ask Npoleon to scrobble tracks until a specific time:
 		once, _ := cmd.Flags().GetBool("once")
 		from, _ := cmd.Flags().GetString("from")
 		until, _ := cmd.Flags().GetString("until")
+		duration, _ := cmd.Flags().GetString("for")
+		outdated, _ := cmd.Flags().GetString("outdated")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		featuring, _ := cmd.Flags().GetString("featuring")
+		pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+		adaptive, _ := cmd.Flags().GetBool("adaptive")
+		cassette, _ := cmd.Flags().GetString("record-cassette")
+		singleInstance, _ := cmd.Flags().GetBool("single-instance")
+		catchUp, _ := cmd.Flags().GetBool("catch-up")
 
-		if os.Getenv("LASTFM_SESSION_KEY") == "" {
-			err := errors.New("you are not authenticated, make sure you run `npoleon login` first")
+		station, err := selectStation(args)
+		exitOnError(err)
+		if !cmd.Flags().Changed("poll-interval") && profile.Polling.GetInterval() > 0 {
+			pollInterval = profile.Polling.GetInterval()
+		}
+		if !cmd.Flags().Changed("adaptive") {
+			adaptive = profile.Polling.Adaptive
+		}
+		if catchUp && (once || from != "" || duration != "") {
+			exitOnError(errors.New("--catch-up cannot be combined with --once, --from or --for"))
+		}
+		if !cmd.Flags().Changed("from") && !cmd.Flags().Changed("until") && duration == "" && !once && !catchUp {
+			from, until = profile.Schedule.From, profile.Schedule.Until
+		}
+		if duration != "" {
+			if until != "" {
+				exitOnError(errors.New("--for cannot be combined with --until"))
+			}
+			if from == "" {
+				from = "now"
+			}
+		}
+
+		// Times are checked before anything is sent to NPO or Last.fm
+		var fromTime, untilTime time.Time
+		if !once && (from != "" || until != "") {
+			fromTime, untilTime, err = resolveWindow(from, until, duration)
 			exitOnError(err)
 		}
-		lastfmClient, err := lastfm.CreateAuthenticatedClient(
-			os.Getenv("LASTFM_API_KEY"),
-			os.Getenv("LASTFM_API_SECRET"),
-			os.Getenv("LASTFM_SESSION_KEY"),
+		if duration != "" {
+			until = duration
+		}
+
+		stationId, err := nporadio.GetStationId(station)
+		exitOnError(err)
+		slog.SetDefault(slog.Default().With("station", stationId))
+		checkpointFile := scrobbling.CreateCheckpointFile(
+			lastfm.GetApplicationPath(fmt.Sprintf("checkpoints/%s.json", stationId)),
 		)
+		if catchUp {
+			var found bool
+			fromTime, found, err = catchUpFrom(checkpointFile, untilTime)
+			exitOnError(err)
+			if found {
+				// Any value will do, the window has already been resolved
+				from = "checkpoint"
+			}
+		}
+
+		if singleInstance {
+			instance, err := lastfm.AcquireInstance()
+			if err != nil {
+				exitOnError(fmt.Errorf("%w for profile %q", err, profileName))
+			}
+			defer instance.Unlock()
+		}
+
+		outdatedPolicy, err := scrobbling.GetOutdatedPolicy(outdated)
+		exitOnError(err)
+
+		featuringStrategy, err := rewriting.GetFeaturingStrategy(featuring)
 		exitOnError(err)
 
-		radioClient, err := createRadioClient(args[0])
+		store, err := openCredentialStore()
 		exitOnError(err)
 
+		if session, _ := credentials.Lookup(store, credentials.SessionKey); session == "" {
+			err := errors.New("you are not authenticated, make sure you run `npoleon login` first")
+			exitOnError(err)
+		}
+		lastfmClient, err := lastfm.CreateClientFromStore(store, profile.Account.ApiKey)
+		exitOnError(err)
+
+		rules, err := rewriting.LoadRules(lastfm.GetApplicationPath("rules.json"))
+		exitOnError(err)
+		lastfmClient = lastfmClient.
+			WithFeaturingStrategy(featuringStrategy).
+			WithRules(rules).
+			WithDryRun(dryRun)
+
+		radioClient, err := createRadioClient(station, cassette)
+		exitOnError(err)
+		radioClient = radioClient.WithEnricher(lastfmClient)
+
 		scrobbler := scrobbling.CreateScrobbler(radioClient, lastfmClient)
+		scrobbler.SetOutdatedPolicy(outdatedPolicy)
+		scrobbler.SetPolling(scrobbling.Polling{Interval: pollInterval, Adaptive: adaptive})
+		if !dryRun {
+			scrobbler.SetCheckpointFile(checkpointFile)
+		}
+		if logLevel <= slog.LevelInfo {
+			live := isTerminal(os.Stdout) && logFormat == logging.TextFormat
+			scrobbler.SetProgress(scrobbling.CreateProgress(os.Stdout, live))
+		}
+
+		filter, err := loadFilter()
+		exitOnError(err)
+		scrobbler.SetFilter(filter)
 
 		if once {
 			err = scrobbler.ScrobbleOnce()
@@ -84,24 +237,28 @@ Or ask Npoleon to scrobble tracks until a specific time:
 			return
 		}
 
-		fromTime, _ := util.ParseTimeFrom(from)
-		untilTime, _ := util.ParseTimeUntil(until)
-
-		if fromTime.After(untilTime) {
-			exitOnError(errors.New("--from must be before --after"))
-		}
-
 		if from == "" && until != "" {
+			slog.Info("Scrobbling tracks until "+util.FormatTime(untilTime), "until", untilTime)
 			err = scrobbler.ScrobbleUntil(untilTime)
 			exitOnError(err)
 			return
 		}
 		if from != "" && until == "" {
+			slog.Info("Scrobbling tracks played since "+util.FormatTime(fromTime), "from", fromTime)
 			err = scrobbler.ScrobbleFrom(fromTime)
 			exitOnError(err)
 			return
 		}
 		if from != "" && until != "" {
+			slog.Info(
+				fmt.Sprintf(
+					"Scrobbling tracks played from %s until %s",
+					util.FormatTime(fromTime),
+					util.FormatTime(untilTime),
+				),
+				"from", fromTime,
+				"until", untilTime,
+			)
 			err = scrobbler.ScrobblePeriod(fromTime, untilTime)
 			exitOnError(err)
 			return
@@ -117,7 +274,7 @@ func init() {
 		"once",
 		"o",
 		false,
-		"Only attempt to scrobble a track that is currently being played",
+		"Only attempt to scrobble a track that is currently being played, once it has been played long enough",
 	)
 	scrobbleCmd.Flags().StringP(
 		"from",
@@ -131,15 +288,163 @@ func init() {
 		"",
 		"Scrobble until a moment in the past or future. Must be after --from",
 	)
+	scrobbleCmd.Flags().String(
+		"for",
+		"",
+		"Scrobble for a period of time after --from, e.g. 90m or \"2 hours\"",
+	)
+	scrobbleCmd.Flags().Bool(
+		"catch-up",
+		false,
+		"Scrobble everything played since the last play that was scrobbled before going live",
+	)
+	scrobbleCmd.Flags().Bool(
+		"dry-run",
+		false,
+		"Show what would be scrobbled without submitting anything to Last.fm",
+	)
+	scrobbleCmd.Flags().Duration(
+		"poll-interval",
+		scrobbling.DefaultPollInterval,
+		"How often to check which track is being played, e.g. 30s or 1m",
+	)
+	scrobbleCmd.Flags().Bool(
+		"adaptive",
+		false,
+		"Check less often while a track is playing and keep retrying after errors",
+	)
+	scrobbleCmd.Flags().Bool(
+		"single-instance",
+		false,
+		"Refuse to start while another npoleon process is scrobbling for the same profile",
+	)
+	scrobbleCmd.Flags().String(
+		"featuring",
+		"keep",
+		`How to handle featured artists: "keep", "artist", "strip" or "album-artist"`,
+	)
+	scrobbleCmd.Flags().String(
+		"outdated",
+		"skip",
+		`What to do with tracks too old for Last.fm: "skip", "refuse" or "retime"`,
+	)
+	scrobbleCmd.Flags().String(
+		"record-cassette",
+		"",
+		"Save all responses from NPO to a cassette file, for use in tests",
+	)
+	_ = scrobbleCmd.Flags().MarkHidden("record-cassette")
 }
 
-func createRadioClient(stationName string) (nporadio.Client, error) {
+// selectStation falls back to the first station in the profile
+func selectStation(args []string) (string, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	if len(profile.Stations) > 0 {
+		return profile.Stations[0], nil
+	}
+	return "", errors.New(`you must specify a station name, e.g. "nporadio" or "3fm"`)
+}
+
+// resolveWindow turns --from, --until and --for into an absolute window. Times
+// that can't be parsed are errors, rather than silently becoming "now".
+func resolveWindow(from string, until string, duration string) (time.Time, time.Time, error) {
+	for _, input := range []string{from, until} {
+		if warning := util.AmbiguityWarning(input); warning != "" {
+			slog.Warn(warning)
+		}
+	}
+
+	now := time.Now()
+	fromTime, err := util.ParseTimeFrom(from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid --from: %w", err)
+	}
+	untilTime, err := util.ParseTimeUntil(until)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid --until: %w", err)
+	}
+	if duration != "" {
+		length, err := util.ParseDuration(duration)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid --for: %w", err)
+		}
+		untilTime = fromTime.Add(length)
+	}
+
+	if from != "" {
+		if fromTime.After(untilTime) && (until != "" || duration != "") {
+			return time.Time{}, time.Time{}, fmt.Errorf(
+				"--from (%s) must be before --until (%s)",
+				util.FormatTime(fromTime),
+				util.FormatTime(untilTime),
+			)
+		}
+		if err := nporadio.CheckAvailable(fromTime, now); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("--from is %s, but %w", util.FormatTime(fromTime), err)
+		}
+	} else if untilTime.Before(now) {
+		return time.Time{}, time.Time{}, fmt.Errorf(
+			"--until (%s) is in the past, add --from to scrobble tracks that have already been played",
+			util.FormatTime(untilTime),
+		)
+	}
+	return fromTime, untilTime, nil
+}
+
+// catchUpFrom returns the last play that was handled for the station, or false
+// if the station hasn't been scrobbled before. Plays that NPO no longer lists
+// can't be caught up on.
+func catchUpFrom(file scrobbling.CheckpointFile, until time.Time) (time.Time, bool, error) {
+	checkpoint, err := file.Load()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if checkpoint.Last.IsZero() {
+		slog.Info("Nothing to catch up on, because this station hasn't been scrobbled before")
+		return time.Time{}, false, nil
+	}
+
+	now := time.Now()
+	if !until.IsZero() && !checkpoint.Last.Before(until) {
+		return time.Time{}, false, fmt.Errorf(
+			"--until (%s) must be after the last play that was scrobbled (%s)",
+			util.FormatTime(until),
+			util.FormatTime(checkpoint.Last),
+		)
+	}
+	if oldest := nporadio.OldestAvailable(now); checkpoint.Last.Before(oldest) {
+		slog.Warn(fmt.Sprintf(
+			"the last play that was scrobbled is from %s, but NPO only lists plays since %s",
+			util.FormatTime(checkpoint.Last),
+			util.FormatTime(oldest),
+		))
+		return oldest, true, nil
+	}
+	return checkpoint.Last, true, nil
+}
+
+// loadFilter prefers the filters in the profile over ~/.npoleon/filters.json
+func loadFilter() (filtering.Filter, error) {
+	if len(profile.Filters) > 0 {
+		return filtering.ParseFilter(profile.Filters)
+	}
+	return filtering.LoadFilter(lastfm.GetApplicationPath("filters.json"))
+}
+
+func createRadioClient(stationName string, cassette string) (nporadio.Client, error) {
 	stationId, err := nporadio.GetStationId(stationName)
 	if err != nil {
 		return nporadio.Client{}, err
 	}
 
-	radioClient, err := nporadio.CreateClient(&http.Client{}, stationId)
+	var httpClient http.ClientInterface = &http.Client{}
+	if cassette != "" {
+		httpClient = http.CreateRecordingClient(httpClient, cassette)
+	}
+
+	radioClient, err := nporadio.CreateClient(httpClient, stationId)
 	if err != nil {
 		return nporadio.Client{}, err
 	}
@@ -148,7 +453,12 @@ func createRadioClient(stationName string) (nporadio.Client, error) {
 
 func exitOnError(err error) {
 	if err != nil {
-		fmt.Println("Error:", err.Error())
+		slog.Error(err.Error())
+
+		var timeErr *util.TimeError
+		if errors.As(err, &timeErr) && logFormat == logging.TextFormat {
+			fmt.Println(timeErr.Pointer())
+		}
 		os.Exit(1)
 	}
 }
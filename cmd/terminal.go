@@ -0,0 +1,13 @@
+package cmd
+
+import "os"
+
+// isTerminal reports whether f is a terminal rather than a file or a pipe, so
+// that output meant for people can be redrawn in place
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
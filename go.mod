@@ -2,6 +2,7 @@ module npoleon
 
 go 1.21
 
+require filippo.io/age v1.2.1
 require github.com/google/uuid v1.5.0
 require github.com/joho/godotenv v1.5.1
 require github.com/shkh/lastfm-go v0.0.0-20191215035245-89a801c244e0
@@ -10,4 +11,6 @@ require github.com/spf13/cobra v1.8.0
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 )
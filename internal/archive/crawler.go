@@ -0,0 +1,281 @@
+package archive
+
+import (
+	"fmt"
+	"log/slog"
+	"npoleon/internal/clock"
+	"npoleon/internal/nporadio"
+	"npoleon/internal/util"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultInterval is how often the crawler checks for new plays
+const DefaultInterval = 5 * time.Minute
+
+// pollOverlap is how far each poll looks back before the previous one
+const pollOverlap = 15 * time.Minute
+
+// maxErrorDelay caps how long the crawler waits after consecutive errors
+const maxErrorDelay = 30 * time.Minute
+
+// maxEmptyDays is how many consecutive days without plays the crawler skips
+// within NPO's retention before it considers the history exhausted
+const maxEmptyDays = 7
+
+// Crawler mirrors the playlists of several stations into a store. For each
+// station it keeps archiving live plays, and in between it walks back through
+// the station's history, one day at a time, until NPO no longer serves older
+// playlists. Progress is saved in a checkpoint after every step, so that a
+// crawler that is restarted continues where the previous one left off.
+//
+// The crawler doesn't limit the number of requests itself: the clients should
+// share a rate-limited HTTP client.
+type Crawler struct {
+	store     Store
+	clients   []nporadio.Client
+	clock     clock.Clock
+	interval  time.Duration
+	interrupt <-chan os.Signal
+}
+
+func CreateCrawler(store Store, clients []nporadio.Client) Crawler {
+	return Crawler{
+		store:    store,
+		clients:  clients,
+		clock:    clock.Real{},
+		interval: DefaultInterval,
+	}
+}
+
+// SetClock also passes the clock on to the radio clients
+func (c *Crawler) SetClock(clock clock.Clock) {
+	c.clock = clock
+	for idx := range c.clients {
+		c.clients[idx] = c.clients[idx].WithClock(clock)
+	}
+}
+
+func (c *Crawler) SetInterval(interval time.Duration) {
+	c.interval = interval
+}
+
+// Run crawls all stations concurrently until the process is asked to stop.
+// Errors are reported, after which the station is retried later.
+func (c Crawler) Run() error {
+	sig := c.interrupt
+	if sig == nil {
+		notifications := make(chan os.Signal, 1)
+		signal.Notify(notifications, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(notifications)
+		sig = notifications
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		<-sig
+		close(stop)
+	}()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(c.clients))
+	for idx := range c.clients {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = c.crawl(c.clients[idx], stop)
+		}(idx)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// crawl only returns when it is stopped, or when the checkpoint of the station
+// can't be read
+func (c Crawler) crawl(client nporadio.Client, stop <-chan struct{}) error {
+	station, err := c.createStation(client)
+	if err != nil {
+		return err
+	}
+
+	var consecutiveErrors int
+	for {
+		delay, err := station.step()
+		if err != nil {
+			consecutiveErrors++
+			delay = min(c.interval*time.Duration(consecutiveErrors), maxErrorDelay)
+			slog.Warn(
+				fmt.Sprintf("archiving %s failed, retrying in %v: %v", station.id, delay, err),
+				"station", station.id,
+				"errors", consecutiveErrors,
+			)
+		} else {
+			consecutiveErrors = 0
+		}
+
+		if c.wait(delay, stop) {
+			return nil
+		}
+	}
+}
+
+// wait returns true if the crawler was stopped in the meantime
+func (c Crawler) wait(delay time.Duration, stop <-chan struct{}) bool {
+	for {
+		select {
+		case <-stop:
+			return true
+		default:
+		}
+
+		if delay <= 0 {
+			return false
+		}
+		step := min(delay, 500*time.Millisecond)
+		c.clock.Sleep(step)
+		delay -= step
+	}
+}
+
+// station is the state of a single station while it is being crawled
+type station struct {
+	id         nporadio.StationId
+	client     nporadio.Client
+	store      Store
+	clock      clock.Clock
+	interval   time.Duration
+	checkpoint Checkpoint
+	lastPoll   time.Time
+}
+
+func (c Crawler) createStation(client nporadio.Client) (*station, error) {
+	checkpoint, err := c.store.Checkpoint(client.StationId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &station{
+		id:         client.StationId(),
+		client:     client,
+		store:      c.store,
+		clock:      c.clock,
+		interval:   c.interval,
+		checkpoint: checkpoint,
+	}, nil
+}
+
+// step either archives the latest plays, when that is due, or archives
+// another day of the station's history. It returns how long to wait before
+// the next step.
+func (s *station) step() (time.Duration, error) {
+	now := s.clock.Now()
+
+	if s.lastPoll.IsZero() || now.Sub(s.lastPoll) >= s.interval {
+		s.lastPoll = now
+		if err := s.archiveLatest(now); err != nil {
+			return 0, err
+		}
+	} else if !s.checkpoint.Exhausted {
+		if err := s.archivePreviousDay(now); err != nil {
+			return 0, err
+		}
+	}
+
+	if s.checkpoint.Exhausted {
+		return s.lastPoll.Add(s.interval).Sub(now), nil
+	}
+	return 0, nil
+}
+
+// archiveLatest archives all plays since the previous poll. After the first
+// run, or when the crawler hasn't run for a while, this fills the gap since
+// the checkpoint.
+func (s *station) archiveLatest(now time.Time) error {
+	from := s.checkpoint.Newest
+	if from.IsZero() {
+		from = startOfDay(now)
+	}
+
+	tracks, err := s.client.FetchRange(from, now)
+	if err != nil {
+		return err
+	}
+	added, err := s.store.Add(s.id, tracks)
+	if err != nil {
+		return err
+	}
+	if added > 0 {
+		slog.Info(fmt.Sprintf("Archived %d new play(s) on %s", added, s.id), "station", s.id, "added", added)
+	}
+
+	// NPO sometimes publishes plays a little late, so the next poll starts a
+	// bit earlier. Plays that are archived twice are ignored by the store.
+	s.checkpoint.Newest = now.Add(-pollOverlap)
+	if s.checkpoint.Oldest.IsZero() || from.Before(s.checkpoint.Oldest) {
+		s.checkpoint.Oldest = startOfDay(from)
+	}
+	return s.store.SaveCheckpoint(s.id, s.checkpoint)
+}
+
+// archivePreviousDay archives the day before the oldest day in the archive.
+// The history is exhausted once the day is beyond NPO's retention, or after
+// maxEmptyDays consecutive days without plays. Shorter gaps are skipped.
+func (s *station) archivePreviousDay(now time.Time) error {
+	oldest := s.checkpoint.Oldest.In(location).AddDate(0, 0, -s.checkpoint.EmptyDays)
+	day := startOfDay(oldest.AddDate(0, 0, -1))
+	beyondRetention := day.Before(nporadio.OldestAvailable(now))
+
+	tracks, err := s.client.FetchRange(day, oldest.Add(-time.Second))
+	if err != nil && beyondRetention {
+		// NPO may refuse to serve days beyond its retention
+		tracks, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(tracks) == 0 {
+		s.checkpoint.EmptyDays++
+		if !beyondRetention && s.checkpoint.EmptyDays < maxEmptyDays {
+			slog.Info(
+				fmt.Sprintf("No plays on %s from %s, skipping the day", s.id, day.Format("2006-01-02")),
+				"station", s.id,
+				"day", day.Format("2006-01-02"),
+			)
+			return s.store.SaveCheckpoint(s.id, s.checkpoint)
+		}
+
+		slog.Info(
+			fmt.Sprintf("Archived the history of %s back to %s", s.id, util.FormatTime(s.checkpoint.Oldest)),
+			"station", s.id,
+			"oldest", s.checkpoint.Oldest,
+		)
+		s.checkpoint.EmptyDays = 0
+		s.checkpoint.Exhausted = true
+		return s.store.SaveCheckpoint(s.id, s.checkpoint)
+	}
+
+	added, err := s.store.Add(s.id, tracks)
+	if err != nil {
+		return err
+	}
+	slog.Info(
+		fmt.Sprintf("Archived %d play(s) on %s from %s", added, s.id, day.Format("2006-01-02")),
+		"station", s.id,
+		"day", day.Format("2006-01-02"),
+		"added", added,
+	)
+
+	s.checkpoint.Oldest = day
+	s.checkpoint.EmptyDays = 0
+	return s.store.SaveCheckpoint(s.id, s.checkpoint)
+}
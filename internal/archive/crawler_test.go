@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"fmt"
+	"npoleon/internal/clock"
+	"npoleon/internal/http"
+	"npoleon/internal/nporadio"
+	"npoleon/internal/nporadio/fakeserver"
+	"os"
+	"testing"
+	"time"
+)
+
+// createPlays creates a play every half hour on the three days before 12:00 on
+// 10 January 2024
+func createPlays() []fakeserver.Play {
+	var plays []fakeserver.Play
+	start := time.Date(2024, 1, 8, 0, 0, 0, 0, location)
+	for moment := start; moment.Before(time.Date(2024, 1, 10, 12, 0, 0, 0, location)); moment = moment.Add(30 * time.Minute) {
+		plays = append(plays, fakeserver.Play{
+			Artist:   "Artist",
+			Title:    fmt.Sprintf("Track at %s", moment.Format("2006-01-02 15:04")),
+			PlayedAt: moment,
+		})
+	}
+	return plays
+}
+
+func createTestCrawler(t *testing.T, fakeClock clock.Fake, server *fakeserver.Server, store Store) Crawler {
+	client, err := nporadio.CreateClientWithBaseUrl(&http.Client{}, nporadio.NpoRadio2, server.URL)
+	if err != nil {
+		t.Fatalf("Creating client failed: %v", err)
+	}
+
+	crawler := CreateCrawler(store, []nporadio.Client{client})
+	crawler.SetClock(fakeClock)
+	return crawler
+}
+
+func countPlays(store Store, from time.Time, until time.Time) int {
+	plays, _ := store.Plays(nporadio.NpoRadio2, from, until)
+	return len(plays)
+}
+
+func TestCrawler_Steps(t *testing.T) {
+	// > Arrange
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, location)
+	fakeClock := clock.NewFake(now)
+	server := fakeserver.Start(fakeClock, createPlays())
+	defer server.Close()
+	store, _ := OpenStore(t.TempDir())
+	crawler := createTestCrawler(t, fakeClock, server, store)
+	station, _ := crawler.createStation(crawler.clients[0])
+
+	t.Run("The first step archives today's plays", func(t *testing.T) {
+		// > Act
+		delay, err := station.step()
+
+		// > Assert
+		if err != nil || delay != 0 {
+			t.Fatalf("Expected to continue right away, got %v (%v)", delay, err)
+		}
+		if count := countPlays(store, time.Date(2024, 1, 10, 0, 0, 0, 0, location), now); count != 24 {
+			t.Errorf("Expected 24 plays today, got %d", count)
+		}
+	})
+
+	t.Run("Next steps walk back one day at a time", func(t *testing.T) {
+		// > Act
+		_, _ = station.step()
+		afterOneDay := countPlays(store, time.Date(2024, 1, 8, 0, 0, 0, 0, location), now)
+		_, _ = station.step()
+		afterTwoDays := countPlays(store, time.Date(2024, 1, 8, 0, 0, 0, 0, location), now)
+
+		// > Assert
+		if afterOneDay != 72 || afterTwoDays != 120 {
+			t.Errorf("Expected 72 and 120 plays, got %d and %d", afterOneDay, afterTwoDays)
+		}
+	})
+
+	t.Run("The history is exhausted after a week without plays", func(t *testing.T) {
+		// > Act
+		var delays []time.Duration
+		for step := 0; step < maxEmptyDays; step++ {
+			delay, err := station.step()
+			if err != nil {
+				t.Fatalf("Step failed: %v", err)
+			}
+			delays = append(delays, delay)
+		}
+		checkpoint, _ := store.Checkpoint(nporadio.NpoRadio2)
+
+		// > Assert
+		if !checkpoint.Exhausted {
+			t.Fatalf("Expected the history to be exhausted, got %+v", checkpoint)
+		}
+		if !checkpoint.Oldest.Equal(time.Date(2024, 1, 8, 0, 0, 0, 0, location)) {
+			t.Errorf("Expected the archive to start on 8 January, got %v", checkpoint.Oldest)
+		}
+		if delays[0] != 0 || delays[len(delays)-1] != DefaultInterval {
+			t.Errorf("Expected to skip empty days right away and then wait until the next poll, got %v", delays)
+		}
+	})
+
+	t.Run("A restarted crawler resumes from the checkpoint", func(t *testing.T) {
+		// > Arrange
+		fakeClock.Sleep(time.Hour)
+		server.AddPlays(fakeserver.Play{Artist: "Artist", Title: "New", PlayedAt: now.Add(30 * time.Minute)})
+		resumed, _ := crawler.createStation(crawler.clients[0])
+		requests := len(server.Requests())
+
+		// > Act
+		_, err := resumed.step()
+
+		// > Assert
+		if err != nil || countPlays(store, now, now.Add(time.Hour)) != 1 {
+			t.Errorf("Expected the new play to be archived, got %v", err)
+		}
+		if made := len(server.Requests()) - requests; made != 1 {
+			t.Errorf("Expected only today's first page to be fetched, got %d requests", made)
+		}
+		if resumed.checkpoint.Oldest.Day() != 8 || !resumed.checkpoint.Exhausted {
+			t.Errorf("Expected the history not to be crawled again, got %+v", resumed.checkpoint)
+		}
+	})
+}
+
+func TestCrawler_GapDay(t *testing.T) {
+	// > Arrange
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, location)
+	fakeClock := clock.NewFake(now)
+	plays := append(createPlays(), fakeserver.Play{
+		Artist:   "Artist",
+		Title:    "Before the gap",
+		PlayedAt: time.Date(2024, 1, 6, 12, 0, 0, 0, location),
+	})
+	server := fakeserver.Start(fakeClock, plays)
+	defer server.Close()
+	store, _ := OpenStore(t.TempDir())
+	crawler := createTestCrawler(t, fakeClock, server, store)
+	station, _ := crawler.createStation(crawler.clients[0])
+
+	// > Act
+	for step := 0; step < 20 && !station.checkpoint.Exhausted; step++ {
+		if _, err := station.step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+	}
+
+	// > Assert
+	if count := countPlays(store, time.Date(2024, 1, 6, 0, 0, 0, 0, location), time.Date(2024, 1, 7, 0, 0, 0, 0, location)); count != 1 {
+		t.Errorf("Expected the play before the empty day to be archived, got %d plays", count)
+	}
+	if !station.checkpoint.Oldest.Equal(time.Date(2024, 1, 6, 0, 0, 0, 0, location)) {
+		t.Errorf("Expected the archive to start on 6 January, got %v", station.checkpoint.Oldest)
+	}
+}
+
+func TestCrawler_Run(t *testing.T) {
+	// > Arrange
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, location)
+	fakeClock := clock.NewFake(now)
+	server := fakeserver.Start(fakeClock, createPlays())
+	defer server.Close()
+	store, _ := OpenStore(t.TempDir())
+	crawler := createTestCrawler(t, fakeClock, server, store)
+
+	interrupt := make(chan os.Signal, 1)
+	crawler.interrupt = interrupt
+	go func() {
+		for {
+			checkpoint, _ := store.Checkpoint(nporadio.NpoRadio2)
+			if checkpoint.Exhausted {
+				interrupt <- os.Interrupt
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	// > Act
+	err := crawler.Run()
+
+	// > Assert
+	if err != nil {
+		t.Errorf("Expected the crawler to stop without errors, got %v", err)
+	}
+	if count := countPlays(store, time.Date(2024, 1, 8, 0, 0, 0, 0, location), now); count != 120 {
+		t.Errorf("Expected all 120 plays to be archived, got %d", count)
+	}
+}
@@ -0,0 +1,235 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"npoleon/internal/nporadio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var location, _ = time.LoadLocation("Europe/Amsterdam")
+
+// Play is a single play of a track on a station, as it is kept in the archive
+type Play struct {
+	Id       uuid.UUID `json:"id"`
+	Artist   string    `json:"artist"`
+	Title    string    `json:"title"`
+	PlayedAt time.Time `json:"playedAt"`
+}
+
+// Checkpoint records which part of a station's playlist has been archived
+type Checkpoint struct {
+	// Oldest is the start of the oldest day that has been archived
+	Oldest time.Time `json:"oldest,omitempty"`
+	// Newest is the moment up to which all plays have been archived
+	Newest time.Time `json:"newest,omitempty"`
+	// Exhausted is set once NPO no longer serves older playlists
+	Exhausted bool `json:"exhausted,omitempty"`
+	// EmptyDays is the number of days before Oldest without any plays. They
+	// are skipped, as NPO sometimes lists no plays for a day in its history.
+	EmptyDays int `json:"emptyDays,omitempty"`
+}
+
+// Store keeps the plays of each station in a directory of its own, with a file
+// per day (in Amsterdam) that contains a play per line. Plays are only ever
+// appended, so that an archive can be read while it is being written.
+type Store struct {
+	dir   string
+	mutex *sync.Mutex
+}
+
+func OpenStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Store{}, err
+	}
+	return Store{dir: dir, mutex: &sync.Mutex{}}, nil
+}
+
+func (s Store) stationDir(station nporadio.StationId) string {
+	return filepath.Join(s.dir, string(station))
+}
+
+func (s Store) dayPath(station nporadio.StationId, day time.Time) string {
+	return filepath.Join(s.stationDir(station), day.In(location).Format("2006-01-02")+".jsonl")
+}
+
+// Add stores the tracks that aren't in the archive yet, and returns how many
+// of them were new
+func (s Store) Add(station nporadio.StationId, tracks []nporadio.Track) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.MkdirAll(s.stationDir(station), 0755); err != nil {
+		return 0, err
+	}
+
+	byDay := map[string][]nporadio.Track{}
+	for _, track := range tracks {
+		path := s.dayPath(station, track.PlayedAt)
+		byDay[path] = append(byDay[path], track)
+	}
+
+	var added int
+	for path, tracks := range byDay {
+		count, err := appendPlays(path, tracks)
+		added += count
+		if err != nil {
+			return added, err
+		}
+	}
+	return added, nil
+}
+
+func appendPlays(path string, tracks []nporadio.Track) (int, error) {
+	contents, err := readFile(path)
+	if err != nil {
+		return 0, err
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, play := range parsePlays(contents) {
+		seen[play.Id] = true
+	}
+
+	var lines strings.Builder
+	if len(contents) > 0 && contents[len(contents)-1] != '\n' {
+		// Don't continue a line that was cut off when the process was killed
+		lines.WriteString("\n")
+	}
+
+	var added int
+	for _, track := range tracks {
+		if seen[track.Id] {
+			continue
+		}
+		seen[track.Id] = true
+
+		line, err := json.Marshal(Play{
+			Id:       track.Id,
+			Artist:   track.Artist,
+			Title:    track.Title,
+			PlayedAt: track.PlayedAt,
+		})
+		if err != nil {
+			return 0, err
+		}
+		lines.Write(line)
+		lines.WriteString("\n")
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err = f.WriteString(lines.String()); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+func readFile(path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return contents, err
+}
+
+// parsePlays skips lines that can't be parsed, which only happens when the
+// process was killed while writing a line
+func parsePlays(contents []byte) []Play {
+	var plays []Play
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		var play Play
+		if err := json.Unmarshal(scanner.Bytes(), &play); err == nil {
+			plays = append(plays, play)
+		}
+	}
+	return plays
+}
+
+// Plays returns the archived plays of a station between from and until
+// (inclusive), in chronological order
+func (s Store) Plays(station nporadio.StationId, from time.Time, until time.Time) ([]Play, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var result []Play
+	for day := startOfDay(from); !day.After(until); day = day.AddDate(0, 0, 1) {
+		contents, err := readFile(s.dayPath(station, day))
+		if err != nil {
+			return nil, err
+		}
+		for _, play := range parsePlays(contents) {
+			if !play.PlayedAt.Before(from) && !play.PlayedAt.After(until) {
+				result = append(result, play)
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].PlayedAt.Before(result[j].PlayedAt)
+	})
+	return result, nil
+}
+
+func (s Store) checkpointPath(station nporadio.StationId) string {
+	return filepath.Join(s.stationDir(station), "checkpoint.json")
+}
+
+// Checkpoint returns an empty checkpoint for stations that haven't been
+// archived before
+func (s Store) Checkpoint(station nporadio.StationId) (Checkpoint, error) {
+	contents, err := os.ReadFile(s.checkpointPath(station))
+	if errors.Is(err, os.ErrNotExist) {
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	var checkpoint Checkpoint
+	if err = json.Unmarshal(contents, &checkpoint); err != nil {
+		return Checkpoint{}, fmt.Errorf("%s: %w", s.checkpointPath(station), err)
+	}
+	return checkpoint, nil
+}
+
+// SaveCheckpoint replaces the checkpoint in one go, so that it is never left
+// half-written
+func (s Store) SaveCheckpoint(station nporadio.StationId, checkpoint Checkpoint) error {
+	if err := os.MkdirAll(s.stationDir(station), 0755); err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := s.checkpointPath(station)
+	if err = os.WriteFile(path+".tmp", contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func startOfDay(moment time.Time) time.Time {
+	year, month, day := moment.In(location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, location)
+}
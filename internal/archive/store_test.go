@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"github.com/google/uuid"
+	"npoleon/internal/nporadio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTrack(title string, playedAt time.Time) nporadio.Track {
+	return nporadio.Track{Id: uuid.New(), Artist: "Artist", Title: title, PlayedAt: playedAt}
+}
+
+func TestStore_Add(t *testing.T) {
+	// > Arrange
+	store, _ := OpenStore(t.TempDir())
+	first := createTrack("Track 1", time.Date(2024, 1, 9, 23, 58, 0, 0, location))
+	second := createTrack("Track 2", time.Date(2024, 1, 10, 0, 2, 0, 0, location))
+
+	// > Act
+	added, err := store.Add(nporadio.NpoRadio2, []nporadio.Track{first, second})
+	addedAgain, _ := store.Add(nporadio.NpoRadio2, []nporadio.Track{second})
+	plays, _ := store.Plays(nporadio.NpoRadio2, first.PlayedAt, second.PlayedAt)
+
+	// > Assert
+	if err != nil || added != 2 {
+		t.Fatalf("Expected 2 plays to be added, got %d (%v)", added, err)
+	}
+	if addedAgain != 0 {
+		t.Errorf("Expected plays that are already archived to be ignored, got %d", addedAgain)
+	}
+	if len(plays) != 2 || plays[0].Title != "Track 1" || plays[1].Title != "Track 2" {
+		t.Errorf("Expected both plays in chronological order, got %+v", plays)
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, "nporadio2", "2024-01-10.jsonl")); err != nil {
+		t.Errorf("Expected a file per day, got %v", err)
+	}
+}
+
+func TestStore_Add_AfterCutOffLine(t *testing.T) {
+	// > Arrange
+	store, _ := OpenStore(t.TempDir())
+	track := createTrack("Track 1", time.Date(2024, 1, 10, 8, 0, 0, 0, location))
+	path := store.dayPath(nporadio.NpoRadio2, track.PlayedAt)
+	_ = os.MkdirAll(filepath.Dir(path), 0755)
+	_ = os.WriteFile(path, []byte(`{"id":"6f1c`), 0644)
+
+	// > Act
+	added, err := store.Add(nporadio.NpoRadio2, []nporadio.Track{track})
+	plays, _ := store.Plays(nporadio.NpoRadio2, track.PlayedAt, track.PlayedAt)
+
+	// > Assert
+	if err != nil || added != 1 || len(plays) != 1 {
+		t.Errorf("Expected the play to be added after the broken line, got %d and %+v (%v)", added, plays, err)
+	}
+	contents, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(contents), "{\"id\":\"6f1c\n") {
+		t.Errorf("Expected the new play on a line of its own, got %q", contents)
+	}
+}
+
+func TestStore_Checkpoint(t *testing.T) {
+	// > Arrange
+	store, _ := OpenStore(t.TempDir())
+	checkpoint := Checkpoint{
+		Oldest: time.Date(2024, 1, 9, 0, 0, 0, 0, location),
+		Newest: time.Date(2024, 1, 10, 11, 45, 0, 0, location),
+	}
+
+	// > Act
+	empty, emptyErr := store.Checkpoint(nporadio.NpoRadio1)
+	err := store.SaveCheckpoint(nporadio.NpoRadio1, checkpoint)
+	res, _ := store.Checkpoint(nporadio.NpoRadio1)
+
+	// > Assert
+	if emptyErr != nil || !empty.Oldest.IsZero() {
+		t.Errorf("Expected an empty checkpoint for a new station, got %+v (%v)", empty, emptyErr)
+	}
+	if err != nil || !res.Oldest.Equal(checkpoint.Oldest) || !res.Newest.Equal(checkpoint.Newest) {
+		t.Errorf("Expected %+v, got %+v (%v)", checkpoint, res, err)
+	}
+}
@@ -0,0 +1,182 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------------------
+
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// ----------------------------------------------------------------------------
+
+type Real struct {
+}
+
+func (r Real) Now() time.Time {
+	return time.Now()
+}
+
+func (r Real) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (r Real) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (r Real) NewTimer(d time.Duration) Timer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t realTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+// ----------------------------------------------------------------------------
+
+// Fake only moves forward when it is told to. Sleep advances the clock by the
+// given duration right away, so that code that sleeps in a loop can be tested
+// without actually waiting. Timers and channels returned by After fire as soon
+// as the clock has been advanced past their deadline.
+type Fake struct {
+	mutex  *sync.Mutex
+	now    *time.Time
+	timers *[]*fakeTimer
+}
+
+func NewFake(now time.Time) Fake {
+	return Fake{
+		mutex:  &sync.Mutex{},
+		now:    &now,
+		timers: &[]*fakeTimer{},
+	}
+}
+
+func (f Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return *f.now
+}
+
+func (f Fake) Sleep(d time.Duration) {
+	f.Advance(d)
+}
+
+func (f Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f Fake) NewTimer(d time.Duration) Timer {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	timer := &fakeTimer{
+		clock:    f,
+		channel:  make(chan time.Time, 1),
+		deadline: f.now.Add(d),
+		active:   true,
+	}
+	*f.timers = append(*f.timers, timer)
+	f.fireTimers()
+
+	return timer
+}
+
+func (f Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	*f.now = f.now.Add(d)
+	f.fireTimers()
+}
+
+func (f Fake) Set(moment time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	*f.now = moment
+	f.fireTimers()
+}
+
+// fireTimers must be called while holding the mutex
+func (f Fake) fireTimers() {
+	sort.SliceStable(*f.timers, func(i, j int) bool {
+		return (*f.timers)[i].deadline.Before((*f.timers)[j].deadline)
+	})
+
+	var pending []*fakeTimer
+	for _, timer := range *f.timers {
+		if !timer.active {
+			continue
+		}
+		if timer.deadline.After(*f.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.active = false
+		timer.channel <- *f.now
+	}
+	*f.timers = pending
+}
+
+type fakeTimer struct {
+	clock    Fake
+	channel  chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.channel
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+
+	wasActive := t.active
+	t.active = true
+	t.deadline = t.clock.now.Add(d)
+	if !wasActive {
+		*t.clock.timers = append(*t.clock.timers, t)
+	}
+	t.clock.fireTimers()
+
+	return wasActive
+}
@@ -0,0 +1,74 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake_Sleep(t *testing.T) {
+	// > Arrange
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFake(start)
+
+	// > Act
+	clock.Sleep(15 * time.Second)
+
+	// > Assert
+	if !clock.Now().Equal(start.Add(15 * time.Second)) {
+		t.Errorf("Expected clock to be advanced by 15 seconds, got %v", clock.Now())
+	}
+}
+
+func TestFake_After(t *testing.T) {
+	// > Arrange
+	clock := NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	channel := clock.After(time.Minute)
+
+	// > Act
+	clock.Advance(59 * time.Second)
+	fired := len(channel) > 0
+	clock.Advance(time.Second)
+
+	// > Assert
+	if fired {
+		t.Errorf("Channel fired before its deadline")
+	}
+	if len(channel) != 1 {
+		t.Errorf("Channel did not fire after its deadline")
+	}
+}
+
+func TestFake_NewTimer(t *testing.T) {
+	t.Run("Stopped timer does not fire", func(t *testing.T) {
+		// > Arrange
+		clock := NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		timer := clock.NewTimer(time.Minute)
+
+		// > Act
+		wasActive := timer.Stop()
+		clock.Advance(time.Hour)
+
+		// > Assert
+		if !wasActive || len(timer.C()) != 0 {
+			t.Errorf("Stopped timer should not fire")
+		}
+	})
+
+	t.Run("Reset timer fires after its new deadline", func(t *testing.T) {
+		// > Arrange
+		clock := NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		timer := clock.NewTimer(time.Minute)
+
+		// > Act
+		clock.Advance(30 * time.Second)
+		timer.Reset(time.Minute)
+		clock.Advance(45 * time.Second)
+		firedEarly := len(timer.C()) > 0
+		clock.Advance(15 * time.Second)
+
+		// > Assert
+		if firedEarly || len(timer.C()) != 1 {
+			t.Errorf("Reset timer should fire exactly one minute after being reset")
+		}
+	})
+}
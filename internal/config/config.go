@@ -0,0 +1,242 @@
+// Package config reads and writes the config file, which contains one or more
+// named profiles, e.g. for different Last.fm accounts.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const DefaultProfile = "default"
+
+var profileNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+type Config struct {
+	DefaultProfile string             `json:"defaultProfile,omitempty"`
+	Profiles       map[string]Profile `json:"profiles,omitempty"`
+}
+
+type Profile struct {
+	Account  Account         `json:"account"`
+	Stations []string        `json:"stations,omitempty"`
+	Filters  json.RawMessage `json:"filters,omitempty"`
+	Schedule Schedule        `json:"schedule"`
+	Polling  Polling         `json:"polling"`
+	Timezone string          `json:"timezone,omitempty"`
+}
+
+// Account only contains the API key, because secrets are kept in the
+// credential store
+type Account struct {
+	ApiKey string `json:"apiKey,omitempty"`
+}
+
+// Schedule contains the default values for --from and --until
+type Schedule struct {
+	From  string `json:"from,omitempty"`
+	Until string `json:"until,omitempty"`
+}
+
+// Polling.Interval is a duration such as "15s"
+type Polling struct {
+	Interval string `json:"interval,omitempty"`
+	Adaptive bool   `json:"adaptive,omitempty"`
+}
+
+// GetInterval returns zero if no valid interval has been set
+func (p Polling) GetInterval() time.Duration {
+	interval, _ := time.ParseDuration(p.Interval)
+	return interval
+}
+
+// GetPath returns $NPOLEON_CONFIG, or config.json in the XDG config directory
+func GetPath() (string, error) {
+	if path := os.Getenv("NPOLEON_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "npoleon", "config.json"), nil
+}
+
+// Load returns an empty config if the file does not exist
+func Load(path string) (Config, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Parse(path, contents)
+}
+
+// Parse reports the first problem in the config, see Validate to get all of
+// them
+func Parse(path string, contents []byte) (Config, error) {
+	config, problems := parse(path, contents)
+	if len(problems) > 0 {
+		return Config{}, problems[0]
+	}
+	return config, nil
+}
+
+// Validate returns all problems in the config, ordered by line
+func Validate(path string, contents []byte) []error {
+	_, problems := parse(path, contents)
+	return problems
+}
+
+func parse(path string, contents []byte) (Config, []error) {
+	lines := newLineIndex(contents)
+
+	var config Config
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, []error{lines.explain(path, err)}
+	}
+
+	var problems []*Problem
+	for _, problem := range config.validate() {
+		problem.File = path
+		problem.Line = lines.find(problem.Key)
+		problems = append(problems, problem)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	var errs []error
+	for _, problem := range problems {
+		errs = append(errs, problem)
+	}
+	return config, errs
+}
+
+// Save validates the config before writing it, and replaces the file at once
+// so that it is never left half-written
+func Save(path string, config Config) error {
+	contents, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	contents = append(contents, '\n')
+
+	if _, err = Parse(path, contents); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SelectProfile picks the profile with the given name, the one named in
+// $NPOLEON_PROFILE, or the default profile, in that order
+func (c Config) SelectProfile(name string) (string, Profile, error) {
+	if name == "" {
+		name = os.Getenv("NPOLEON_PROFILE")
+	}
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	profile, exists := c.Profiles[name]
+	if !exists && name != DefaultProfile {
+		return "", Profile{}, fmt.Errorf(`profile "%s" does not exist`, name)
+	}
+	return name, profile, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Problem describes an invalid value in the config file
+type Problem struct {
+	File    string
+	Line    int
+	Key     string
+	Message string
+}
+
+func (p *Problem) Error() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", p.File, p.Line, p.Key, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.File, p.Key, p.Message)
+}
+
+func (c Config) validate() []*Problem {
+	var problems []*Problem
+
+	if c.DefaultProfile != "" && c.DefaultProfile != DefaultProfile {
+		if _, exists := c.Profiles[c.DefaultProfile]; !exists {
+			problems = append(problems, &Problem{
+				Key:     "defaultProfile",
+				Message: fmt.Sprintf(`profile "%s" does not exist`, c.DefaultProfile),
+			})
+		}
+	}
+
+	for name, profile := range c.Profiles {
+		prefix := "profiles." + name
+		if !profileNameRe.MatchString(name) {
+			problems = append(problems, &Problem{
+				Key:     prefix,
+				Message: "profile names may only contain lowercase letters, digits, - and _",
+			})
+		}
+
+		for _, problem := range profile.validate() {
+			problem.Key = prefix + "." + problem.Key
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+func (p Profile) validate() []*Problem {
+	var problems []*Problem
+	for _, setting := range settings {
+		if err := setting.validate(p); err != nil {
+			problems = append(problems, &Problem{Key: setting.key, Message: err.Error()})
+		}
+	}
+	return problems
+}
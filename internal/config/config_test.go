@@ -0,0 +1,191 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// > Arrange
+	contents := []byte(`{
+  "defaultProfile": "home",
+  "profiles": {
+    "home": {
+      "account": {"apiKey": "0123456789abcdef0123456789abcdef"},
+      "stations": ["radio2", "3fm"],
+      "polling": {"interval": "30s", "adaptive": true}
+    }
+  }
+}`)
+
+	// > Act
+	config, err := Parse("config.json", contents)
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Parsing failed: %v", err)
+	}
+	name, profile, _ := config.SelectProfile("")
+	if name != "home" || profile.Stations[1] != "3fm" || profile.Polling.GetInterval() != 30*time.Second {
+		t.Errorf("Expected profile home with stations and interval, got %v: %+v", name, profile)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected []string
+	}{
+		{
+			"Invalid values are reported with their line",
+			`{
+  "profiles": {
+    "home": {
+      "stations": ["radio2", "radio9"],
+      "polling": {
+        "interval": "fast"
+      }
+    }
+  }
+}`,
+			[]string{
+				"config.json:4: profiles.home.stations: invalid station 'radio9'",
+				`config.json:6: profiles.home.polling.interval: invalid duration "fast"`,
+			},
+		},
+		{
+			"Unknown settings are reported",
+			`{
+  "profiles": {
+    "home": {
+      "polling": {"intervl": "15s"}
+    }
+  }
+}`,
+			[]string{"config.json:4: profiles.home.polling.intervl: unknown setting"},
+		},
+		{
+			"Values of the wrong type are reported",
+			`{
+  "profiles": {
+    "home": {
+      "polling": {"adaptive": "yes"}
+    }
+  }
+}`,
+			[]string{"config.json:4: profiles.home.polling.adaptive: expected bool, got string"},
+		},
+		{
+			"Syntax errors are reported",
+			`{
+  "profiles": {
+    "home": {,
+  }
+}`,
+			[]string{"config.json:3: invalid character ','"},
+		},
+		{
+			"Default profile must exist",
+			`{
+  "defaultProfile": "work"
+}`,
+			[]string{`config.json:2: defaultProfile: profile "work" does not exist`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// > Act
+			problems := Validate("config.json", []byte(test.contents))
+
+			// > Assert
+			if len(problems) != len(test.expected) {
+				t.Fatalf("Expected %v problems, got %v", len(test.expected), problems)
+			}
+			for idx, problem := range problems {
+				if !strings.HasPrefix(problem.Error(), test.expected[idx]) {
+					t.Errorf("Expected '%v', got '%v'", test.expected[idx], problem.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	t.Run("Config is written with restricted permissions", func(t *testing.T) {
+		// > Arrange
+		path := filepath.Join(t.TempDir(), "npoleon", "config.json")
+		var config Config
+		_ = config.Set("home", "stations", "radio2")
+
+		// > Act
+		err := Save(path, config)
+
+		// > Assert
+		if err != nil {
+			t.Fatalf("Saving failed: %v", err)
+		}
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+		}
+		loaded, _ := Load(path)
+		if loaded.Profiles["home"].Stations[0] != "radio2" {
+			t.Errorf("Expected saved config to be loaded, got %+v", loaded)
+		}
+	})
+
+	t.Run("Invalid config is not written", func(t *testing.T) {
+		// > Arrange
+		path := filepath.Join(t.TempDir(), "config.json")
+		config := Config{Profiles: map[string]Profile{"Home Sweet Home": {}}}
+
+		// > Act
+		err := Save(path, config)
+
+		// > Assert
+		if err == nil {
+			t.Errorf("Expected invalid profile name to be refused")
+		}
+		if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+			t.Errorf("Expected no config file to be written")
+		}
+	})
+}
+
+func TestConfig_SelectProfile(t *testing.T) {
+	config := Config{Profiles: map[string]Profile{
+		"home": {Stations: []string{"radio2"}},
+		"work": {Stations: []string{"3fm"}},
+	}}
+
+	t.Run("Flag takes precedence over environment", func(t *testing.T) {
+		t.Setenv("NPOLEON_PROFILE", "home")
+
+		name, _, err := config.SelectProfile("work")
+
+		if err != nil || name != "work" {
+			t.Errorf("Expected work, got %v (%v)", name, err)
+		}
+	})
+
+	t.Run("Default profile does not have to be defined", func(t *testing.T) {
+		name, profile, err := config.SelectProfile("")
+
+		if err != nil || name != DefaultProfile || len(profile.Stations) != 0 {
+			t.Errorf("Expected empty default profile, got %v (%v)", name, err)
+		}
+	})
+
+	t.Run("Unknown profiles are refused", func(t *testing.T) {
+		_, _, err := config.SelectProfile("holiday")
+
+		if err == nil {
+			t.Errorf("Expected error for unknown profile")
+		}
+	})
+}
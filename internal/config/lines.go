@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lineIndex finds the lines on which keys appear in a JSON document, so that
+// problems can be reported with line numbers
+type lineIndex struct {
+	contents []byte
+	keys     map[string]int
+}
+
+type frame struct {
+	object    bool
+	path      string
+	key       string
+	expectKey bool
+	index     int
+}
+
+func newLineIndex(contents []byte) lineIndex {
+	idx := lineIndex{contents: contents, keys: make(map[string]int)}
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+
+	var stack []*frame
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		if key, isString := token.(string); isString && top != nil && top.object && top.expectKey {
+			top.key = join(top.path, key)
+			top.expectKey = false
+			idx.keys[top.key] = idx.lineAt(offset)
+			continue
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			stack = append(stack, &frame{
+				object:    token == json.Delim('{'),
+				path:      valuePath(top),
+				expectKey: true,
+			})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				valueDone(stack[len(stack)-1])
+			}
+		default:
+			valueDone(top)
+		}
+	}
+	return idx
+}
+
+func valuePath(parent *frame) string {
+	if parent == nil {
+		return ""
+	}
+	if parent.object {
+		return parent.key
+	}
+	return join(parent.path, strconv.Itoa(parent.index))
+}
+
+func valueDone(parent *frame) {
+	if parent == nil {
+		return
+	}
+	if parent.object {
+		parent.expectKey = true
+	} else {
+		parent.index++
+	}
+}
+
+func join(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// lineAt skips the separators before the token that starts at offset
+func (idx lineIndex) lineAt(offset int64) int {
+	pos := int(offset)
+	for pos < len(idx.contents) && strings.ContainsRune(" \t\r\n,:", rune(idx.contents[pos])) {
+		pos++
+	}
+	return bytes.Count(idx.contents[:min(pos, len(idx.contents))], []byte("\n")) + 1
+}
+
+// find returns the line of a key, or of its closest parent that exists
+func (idx lineIndex) find(key string) int {
+	for key != "" {
+		if line, exists := idx.keys[key]; exists {
+			return line
+		}
+		cut := strings.LastIndex(key, ".")
+		if cut < 0 {
+			break
+		}
+		key = key[:cut]
+	}
+	return 0
+}
+
+var unknownFieldRe = regexp.MustCompile(`unknown field "([^"]+)"`)
+
+// explain adds the line number to errors from the JSON decoder
+func (idx lineIndex) explain(path string, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line := bytes.Count(idx.contents[:min(int(syntaxErr.Offset), len(idx.contents))], []byte("\n")) + 1
+		return fmt.Errorf("%s:%d: %s", path, line, syntaxErr.Error())
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &Problem{
+			File:    path,
+			Line:    idx.find(typeErr.Field),
+			Key:     typeErr.Field,
+			Message: fmt.Sprintf("expected %s, got %s", typeErr.Type.String(), typeErr.Value),
+		}
+	}
+
+	if matches := unknownFieldRe.FindStringSubmatch(err.Error()); matches != nil {
+		problem := &Problem{File: path, Key: matches[1], Message: "unknown setting"}
+		for key, line := range idx.keys {
+			isMatch := key == matches[1] || strings.HasSuffix(key, "."+matches[1])
+			if isMatch && (problem.Line == 0 || line < problem.Line) {
+				problem.Key = key
+				problem.Line = line
+			}
+		}
+		return problem
+	}
+
+	return fmt.Errorf("%s: %w", path, err)
+}
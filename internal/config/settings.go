@@ -0,0 +1,244 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"npoleon/internal/filtering"
+	"npoleon/internal/nporadio"
+	"npoleon/internal/util"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var apiKeyRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// setting describes a value in a profile that can be read and changed with
+// `npoleon config` and overridden with an environment variable
+type setting struct {
+	key      string
+	get      func(p Profile) string
+	set      func(p *Profile, value string) error
+	validate func(p Profile) error
+}
+
+var settings = []setting{
+	{
+		key: "account.apiKey",
+		get: func(p Profile) string { return p.Account.ApiKey },
+		set: func(p *Profile, value string) error {
+			p.Account.ApiKey = value
+			return nil
+		},
+		validate: func(p Profile) error {
+			if p.Account.ApiKey != "" && !apiKeyRe.MatchString(p.Account.ApiKey) {
+				return errors.New("API keys consist of 32 hexadecimal characters")
+			}
+			return nil
+		},
+	},
+	{
+		key: "stations",
+		get: func(p Profile) string { return strings.Join(p.Stations, ",") },
+		set: func(p *Profile, value string) error {
+			p.Stations = nil
+			for _, station := range strings.Split(value, ",") {
+				if station = strings.TrimSpace(station); station != "" {
+					p.Stations = append(p.Stations, station)
+				}
+			}
+			return nil
+		},
+		validate: func(p Profile) error {
+			for _, station := range p.Stations {
+				if _, err := nporadio.GetStationId(station); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		key: "filters",
+		get: func(p Profile) string { return string(p.Filters) },
+		set: func(p *Profile, value string) error {
+			if !json.Valid([]byte(value)) {
+				return errors.New("filters must be written as JSON")
+			}
+			p.Filters = json.RawMessage(value)
+			return nil
+		},
+		validate: func(p Profile) error {
+			if len(p.Filters) == 0 {
+				return nil
+			}
+			_, err := filtering.ParseFilter(p.Filters)
+			return err
+		},
+	},
+	{
+		key: "schedule.from",
+		get: func(p Profile) string { return p.Schedule.From },
+		set: func(p *Profile, value string) error {
+			p.Schedule.From = value
+			return nil
+		},
+		validate: func(p Profile) error { return validateTime(p.Schedule.From) },
+	},
+	{
+		key: "schedule.until",
+		get: func(p Profile) string { return p.Schedule.Until },
+		set: func(p *Profile, value string) error {
+			p.Schedule.Until = value
+			return nil
+		},
+		validate: func(p Profile) error { return validateTime(p.Schedule.Until) },
+	},
+	{
+		key: "polling.interval",
+		get: func(p Profile) string { return p.Polling.Interval },
+		set: func(p *Profile, value string) error {
+			p.Polling.Interval = value
+			return nil
+		},
+		validate: func(p Profile) error {
+			if p.Polling.Interval == "" {
+				return nil
+			}
+			interval, err := time.ParseDuration(p.Polling.Interval)
+			if err != nil {
+				return fmt.Errorf(`invalid duration "%s", use e.g. "15s" or "1m"`, p.Polling.Interval)
+			}
+			if interval < time.Second {
+				return errors.New("the interval must be at least 1s")
+			}
+			return nil
+		},
+	},
+	{
+		key: "polling.adaptive",
+		get: func(p Profile) string { return strconv.FormatBool(p.Polling.Adaptive) },
+		set: func(p *Profile, value string) error {
+			adaptive, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf(`invalid value "%s", use "true" or "false"`, value)
+			}
+			p.Polling.Adaptive = adaptive
+			return nil
+		},
+		validate: func(p Profile) error { return nil },
+	},
+	{
+		key: "timezone",
+		get: func(p Profile) string { return p.Timezone },
+		set: func(p *Profile, value string) error {
+			p.Timezone = value
+			return nil
+		},
+		validate: func(p Profile) error {
+			if p.Timezone == "" {
+				return nil
+			}
+			_, err := util.LoadLocation(p.Timezone)
+			return err
+		},
+	},
+}
+
+func validateTime(value string) error {
+	if value == "" {
+		return nil
+	}
+	_, err := util.ParseTime(value)
+	return err
+}
+
+func findSetting(key string) (setting, error) {
+	for _, setting := range settings {
+		if strings.EqualFold(setting.key, key) {
+			return setting, nil
+		}
+	}
+	return setting{}, fmt.Errorf(`unknown setting "%s", use one of: %s`, key, strings.Join(Keys(), ", "))
+}
+
+func Keys() []string {
+	var keys []string
+	for _, setting := range settings {
+		keys = append(keys, setting.key)
+	}
+	return keys
+}
+
+func (p Profile) Get(key string) (string, error) {
+	setting, err := findSetting(key)
+	if err != nil {
+		return "", err
+	}
+	return setting.get(p), nil
+}
+
+// Set changes a setting and checks whether its new value is valid
+func (p *Profile) Set(key string, value string) error {
+	setting, err := findSetting(key)
+	if err != nil {
+		return err
+	}
+	if err = setting.set(p, value); err != nil {
+		return err
+	}
+	return setting.validate(*p)
+}
+
+func (c *Config) Set(profile string, key string, value string) error {
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]Profile)
+	}
+
+	p := c.Profiles[profile]
+	if err := p.Set(key, value); err != nil {
+		return err
+	}
+	c.Profiles[profile] = p
+	return nil
+}
+
+// EnvName returns the environment variable that overrides a setting, e.g.
+// NPOLEON_POLLING_INTERVAL for polling.interval
+func EnvName(key string) string {
+	var name strings.Builder
+	name.WriteString("NPOLEON_")
+	for idx, r := range key {
+		switch {
+		case r == '.':
+			name.WriteRune('_')
+		case unicode.IsUpper(r) && idx > 0:
+			name.WriteRune('_')
+			name.WriteRune(r)
+		default:
+			name.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return name.String()
+}
+
+// ApplyEnv overrides settings with environment variables
+func (p Profile) ApplyEnv() (Profile, error) {
+	for _, setting := range settings {
+		value, exists := os.LookupEnv(EnvName(setting.key))
+		if !exists {
+			continue
+		}
+		if err := setting.set(&p, value); err != nil {
+			return Profile{}, fmt.Errorf("%s: %w", EnvName(setting.key), err)
+		}
+		if err := setting.validate(p); err != nil {
+			return Profile{}, fmt.Errorf("%s: %w", EnvName(setting.key), err)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"account.apiKey":   "NPOLEON_ACCOUNT_API_KEY",
+		"stations":         "NPOLEON_STATIONS",
+		"polling.interval": "NPOLEON_POLLING_INTERVAL",
+		"timezone":         "NPOLEON_TIMEZONE",
+	}
+
+	for key, expected := range tests {
+		if res := EnvName(key); res != expected {
+			t.Errorf("Expected %v for %v, got %v", expected, key, res)
+		}
+	}
+}
+
+func TestProfile_ApplyEnv(t *testing.T) {
+	t.Run("Environment overrides settings", func(t *testing.T) {
+		// > Arrange
+		t.Setenv("NPOLEON_POLLING_INTERVAL", "1m")
+		t.Setenv("NPOLEON_STATIONS", "3fm, radio1")
+		profile := Profile{Polling: Polling{Interval: "15s"}}
+
+		// > Act
+		res, err := profile.ApplyEnv()
+
+		// > Assert
+		if err != nil || res.Polling.GetInterval() != time.Minute || res.Stations[1] != "radio1" {
+			t.Errorf("Expected overridden settings, got %+v (%v)", res, err)
+		}
+	})
+
+	t.Run("Invalid overrides are reported", func(t *testing.T) {
+		// > Arrange
+		t.Setenv("NPOLEON_POLLING_ADAPTIVE", "sometimes")
+
+		// > Act
+		_, err := Profile{}.ApplyEnv()
+
+		// > Assert
+		if err == nil {
+			t.Errorf("Expected error for invalid override")
+		}
+	})
+}
+
+func TestProfile_Set(t *testing.T) {
+	// > Arrange
+	var profile Profile
+
+	// > Act
+	err := profile.Set("filters", `{"exclude": [{"title": "(?i)jingle"}]}`)
+	invalidErr := profile.Set("schedule.from", "the day after tomorrow")
+	unknownErr := profile.Set("volume", "11")
+	timezoneErr := profile.Set("timezone", "Mars/Olympus_Mons")
+
+	// > Assert
+	if err != nil {
+		t.Errorf("Expected filters to be set, got %v", err)
+	}
+	if invalidErr == nil || unknownErr == nil {
+		t.Errorf("Expected errors for invalid time and unknown setting, got %v and %v", invalidErr, unknownErr)
+	}
+	if timezoneErr == nil {
+		t.Errorf("Expected error for unknown time zone")
+	}
+}
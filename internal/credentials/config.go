@@ -0,0 +1,119 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"github.com/joho/godotenv"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigFile stores credentials in plain text in the config file, as older
+// versions did. The file is only readable by its owner.
+type ConfigFile struct {
+	path string
+}
+
+func CreateConfigFile(path string) ConfigFile {
+	return ConfigFile{path: path}
+}
+
+func (c ConfigFile) Describe() string {
+	return "config file " + c.path
+}
+
+func (c ConfigFile) Get(name string) (string, error) {
+	values, err := godotenv.Read(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	value, exists := values[name]
+	if !exists {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Set replaces an existing line for the credential, so that logging in again
+// does not add another one
+func (c ConfigFile) Set(name string, value string) error {
+	lines, err := c.readLines()
+	if err != nil {
+		return err
+	}
+
+	entry := fmt.Sprintf("%s=%s", name, value)
+	var result []string
+	replaced := false
+	for _, line := range lines {
+		if !isEntryFor(line, name) {
+			result = append(result, line)
+		} else if !replaced {
+			result = append(result, entry)
+			replaced = true
+		}
+	}
+	if !replaced {
+		result = append(result, entry)
+	}
+
+	return c.writeLines(result)
+}
+
+func (c ConfigFile) Delete(name string) error {
+	lines, err := c.readLines()
+	if err != nil {
+		return err
+	}
+
+	var kept []string
+	for _, line := range lines {
+		if !isEntryFor(line, name) {
+			kept = append(kept, line)
+		}
+	}
+	return c.writeLines(kept)
+}
+
+func (c ConfigFile) readLines() ([]string, error) {
+	contents, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	text := strings.TrimRight(string(contents), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+func (c ConfigFile) writeLines(lines []string) error {
+	contents := ""
+	if len(lines) > 0 {
+		contents = strings.Join(lines, "\n") + "\n"
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.path, []byte(contents), 0600); err != nil {
+		return err
+	}
+	// WriteFile does not change the permissions of existing files
+	return os.Chmod(c.path, 0600)
+}
+
+func isEntryFor(line string, name string) bool {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "export ")
+	key, _, found := strings.Cut(line, "=")
+	return found && strings.TrimSpace(key) == name
+}
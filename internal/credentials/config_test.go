@@ -0,0 +1,45 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigFile(t *testing.T) {
+	t.Run("Setting a credential replaces existing lines", func(t *testing.T) {
+		// > Arrange
+		path := filepath.Join(t.TempDir(), "config")
+		_ = os.WriteFile(path, []byte("LASTFM_API_KEY=key\nLASTFM_SESSION_KEY=old\nLASTFM_SESSION_KEY=older\n"), 0644)
+		store := CreateConfigFile(path)
+
+		// > Act
+		err := store.Set(SessionKey, "new")
+
+		// > Assert
+		contents, _ := os.ReadFile(path)
+		if err != nil || string(contents) != "LASTFM_API_KEY=key\nLASTFM_SESSION_KEY=new\n" {
+			t.Errorf("Expected single session key, got '%v' (%v)", string(contents), err)
+		}
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected config to have mode 0600, got %v", info.Mode().Perm())
+		}
+	})
+
+	t.Run("Deleting a credential keeps other settings", func(t *testing.T) {
+		// > Arrange
+		path := filepath.Join(t.TempDir(), "config")
+		_ = os.WriteFile(path, []byte("LASTFM_API_KEY=key\n\nLASTFM_API_SECRET=secret\n"), 0600)
+		store := CreateConfigFile(path)
+
+		// > Act
+		err := store.Delete(ApiSecret)
+
+		// > Assert
+		contents, _ := os.ReadFile(path)
+		if err != nil || string(contents) != "LASTFM_API_KEY=key\n\n" {
+			t.Errorf("Expected only secret to be removed, got '%v' (%v)", string(contents), err)
+		}
+	})
+}
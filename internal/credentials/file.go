@@ -0,0 +1,260 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"filippo.io/age"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// scryptWorkFactor is age's default, which takes about a second to derive the
+// key from a passphrase
+var scryptWorkFactor = 18
+
+// EncryptedFile stores credentials in a file that is encrypted with age
+// (https://age-encryption.org), so that it can also be decrypted with the age
+// command line tool. The credentials are kept in memory once they have been
+// decrypted, until the file changes.
+type EncryptedFile struct {
+	path        string
+	description string
+	keys        func(create bool) (age.Identity, age.Recipient, error)
+	cache       *decryptedFile
+}
+
+// decryptedFile is the contents of the file as it was when it was last read
+// or written
+type decryptedFile struct {
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	values  map[string]string
+}
+
+func CreatePassphraseFile(path string, passphrase string) EncryptedFile {
+	return EncryptedFile{
+		path:        path,
+		description: "file " + path + " (protected by NPOLEON_PASSPHRASE)",
+		keys: func(create bool) (age.Identity, age.Recipient, error) {
+			identity, err := age.NewScryptIdentity(passphrase)
+			if err != nil {
+				return nil, nil, err
+			}
+			recipient, err := age.NewScryptRecipient(passphrase)
+			if err != nil {
+				return nil, nil, err
+			}
+			recipient.SetWorkFactor(scryptWorkFactor)
+			return identity, recipient, nil
+		},
+		cache: &decryptedFile{},
+	}
+}
+
+// CreateKeyFile uses an age identity, which is generated when the first
+// credential is stored if the key file doesn't exist. A key created with
+// age-keygen can be used as well. This only protects the credentials if the
+// key file is kept away from them, and from backups of them.
+func CreateKeyFile(path string, keyPath string) EncryptedFile {
+	return EncryptedFile{
+		path:        path,
+		description: "file " + path + " (protected by " + keyPath + ")",
+		keys: func(create bool) (age.Identity, age.Recipient, error) {
+			contents, err := os.ReadFile(keyPath)
+			if errors.Is(err, os.ErrNotExist) && create {
+				return createKey(keyPath)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+
+			identities, err := age.ParseIdentities(bytes.NewReader(contents))
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid key in %s: %w", keyPath, err)
+			}
+			identity, isX25519 := identities[0].(*age.X25519Identity)
+			if len(identities) != 1 || !isX25519 {
+				return nil, nil, fmt.Errorf("%s must contain a single age identity", keyPath)
+			}
+			return identity, identity.Recipient(), nil
+		},
+		cache: &decryptedFile{},
+	}
+}
+
+func createKey(keyPath string) (age.Identity, age.Recipient, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contents := fmt.Sprintf(
+		"# created: %s\n# public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339),
+		identity.Recipient(),
+		identity,
+	)
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(keyPath, []byte(contents), 0600); err != nil {
+		return nil, nil, err
+	}
+	return identity, identity.Recipient(), nil
+}
+
+func (f EncryptedFile) Describe() string {
+	return f.description
+}
+
+func (f EncryptedFile) Get(name string) (string, error) {
+	f.cache.mutex.Lock()
+	defer f.cache.mutex.Unlock()
+
+	values, err := f.read()
+	if err != nil {
+		return "", err
+	}
+
+	value, exists := values[name]
+	if !exists {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (f EncryptedFile) Set(name string, value string) error {
+	f.cache.mutex.Lock()
+	defer f.cache.mutex.Unlock()
+
+	values, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	values[name] = value
+	return f.write(values)
+}
+
+func (f EncryptedFile) Delete(name string) error {
+	f.cache.mutex.Lock()
+	defer f.cache.mutex.Unlock()
+
+	values, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, exists := values[name]; !exists {
+		return nil
+	}
+
+	delete(values, name)
+	return f.write(values)
+}
+
+// read returns an empty map if the file does not exist yet. The file is only
+// decrypted again if it has changed since it was last read or written.
+func (f EncryptedFile) read() (map[string]string, error) {
+	values := make(map[string]string)
+
+	info, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if f.cache.values == nil || !info.ModTime().Equal(f.cache.modTime) || info.Size() != f.cache.size {
+		decrypted, err := f.decrypt()
+		if err != nil {
+			return nil, err
+		}
+		f.remember(info, decrypted)
+	}
+
+	for name, value := range f.cache.values {
+		values[name] = value
+	}
+	return values, nil
+}
+
+func (f EncryptedFile) decrypt() (map[string]string, error) {
+	identity, _, err := f.keys(false)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := age.Decrypt(file, identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s, is the passphrase or key correct?", f.path)
+	}
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", f.path, err)
+	}
+
+	values := make(map[string]string)
+	if err = json.Unmarshal(plain, &values); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", f.path, err)
+	}
+	return values, nil
+}
+
+func (f EncryptedFile) write(values map[string]string) error {
+	_, recipient, err := f.keys(true)
+	if err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	var encrypted bytes.Buffer
+	writer, err := age.Encrypt(&encrypted, recipient)
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(plain); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	if err = os.WriteFile(f.path, encrypted.Bytes(), 0600); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.path, 0600); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	f.remember(info, values)
+	return nil
+}
+
+func (f EncryptedFile) remember(info os.FileInfo, values map[string]string) {
+	f.cache.modTime = info.ModTime()
+	f.cache.size = info.Size()
+	f.cache.values = values
+}
@@ -0,0 +1,91 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedFile(t *testing.T) {
+	// Quicker than the default, which takes about a second
+	defer func(workFactor int) { scryptWorkFactor = workFactor }(scryptWorkFactor)
+	scryptWorkFactor = 10
+
+	t.Run("Credentials are stored encrypted with a generated key", func(t *testing.T) {
+		// > Arrange
+		dir := t.TempDir()
+		store := CreateKeyFile(filepath.Join(dir, "credentials"), filepath.Join(dir, "credentials.key"))
+
+		// > Act
+		err := store.Set(SessionKey, "d4ftpunk")
+		value, getErr := store.Get(SessionKey)
+
+		// > Assert
+		if err != nil || getErr != nil || value != "d4ftpunk" {
+			t.Fatalf("Expected stored session key, got '%v' (%v, %v)", value, err, getErr)
+		}
+		contents, _ := os.ReadFile(filepath.Join(dir, "credentials"))
+		if strings.Contains(string(contents), "d4ftpunk") || !strings.HasPrefix(string(contents), "age-encryption.org/v1") {
+			t.Errorf("Expected credentials file to be encrypted with age")
+		}
+		for _, file := range []string{"credentials", "credentials.key"} {
+			info, _ := os.Stat(filepath.Join(dir, file))
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("Expected %v to have mode 0600, got %v", file, info.Mode().Perm())
+			}
+		}
+	})
+
+	t.Run("Missing credentials are reported", func(t *testing.T) {
+		// > Arrange
+		dir := t.TempDir()
+		store := CreateKeyFile(filepath.Join(dir, "credentials"), filepath.Join(dir, "credentials.key"))
+
+		// > Act
+		_, err := store.Get(ApiSecret)
+
+		// > Assert
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Credentials cannot be read with another passphrase", func(t *testing.T) {
+		// > Arrange
+		path := filepath.Join(t.TempDir(), "credentials")
+		_ = CreatePassphraseFile(path, "correct horse").Set(ApiSecret, "s3cr3t")
+
+		// > Act
+		value, err := CreatePassphraseFile(path, "battery staple").Get(ApiSecret)
+
+		// > Assert
+		if err == nil || value != "" {
+			t.Errorf("Expected decryption to fail, got '%v'", value)
+		}
+	})
+
+	t.Run("Credentials are only decrypted again when the file changes", func(t *testing.T) {
+		// > Arrange
+		dir := t.TempDir()
+		path := filepath.Join(dir, "credentials")
+		keyPath := filepath.Join(dir, "credentials.key")
+		store := CreateKeyFile(path, keyPath)
+		_ = store.Set(SessionKey, "d4ftpunk")
+		_ = os.Remove(keyPath)
+
+		// > Act
+		cached, cachedErr := store.Get(SessionKey)
+		_ = os.WriteFile(path, []byte("changed by someone else"), 0600)
+		_, changedErr := store.Get(SessionKey)
+
+		// > Assert
+		if cachedErr != nil || cached != "d4ftpunk" {
+			t.Errorf("Expected the session key without reading the key again, got '%v' (%v)", cached, cachedErr)
+		}
+		if changedErr == nil {
+			t.Errorf("Expected the changed file to be decrypted again, and fail without the key")
+		}
+	})
+}
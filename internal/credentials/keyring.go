@@ -0,0 +1,132 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const keyringService = "npoleon"
+
+// Keyring stores credentials in the Secret Service on Linux or the Keychain on
+// macOS, through the command-line tools that come with them. Credentials of
+// profiles other than the default one are stored under the profile's name.
+type Keyring struct {
+	Profile string
+}
+
+func (k Keyring) account(name string) string {
+	if k.Profile == "" {
+		return name
+	}
+	return k.Profile + "/" + name
+}
+
+var lookPath = exec.LookPath
+
+var goos = runtime.GOOS
+
+// runCommand runs a command with the given input and returns its output. It
+// returns ErrNotFound if the command exits with a non-zero status.
+var runCommand = func(input string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(input)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", ErrNotFound
+	}
+	return stdout.String(), err
+}
+
+func keyringAvailable() bool {
+	switch goos {
+	case "linux", "freebsd", "openbsd":
+		_, err := lookPath("secret-tool")
+		return err == nil && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != ""
+	case "darwin":
+		_, err := lookPath("security")
+		return err == nil
+	}
+	return false
+}
+
+func (k Keyring) Describe() string {
+	if goos == "darwin" {
+		return "Keychain"
+	}
+	return "keyring"
+}
+
+func (k Keyring) Get(name string) (string, error) {
+	var out string
+	var err error
+	if goos == "darwin" {
+		out, err = runCommand("", "security", "find-generic-password", "-s", keyringService, "-a", k.account(name), "-w")
+	} else {
+		out, err = runCommand("", "secret-tool", "lookup", "service", keyringService, "account", k.account(name))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(out, "\n"), nil
+}
+
+func (k Keyring) Set(name string, value string) error {
+	var err error
+	if goos == "darwin" {
+		// The password must not be an argument, where other users can see it
+		// with ps. In interactive mode security reads the command from
+		// standard input instead.
+		command := fmt.Sprintf(
+			"add-generic-password -U -s %s -a %s -w %s\n",
+			quoteKeychainArg(keyringService),
+			quoteKeychainArg(k.account(name)),
+			quoteKeychainArg(value),
+		)
+		_, err = runCommand(command, "security", "-i")
+		if err == nil {
+			// The exit status of security -i doesn't always reflect whether
+			// the command it read succeeded
+			if stored, getErr := k.Get(name); getErr != nil || stored != value {
+				err = ErrNotFound
+			}
+		}
+	} else {
+		_, err = runCommand(value, "secret-tool", "store", "--label=npoleon "+k.account(name), "service", keyringService, "account", k.account(name))
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		return errors.New("failed to save " + name + " in the " + k.Describe())
+	}
+	return err
+}
+
+func (k Keyring) Delete(name string) error {
+	var err error
+	if goos == "darwin" {
+		_, err = runCommand("", "security", "delete-generic-password", "-s", keyringService, "-a", k.account(name))
+	} else {
+		_, err = runCommand("", "secret-tool", "clear", "service", keyringService, "account", k.account(name))
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// quoteKeychainArg quotes an argument for a command in the interactive mode of
+// security, which splits commands on whitespace like a shell
+func quoteKeychainArg(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
@@ -0,0 +1,86 @@
+package credentials
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestKeyring(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("Test covers the Secret Service")
+	}
+
+	// > Arrange
+	stored := make(map[string]string)
+	original := runCommand
+	defer func() { runCommand = original }()
+	runCommand = func(input string, name string, args ...string) (string, error) {
+		account := args[len(args)-1]
+		switch args[0] {
+		case "store":
+			stored[account] = input
+		case "lookup":
+			if value, exists := stored[account]; exists {
+				return value + "\n", nil
+			}
+			return "", ErrNotFound
+		case "clear":
+			delete(stored, account)
+		}
+		return "", nil
+	}
+	store := Keyring{}
+
+	// > Act
+	err := store.Set(SessionKey, "d4ftpunk")
+	value, getErr := store.Get(SessionKey)
+	_ = store.Delete(SessionKey)
+	_, deletedErr := store.Get(SessionKey)
+
+	// > Assert
+	if err != nil || getErr != nil || value != "d4ftpunk" {
+		t.Errorf("Expected stored session key, got '%v' (%v, %v)", value, err, getErr)
+	}
+	if deletedErr != ErrNotFound {
+		t.Errorf("Expected deleted session key to be missing, got %v", deletedErr)
+	}
+}
+
+func TestKeyring_Keychain(t *testing.T) {
+	// > Arrange
+	stored := make(map[string]string)
+	var arguments []string
+	originalCommand, originalGoos := runCommand, goos
+	defer func() { runCommand, goos = originalCommand, originalGoos }()
+	goos = "darwin"
+	runCommand = func(input string, name string, args ...string) (string, error) {
+		arguments = append(arguments, args...)
+		switch {
+		case args[0] == "-i":
+			fields := strings.Fields(input)
+			stored[strings.Trim(fields[5], `"`)] = strings.Trim(fields[7], `"`)
+		case args[0] == "find-generic-password":
+			if value, exists := stored[args[4]]; exists {
+				return value + "\n", nil
+			}
+			return "", ErrNotFound
+		}
+		return "", nil
+	}
+	store := Keyring{Profile: "work"}
+
+	// > Act
+	err := store.Set(ApiSecret, "s3cr3t")
+	value, getErr := store.Get(ApiSecret)
+
+	// > Assert
+	if err != nil || getErr != nil || value != "s3cr3t" {
+		t.Errorf("Expected stored secret, got '%v' (%v, %v)", value, err, getErr)
+	}
+	for _, argument := range arguments {
+		if strings.Contains(argument, "s3cr3t") {
+			t.Errorf("Expected secret not to be passed as an argument, got %v", arguments)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package credentials keeps the Last.fm API secret and session key out of the
+// plain text config file where possible.
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ApiKey     = "LASTFM_API_KEY"
+	ApiSecret  = "LASTFM_API_SECRET"
+	SessionKey = "LASTFM_SESSION_KEY"
+)
+
+// Secrets are moved out of the config file by Migrate. The API key is not a
+// secret, as it is sent along with every request.
+var secrets = []string{ApiSecret, SessionKey}
+
+var ErrNotFound = errors.New("credential not found")
+
+type Store interface {
+	// Get returns ErrNotFound if the credential has not been stored
+	Get(name string) (string, error)
+	Set(name string, value string) error
+	Delete(name string) error
+	// Describe returns a short description for messages to the user
+	Describe() string
+}
+
+// Open returns the store selected with NPOLEON_CREDENTIAL_STORE: "keyring",
+// "file" or "config". By default the system keyring is used if there is one,
+// then an encrypted file in the application directory if NPOLEON_PASSPHRASE or
+// NPOLEON_KEY_FILE is set, and the config file otherwise. The profile is empty
+// for the default profile.
+func Open(dir string, profile string) (Store, error) {
+	switch os.Getenv("NPOLEON_CREDENTIAL_STORE") {
+	case "keyring":
+		if !keyringAvailable() {
+			return nil, errors.New("no keyring is available on this system")
+		}
+		return Keyring{Profile: profile}, nil
+	case "file":
+		return openEncryptedFile(dir)
+	case "config":
+		return CreateConfigFile(filepath.Join(dir, "config")), nil
+	case "":
+		if keyringAvailable() {
+			return Keyring{Profile: profile}, nil
+		}
+		if os.Getenv("NPOLEON_PASSPHRASE") != "" || os.Getenv("NPOLEON_KEY_FILE") != "" {
+			return openEncryptedFile(dir)
+		}
+		return CreateConfigFile(filepath.Join(dir, "config")), nil
+	}
+
+	return nil, fmt.Errorf(
+		`invalid credential store "%s", use "keyring", "file" or "config"`,
+		os.Getenv("NPOLEON_CREDENTIAL_STORE"),
+	)
+}
+
+// openEncryptedFile protects the file with NPOLEON_PASSPHRASE, or with the key
+// in NPOLEON_KEY_FILE. A key next to the file it protects would be copied
+// along with it, so the key file has to be kept somewhere else, e.g. on a
+// removable drive.
+func openEncryptedFile(dir string) (Store, error) {
+	path := filepath.Join(dir, "credentials")
+
+	if passphrase := os.Getenv("NPOLEON_PASSPHRASE"); passphrase != "" {
+		return CreatePassphraseFile(path, passphrase), nil
+	}
+
+	keyPath := os.Getenv("NPOLEON_KEY_FILE")
+	if keyPath == "" {
+		return nil, errors.New("set NPOLEON_PASSPHRASE or NPOLEON_KEY_FILE to protect the credentials file")
+	}
+	keyPath, err := filepath.Abs(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if relative, err := filepath.Rel(absDir, keyPath); err == nil && !strings.HasPrefix(relative, "..") {
+		return nil, fmt.Errorf("NPOLEON_KEY_FILE must be outside %s, where it would be kept along with the credentials", dir)
+	}
+	return CreateKeyFile(path, keyPath), nil
+}
+
+// Lookup returns a credential from the store, or from the environment if it
+// has not been stored. This keeps config files from older versions working.
+func Lookup(store Store, name string) (string, error) {
+	value, err := store.Get(name)
+	if errors.Is(err, ErrNotFound) {
+		return os.Getenv(name), nil
+	}
+	return value, err
+}
+
+// Migrate moves secrets from one store to another, unless the other store
+// already contains them. It returns the names of the secrets that were moved.
+func Migrate(from Store, to Store) ([]string, error) {
+	if from.Describe() == to.Describe() {
+		return nil, nil
+	}
+
+	var moved []string
+	for _, name := range secrets {
+		value, err := from.Get(name)
+		if errors.Is(err, ErrNotFound) || value == "" {
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+
+		if _, err = to.Get(name); err == nil {
+			continue
+		} else if !errors.Is(err, ErrNotFound) {
+			return moved, err
+		}
+
+		if err = to.Set(name, value); err != nil {
+			return moved, err
+		}
+		if err = from.Delete(name); err != nil {
+			return moved, err
+		}
+		moved = append(moved, name)
+	}
+	return moved, nil
+}
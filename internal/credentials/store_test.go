@@ -0,0 +1,146 @@
+package credentials
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	// > Arrange
+	dir := t.TempDir()
+	_ = os.WriteFile(
+		filepath.Join(dir, "config"),
+		[]byte("LASTFM_API_KEY=key\nLASTFM_API_SECRET=secret\nLASTFM_SESSION_KEY=session\n"),
+		0644,
+	)
+	config := CreateConfigFile(filepath.Join(dir, "config"))
+	store := CreateKeyFile(filepath.Join(dir, "credentials"), filepath.Join(dir, "credentials.key"))
+
+	// > Act
+	moved, err := Migrate(config, store)
+
+	// > Assert
+	if err != nil || len(moved) != 2 {
+		t.Fatalf("Expected 2 secrets to be moved, got %v (%v)", moved, err)
+	}
+	if secret, _ := store.Get(ApiSecret); secret != "secret" {
+		t.Errorf("Expected secret in store, got '%v'", secret)
+	}
+	contents, _ := os.ReadFile(filepath.Join(dir, "config"))
+	if string(contents) != "LASTFM_API_KEY=key\n" {
+		t.Errorf("Expected secrets to be removed from config, got '%v'", string(contents))
+	}
+}
+
+func TestLookup(t *testing.T) {
+	// > Arrange
+	dir := t.TempDir()
+	store := CreateKeyFile(filepath.Join(dir, "credentials"), filepath.Join(dir, "credentials.key"))
+	_ = store.Set(SessionKey, "stored")
+	t.Setenv(SessionKey, "environment")
+	t.Setenv(ApiSecret, "environment")
+
+	// > Act
+	session, _ := Lookup(store, SessionKey)
+	secret, _ := Lookup(store, ApiSecret)
+
+	// > Assert
+	if session != "stored" || secret != "environment" {
+		t.Errorf("Expected stored session key and secret from environment, got '%v' and '%v'", session, secret)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("Passphrase protects encrypted file", func(t *testing.T) {
+		// > Arrange
+		t.Setenv("NPOLEON_CREDENTIAL_STORE", "file")
+		t.Setenv("NPOLEON_PASSPHRASE", "correct horse")
+
+		// > Act
+		store, err := Open(t.TempDir(), "")
+
+		// > Assert
+		if _, isFile := store.(EncryptedFile); err != nil || !isFile {
+			t.Errorf("Expected encrypted file, got %v (%v)", store, err)
+		}
+	})
+
+	t.Run("Encrypted file needs a passphrase or key file", func(t *testing.T) {
+		// > Arrange
+		t.Setenv("NPOLEON_CREDENTIAL_STORE", "file")
+		t.Setenv("NPOLEON_PASSPHRASE", "")
+		t.Setenv("NPOLEON_KEY_FILE", "")
+
+		// > Act
+		_, err := Open(t.TempDir(), "")
+
+		// > Assert
+		if err == nil {
+			t.Errorf("Expected error without passphrase or key file")
+		}
+	})
+
+	t.Run("Key file next to the credentials is refused", func(t *testing.T) {
+		// > Arrange
+		dir := t.TempDir()
+		t.Setenv("NPOLEON_CREDENTIAL_STORE", "file")
+		t.Setenv("NPOLEON_PASSPHRASE", "")
+		t.Setenv("NPOLEON_KEY_FILE", filepath.Join(dir, "credentials.key"))
+
+		// > Act
+		_, err := Open(dir, "")
+
+		// > Assert
+		if err == nil {
+			t.Errorf("Expected error for key file in the application directory")
+		}
+	})
+
+	t.Run("Key file elsewhere protects encrypted file", func(t *testing.T) {
+		// > Arrange
+		t.Setenv("NPOLEON_CREDENTIAL_STORE", "file")
+		t.Setenv("NPOLEON_PASSPHRASE", "")
+		t.Setenv("NPOLEON_KEY_FILE", filepath.Join(t.TempDir(), "npoleon.key"))
+
+		// > Act
+		store, err := Open(t.TempDir(), "")
+
+		// > Assert
+		if _, isFile := store.(EncryptedFile); err != nil || !isFile {
+			t.Errorf("Expected encrypted file, got %v (%v)", store, err)
+		}
+	})
+
+	t.Run("Config file is used without keyring, passphrase or key file", func(t *testing.T) {
+		// > Arrange
+		t.Setenv("NPOLEON_CREDENTIAL_STORE", "")
+		t.Setenv("NPOLEON_PASSPHRASE", "")
+		t.Setenv("NPOLEON_KEY_FILE", "")
+		original := lookPath
+		defer func() { lookPath = original }()
+		lookPath = func(file string) (string, error) { return "", exec.ErrNotFound }
+
+		// > Act
+		store, err := Open(t.TempDir(), "")
+
+		// > Assert
+		if _, isConfig := store.(ConfigFile); err != nil || !isConfig {
+			t.Errorf("Expected config file, got %v (%v)", store, err)
+		}
+	})
+
+	t.Run("Invalid store is refused", func(t *testing.T) {
+		// > Arrange
+		t.Setenv("NPOLEON_CREDENTIAL_STORE", "shoebox")
+
+		// > Act
+		_, err := Open(t.TempDir(), "")
+
+		// > Assert
+		if err == nil {
+			t.Errorf("Expected error for invalid store")
+		}
+	})
+}
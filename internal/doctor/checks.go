@@ -0,0 +1,45 @@
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// MaxClockSkew is how far the local clock may be off before plays are matched
+// to the wrong moment
+const MaxClockSkew = time.Minute
+
+// CheckPermissions fails if the file has any of the forbidden permissions,
+// e.g. 0077 for files that other users shouldn't be able to read. A file that
+// doesn't exist passes.
+func CheckPermissions(path string, forbidden os.FileMode) (string, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Sprintf("%s does not exist", path), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	mode := info.Mode().Perm()
+	if mode&forbidden != 0 {
+		return "", fmt.Errorf("%s is accessible by other users (mode %04o)", path, mode)
+	}
+	return fmt.Sprintf("%s (mode %04o)", path, mode), nil
+}
+
+// CheckClockSkew compares the local time with the time on a server. The
+// server only reports whole seconds, so a second is always allowed.
+func CheckClockSkew(local time.Time, server time.Time) (string, error) {
+	skew := local.Sub(server).Round(time.Second)
+	if skew.Abs() > MaxClockSkew {
+		direction := "ahead"
+		if skew < 0 {
+			direction = "behind"
+		}
+		return "", fmt.Errorf("the local clock is %v %s", skew.Abs(), direction)
+	}
+	return fmt.Sprintf("off by %v", skew.Abs()), nil
+}
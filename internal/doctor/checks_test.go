@@ -0,0 +1,67 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name  string
+		mode  os.FileMode
+		fails bool
+	}{
+		{name: "private", mode: 0600},
+		{name: "readable", mode: 0644, fails: true},
+		{name: "missing"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// > Arrange
+			path := filepath.Join(dir, test.name)
+			if test.mode != 0 {
+				_ = os.WriteFile(path, []byte("LASTFM_API_SECRET=secret\n"), test.mode)
+				_ = os.Chmod(path, test.mode)
+			}
+
+			// > Act
+			_, err := CheckPermissions(path, 0077)
+
+			// > Assert
+			if (err != nil) != test.fails {
+				t.Errorf("Expected failure: %v, got %v", test.fails, err)
+			}
+		})
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	server := time.Date(2024, 1, 10, 16, 8, 23, 0, time.UTC)
+	tests := []struct {
+		local    time.Time
+		expected string
+		fails    bool
+	}{
+		{local: server.Add(400 * time.Millisecond), expected: "off by 0s"},
+		{local: server.Add(-30 * time.Second), expected: "off by 30s"},
+		{local: server.Add(-5 * time.Minute), expected: "the local clock is 5m0s behind", fails: true},
+		{local: server.Add(2 * time.Minute), expected: "the local clock is 2m0s ahead", fails: true},
+	}
+
+	for _, test := range tests {
+		// > Act
+		detail, err := CheckClockSkew(test.local, server)
+
+		// > Assert
+		if err != nil {
+			detail = err.Error()
+		}
+		if (err != nil) != test.fails || detail != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, detail)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package doctor
+
+import (
+	"fmt"
+	"io"
+)
+
+// Check is a single diagnosis. Run returns a short description of what it
+// found, or an error that explains what is wrong, in which case the hint tells
+// the user how to fix it.
+type Check struct {
+	Name string
+	Hint string
+	// Requires is the name of a check that has to pass first, e.g. because
+	// its result is needed. The check is skipped if that one failed.
+	Requires string
+	Run      func() (string, error)
+}
+
+type Status string
+
+const (
+	Passed  Status = "pass"
+	Failed  Status = "FAIL"
+	Skipped Status = "skip"
+)
+
+type Result struct {
+	Check  Check
+	Status Status
+	Detail string
+	Err    error
+}
+
+// Run performs the checks in order, and prints a line for each of them as
+// soon as it is done. It returns false if any of them failed.
+func Run(checks []Check, out io.Writer) ([]Result, bool) {
+	var results []Result
+	statuses := map[string]Status{}
+	healthy := true
+
+	for _, check := range checks {
+		result := Result{Check: check}
+		if required, exists := statuses[check.Requires]; exists && required != Passed {
+			result.Status = Skipped
+			result.Detail = fmt.Sprintf("requires %s", check.Requires)
+		} else if detail, err := check.Run(); err != nil {
+			result.Status = Failed
+			result.Err = err
+			healthy = false
+		} else {
+			result.Status = Passed
+			result.Detail = detail
+		}
+
+		statuses[check.Name] = result.Status
+		results = append(results, result)
+		printResult(out, result)
+	}
+	return results, healthy
+}
+
+func printResult(out io.Writer, result Result) {
+	line := fmt.Sprintf("[%s] %s", result.Status, result.Check.Name)
+	if result.Err != nil {
+		line += ": " + result.Err.Error()
+	} else if result.Detail != "" {
+		line += ": " + result.Detail
+	}
+	_, _ = fmt.Fprintln(out, line)
+
+	if result.Status == Failed && result.Check.Hint != "" {
+		_, _ = fmt.Fprintln(out, "       "+result.Check.Hint)
+	}
+}
@@ -0,0 +1,46 @@
+package doctor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	// > Arrange
+	var out bytes.Buffer
+	checks := []Check{
+		{Name: "Config file", Run: func() (string, error) { return "ok", nil }},
+		{
+			Name: "NPO website",
+			Hint: "Check your internet connection",
+			Run:  func() (string, error) { return "", errors.New("no route to host") },
+		},
+		{
+			Name:     "NPO buildId",
+			Requires: "NPO website",
+			Run: func() (string, error) {
+				t.Errorf("Expected the check to be skipped")
+				return "", nil
+			},
+		},
+	}
+
+	// > Act
+	results, healthy := Run(checks, &out)
+
+	// > Assert
+	if healthy {
+		t.Errorf("Expected an unhealthy result")
+	}
+	if len(results) != 3 || results[2].Status != Skipped {
+		t.Errorf("Expected the last check to be skipped, got %+v", results)
+	}
+	expected := "[pass] Config file: ok\n" +
+		"[FAIL] NPO website: no route to host\n" +
+		"       Check your internet connection\n" +
+		"[skip] NPO buildId: requires NPO website\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,173 @@
+package filtering
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"npoleon/internal/nporadio"
+	"npoleon/internal/util"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Condition matches tracks on artist, title and the hour of day at which they
+// were played. Artist and Title are regular expressions, Hours is a range such
+// as "22-6" that runs from the start of the first hour until the start of the
+// second one. All fields that are set must match.
+type Condition struct {
+	Artist string `json:"artist,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Hours  string `json:"hours,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	artistRe  *regexp.Regexp
+	titleRe   *regexp.Regexp
+	fromHour  int
+	untilHour int
+}
+
+// Filter decides which tracks are scrobbled. Tracks that match any of the
+// Exclude conditions are skipped. If there are Include conditions, tracks
+// must also match at least one of those.
+type Filter struct {
+	Include []Condition `json:"include"`
+	Exclude []Condition `json:"exclude"`
+}
+
+func LoadFilter(path string) (Filter, error) {
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Filter{}, nil
+	}
+	if err != nil {
+		return Filter{}, err
+	}
+
+	return ParseFilter(contents)
+}
+
+func ParseFilter(contents []byte) (Filter, error) {
+	var filter Filter
+	if err := json.Unmarshal(contents, &filter); err != nil {
+		return Filter{}, fmt.Errorf("invalid filters file: %w", err)
+	}
+
+	for idx := range filter.Include {
+		if err := filter.Include[idx].compile(); err != nil {
+			return Filter{}, fmt.Errorf("invalid include condition %d: %w", idx+1, err)
+		}
+	}
+	for idx := range filter.Exclude {
+		if err := filter.Exclude[idx].compile(); err != nil {
+			return Filter{}, fmt.Errorf("invalid exclude condition %d: %w", idx+1, err)
+		}
+	}
+
+	return filter, nil
+}
+
+// Check returns whether a track should be scrobbled, and if not, why
+func (f Filter) Check(track nporadio.Track) (bool, string) {
+	for _, condition := range f.Exclude {
+		if condition.matches(track) {
+			return false, "excluded by " + condition.String()
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true, ""
+	}
+
+	for _, condition := range f.Include {
+		if condition.matches(track) {
+			return true, ""
+		}
+	}
+
+	return false, "not included by any filter"
+}
+
+func (c Condition) String() string {
+	if c.Reason != "" {
+		return c.Reason
+	}
+
+	var parts []string
+	if c.Artist != "" {
+		parts = append(parts, fmt.Sprintf("artist ~ /%s/", c.Artist))
+	}
+	if c.Title != "" {
+		parts = append(parts, fmt.Sprintf("title ~ /%s/", c.Title))
+	}
+	if c.Hours != "" {
+		parts = append(parts, fmt.Sprintf("hours %s", c.Hours))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (c *Condition) compile() error {
+	if c.Artist == "" && c.Title == "" && c.Hours == "" {
+		return errors.New(`specify "artist", "title", "hours" or a combination`)
+	}
+
+	var err error
+	if c.Artist != "" {
+		if c.artistRe, err = regexp.Compile(c.Artist); err != nil {
+			return err
+		}
+	}
+	if c.Title != "" {
+		if c.titleRe, err = regexp.Compile(c.Title); err != nil {
+			return err
+		}
+	}
+	if c.Hours != "" {
+		if c.fromHour, c.untilHour, err = parseHours(c.Hours); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches evaluates hours in the time zone that the user chose, like the times
+// that Npoleon shows
+func (c Condition) matches(track nporadio.Track) bool {
+	if c.artistRe != nil && !c.artistRe.MatchString(track.Artist) {
+		return false
+	}
+	if c.titleRe != nil && !c.titleRe.MatchString(track.Title) {
+		return false
+	}
+	if c.Hours != "" && !isWithinHours(track.PlayedAt.In(util.Location()).Hour(), c.fromHour, c.untilHour) {
+		return false
+	}
+	return true
+}
+
+func parseHours(hours string) (int, int, error) {
+	parts := strings.Split(hours, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf(`hours must look like "22-6", got "%s"`, hours)
+	}
+
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || from < 0 || from > 23 {
+		return 0, 0, fmt.Errorf(`invalid start hour in "%s"`, hours)
+	}
+	until, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || until < 0 || until > 24 {
+		return 0, 0, fmt.Errorf(`invalid end hour in "%s"`, hours)
+	}
+
+	return from, until, nil
+}
+
+// isWithinHours supports ranges that wrap around midnight, e.g. 22-6
+func isWithinHours(hour int, from int, until int) bool {
+	if from <= until {
+		return hour >= from && hour < until
+	}
+	return hour >= from || hour < until
+}
@@ -0,0 +1,120 @@
+package filtering
+
+import (
+	"npoleon/internal/nporadio"
+	"npoleon/internal/util"
+	"testing"
+	"time"
+)
+
+const testFilter = `{
+	"exclude": [
+		{"title": "(?i)jingle", "reason": "station jingle"},
+		{"artist": "^Armin van Buuren$", "hours": "22-6"}
+	],
+	"include": [
+		{"artist": "(?i)armin|beyonc"},
+		{"hours": "12-13"}
+	]
+}`
+
+var testDataFilterCheck = []struct {
+	artist   string
+	title    string
+	hour     int
+	expected bool
+}{
+	{"Beyoncé", "Halo", 9, true},
+	{"Beyoncé", "Halo (Jingle Remix)", 9, false},
+	{"Armin van Buuren", "Blah Blah Blah", 18, true},
+	{"Armin van Buuren", "Blah Blah Blah", 23, false},
+	{"Armin van Buuren", "Blah Blah Blah", 5, false},
+	{"Armin van Buuren", "Blah Blah Blah", 6, true},
+	{"Rob de Nijs", "Banger Hart", 9, false},
+	{"Rob de Nijs", "Banger Hart", 12, true},
+	{"Rob de Nijs", "Banger Hart", 13, false},
+}
+
+func TestFilter_Check(t *testing.T) {
+	filter, err := ParseFilter([]byte(testFilter))
+	if err != nil {
+		t.Fatalf("Failed to parse filter: %v", err)
+	}
+
+	for _, data := range testDataFilterCheck {
+		t.Run(data.artist+" – "+data.title, func(t *testing.T) {
+			// > Arrange
+			track := nporadio.Track{
+				Artist:   data.artist,
+				Title:    data.title,
+				PlayedAt: time.Date(2024, 1, 1, data.hour, 30, 0, 0, util.Location()),
+			}
+
+			// > Act
+			res, reason := filter.Check(track)
+
+			// > Assert
+			if res != data.expected {
+				t.Errorf("Expected %v, got %v (%v)", data.expected, res, reason)
+			}
+			if !res && reason == "" {
+				t.Errorf("Skipped track should have a reason")
+			}
+		})
+	}
+}
+
+func TestFilter_Check_UserTimeZone(t *testing.T) {
+	// > Arrange
+	filter, _ := ParseFilter([]byte(`{"exclude": [{"hours": "22-6"}]}`))
+	amsterdam := util.Location()
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	util.SetLocation(tokyo)
+	defer util.SetLocation(amsterdam)
+	// 14:00 in Amsterdam, but 22:00 in Tokyo
+	track := nporadio.Track{
+		Artist:   "Anouk",
+		Title:    "Nobody's Wife",
+		PlayedAt: time.Date(2024, 1, 1, 14, 0, 0, 0, amsterdam),
+	}
+
+	// > Act
+	res, _ := filter.Check(track)
+
+	// > Assert
+	if res {
+		t.Errorf("Expected hours to be evaluated in the user's time zone")
+	}
+}
+
+func TestFilter_Check_Empty(t *testing.T) {
+	// > Act
+	res, _ := Filter{}.Check(nporadio.Track{Artist: "Anouk", Title: "Nobody's Wife"})
+
+	// > Assert
+	if !res {
+		t.Errorf("An empty filter should not skip any tracks")
+	}
+}
+
+var testDataParseFilter = []string{
+	`[]`,
+	`{"exclude": [{}]}`,
+	`{"exclude": [{"artist": "("}]}`,
+	`{"include": [{"hours": "6"}]}`,
+	`{"include": [{"hours": "25-6"}]}`,
+}
+
+func TestParseFilter(t *testing.T) {
+	for _, data := range testDataParseFilter {
+		t.Run(data, func(t *testing.T) {
+			// > Act
+			_, err := ParseFilter([]byte(data))
+
+			// > Assert
+			if err == nil {
+				t.Errorf("Parsing should have failed")
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Cassette contains the responses to HTTP requests, so that they can be
+// replayed later without access to the internet
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Url      string `json:"url"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func LoadCassette(path string) (Cassette, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return Cassette{}, err
+	}
+
+	var cassette Cassette
+	if err = json.Unmarshal(contents, &cassette); err != nil {
+		return Cassette{}, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return cassette, nil
+}
+
+func (c Cassette) Save(path string) error {
+	contents, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(contents, '\n'), 0644)
+}
+
+// NormalizeUrl makes URLs that only differ in the order of their query
+// parameters, the case of their host or a fragment match each other
+func NormalizeUrl(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Host = strings.TrimSuffix(parsed.Host, ":443")
+	parsed.Host = strings.TrimSuffix(parsed.Host, ":80")
+	parsed.Fragment = ""
+	parsed.RawQuery = parsed.Query().Encode()
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+
+	return parsed.String()
+}
+
+// ----------------------------------------------------------------------------
+
+// RecordingClient passes requests on to another client and writes every
+// response to a cassette file as soon as it has been received
+type RecordingClient struct {
+	client   ClientInterface
+	path     string
+	mutex    *sync.Mutex
+	cassette *Cassette
+}
+
+func CreateRecordingClient(client ClientInterface, path string) RecordingClient {
+	return RecordingClient{
+		client:   client,
+		path:     path,
+		mutex:    &sync.Mutex{},
+		cassette: &Cassette{},
+	}
+}
+
+func (rc RecordingClient) Fetch(url string) ([]byte, error) {
+	res, err := rc.client.Fetch(url)
+
+	interaction := Interaction{Url: url, Response: string(res)}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.cassette.Interactions = append(rc.cassette.Interactions, interaction)
+	if saveErr := rc.cassette.Save(rc.path); saveErr != nil {
+		return nil, saveErr
+	}
+
+	return res, err
+}
+
+// ----------------------------------------------------------------------------
+
+// ReplayingClient serves the responses from a cassette. Every interaction can
+// only be replayed once, and requests for the same URL are answered in the
+// order in which they were recorded.
+type ReplayingClient struct {
+	cassette Cassette
+	mutex    *sync.Mutex
+	used     []bool
+	missing  *[]string
+}
+
+func CreateReplayingClient(path string) (ReplayingClient, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return ReplayingClient{}, err
+	}
+
+	return ReplayingClient{
+		cassette: cassette,
+		mutex:    &sync.Mutex{},
+		used:     make([]bool, len(cassette.Interactions)),
+		missing:  &[]string{},
+	}, nil
+}
+
+func (rc ReplayingClient) Fetch(url string) ([]byte, error) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	normalized := NormalizeUrl(url)
+	for idx, interaction := range rc.cassette.Interactions {
+		if rc.used[idx] || NormalizeUrl(interaction.Url) != normalized {
+			continue
+		}
+
+		rc.used[idx] = true
+		if interaction.Error != "" {
+			return nil, errors.New(interaction.Error)
+		}
+		return []byte(interaction.Response), nil
+	}
+
+	*rc.missing = append(*rc.missing, url)
+	return nil, fmt.Errorf("no recorded interaction left for '%s'", url)
+}
+
+// Verify reports requests that were not in the cassette, and interactions in
+// the cassette that were never requested
+func (rc ReplayingClient) Verify() error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	var problems []string
+	for _, url := range *rc.missing {
+		problems = append(problems, "missing interaction for "+url)
+	}
+	for idx, interaction := range rc.cassette.Interactions {
+		if !rc.used[idx] {
+			problems = append(problems, "unused interaction for "+interaction.Url)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return errors.New(strings.Join(problems, "; "))
+}
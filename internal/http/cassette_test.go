@@ -0,0 +1,90 @@
+package http
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeUrl(t *testing.T) {
+	tests := []struct {
+		a string
+		b string
+	}{
+		{"https://www.npo3fm.nl", "https://www.npo3fm.nl/"},
+		{"https://WWW.NPO3FM.NL:443/", "https://www.npo3fm.nl/"},
+		{"https://www.npo3fm.nl/gedraaid.json?page=1&date=6-1-2024", "https://www.npo3fm.nl/gedraaid.json?date=6-1-2024&page=1"},
+		{"https://www.npo3fm.nl/#top", "https://www.npo3fm.nl/"},
+	}
+
+	for _, test := range tests {
+		if NormalizeUrl(test.a) != NormalizeUrl(test.b) {
+			t.Errorf("Expected '%v' and '%v' to match, got '%v' and '%v'", test.a, test.b, NormalizeUrl(test.a), NormalizeUrl(test.b))
+		}
+	}
+
+	if NormalizeUrl("https://www.npo3fm.nl/?page=1") == NormalizeUrl("https://www.npo3fm.nl/?page=2") {
+		t.Errorf("Expected URLs with different query parameters not to match")
+	}
+}
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	// > Arrange
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	fake := FakeClient{Responses: make(map[string][]byte)}
+	fake.MakeFetchReturn("https://www.npo3fm.nl/", `{"buildId":"buildId"}`)
+
+	recorder := CreateRecordingClient(fake, path)
+	_, _ = recorder.Fetch("https://www.npo3fm.nl/")
+	_, _ = recorder.Fetch("https://www.npo3fm.nl/missing")
+
+	// > Act
+	replayer, err := CreateReplayingClient(path)
+	if err != nil {
+		t.Fatalf("Loading cassette failed: %v", err)
+	}
+	res, err := replayer.Fetch("https://www.npo3fm.nl")
+	_, missingErr := replayer.Fetch("https://www.npo3fm.nl/missing")
+
+	// > Assert
+	if err != nil || string(res) != `{"buildId":"buildId"}` {
+		t.Errorf("Expected recorded response, got '%s' (%v)", res, err)
+	}
+	if missingErr == nil || !strings.Contains(missingErr.Error(), "No response defined") {
+		t.Errorf("Expected recorded error to be replayed, got %v", missingErr)
+	}
+	if err = replayer.Verify(); err != nil {
+		t.Errorf("Expected all interactions to be used, got %v", err)
+	}
+}
+
+func TestReplayingClient_Verify(t *testing.T) {
+	// > Arrange
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette := Cassette{Interactions: []Interaction{
+		{Url: "https://www.npo3fm.nl/", Response: "first"},
+		{Url: "https://www.npo3fm.nl/", Response: "second"},
+		{Url: "https://www.npo3fm.nl/unused", Response: "unused"},
+	}}
+	_ = cassette.Save(path)
+	replayer, _ := CreateReplayingClient(path)
+
+	// > Act
+	first, _ := replayer.Fetch("https://www.npo3fm.nl/")
+	second, _ := replayer.Fetch("https://www.npo3fm.nl/")
+	_, err := replayer.Fetch("https://www.npo3fm.nl/")
+	verifyErr := replayer.Verify()
+
+	// > Assert
+	if string(first) != "first" || string(second) != "second" {
+		t.Errorf("Expected interactions to be replayed in order, got '%s' and '%s'", first, second)
+	}
+	if err == nil {
+		t.Errorf("Expected error when all interactions for a URL have been used")
+	}
+	if verifyErr == nil ||
+		!strings.Contains(verifyErr.Error(), "missing interaction for https://www.npo3fm.nl/") ||
+		!strings.Contains(verifyErr.Error(), "unused interaction for https://www.npo3fm.nl/unused") {
+		t.Errorf("Expected missing and unused interactions to be reported, got %v", verifyErr)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"time"
 )
 
 // ----------------------------------------------------------------------------
@@ -18,7 +20,18 @@ type ClientInterface interface {
 type Client struct {
 }
 
-func (c Client) Fetch(url string) ([]byte, error) {
+// Fetch logs every request at debug level, including how long it took
+func (c Client) Fetch(url string) (body []byte, err error) {
+	started := time.Now()
+	status := 0
+	defer func() {
+		args := []any{"url", url, "status", status, "bytes", len(body), "duration", time.Since(started)}
+		if err != nil {
+			args = append(args, "error", err.Error())
+		}
+		slog.Debug("GET "+url, args...)
+	}()
+
 	client := &http.Client{}
 
 	req, err := http.NewRequest("GET", url, nil)
@@ -32,8 +45,13 @@ func (c Client) Fetch(url string) ([]byte, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	status = resp.StatusCode
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("request to '%s' failed: %s", url, resp.Status)
+	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err = io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +59,37 @@ func (c Client) Fetch(url string) ([]byte, error) {
 	return body, nil
 }
 
+// FetchDate returns the time according to the server, from the Date header of
+// its response
+func (c Client) FetchDate(url string) (date time.Time, err error) {
+	started := time.Now()
+	defer func() {
+		args := []any{"url", url, "duration", time.Since(started)}
+		if err != nil {
+			args = append(args, "error", err.Error())
+		}
+		slog.Debug("HEAD "+url, args...)
+	}()
+
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	req.Header.Set("User-Agent", "npoleon")
+
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	header := resp.Header.Get("Date")
+	if header == "" {
+		return time.Time{}, fmt.Errorf("'%s' did not send its time", url)
+	}
+	return http.ParseTime(header)
+}
+
 // ----------------------------------------------------------------------------
 
 type FakeClient struct {
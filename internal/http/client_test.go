@@ -1,19 +1,71 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
-func TestGetBuildId(t *testing.T) {
+func TestClient_Fetch(t *testing.T) {
 	// > Arrange
-	httpClient := &Client{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><body><h1>HET IS CHUN!!!</h1></body></html>`))
+	}))
+	defer server.Close()
 
 	// > Act
-	res, _ := httpClient.Fetch("https://chuniversiteit.nl/chungfeilung/")
+	res, err := Client{}.Fetch(server.URL + "/chungfeilung/")
 
 	// > Assert
-	if !strings.Contains(string(res), "HET IS CHUN!!!") {
-		t.Errorf("Remote response does not contain expected text")
+	if err != nil || !strings.Contains(string(res), "HET IS CHUN!!!") {
+		t.Errorf("Response does not contain expected text, got %q (%v)", res, err)
+	}
+}
+
+func TestClient_Fetch_Trace(t *testing.T) {
+	// > Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(previous)
+
+	// > Act
+	_, err := Client{}.Fetch(server.URL)
+
+	// > Assert
+	var record map[string]any
+	_ = json.Unmarshal(logs.Bytes(), &record)
+	if err == nil || record["level"] != "DEBUG" || record["status"] != float64(502) || record["url"] != server.URL {
+		t.Errorf("Expected the failed request to be traced, got %q", logs.String())
+	}
+	if _, exists := record["duration"]; !exists {
+		t.Errorf("Expected the duration of the request to be logged, got %q", logs.String())
+	}
+}
+
+func TestClient_FetchDate(t *testing.T) {
+	// > Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", "Wed, 10 Jan 2024 16:08:23 GMT")
+	}))
+	defer server.Close()
+
+	// > Act
+	date, err := Client{}.FetchDate(server.URL)
+
+	// > Assert
+	expected := time.Date(2024, 1, 10, 16, 8, 23, 0, time.UTC)
+	if err != nil || !date.Equal(expected) {
+		t.Errorf("Expected %v, got %v (%v)", expected, date, err)
 	}
 }
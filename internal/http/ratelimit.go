@@ -0,0 +1,45 @@
+package http
+
+import (
+	"npoleon/internal/clock"
+	"sync"
+	"time"
+)
+
+// RateLimitedClient spaces out the requests that it passes on to another
+// client, so that at most one request is started per interval. A single
+// RateLimitedClient can be shared by several NPO clients to limit the total
+// number of requests, e.g. when archiving all stations at once.
+type RateLimitedClient struct {
+	client   ClientInterface
+	clock    clock.Clock
+	interval time.Duration
+	mutex    *sync.Mutex
+	next     *time.Time
+}
+
+func CreateRateLimitedClient(client ClientInterface, clock clock.Clock, interval time.Duration) RateLimitedClient {
+	return RateLimitedClient{
+		client:   client,
+		clock:    clock,
+		interval: interval,
+		mutex:    &sync.Mutex{},
+		next:     &time.Time{},
+	}
+}
+
+func (rc RateLimitedClient) Fetch(url string) ([]byte, error) {
+	rc.mutex.Lock()
+	now := rc.clock.Now()
+	start := *rc.next
+	if start.Before(now) {
+		start = now
+	}
+	*rc.next = start.Add(rc.interval)
+	rc.mutex.Unlock()
+
+	if wait := start.Sub(now); wait > 0 {
+		rc.clock.Sleep(wait)
+	}
+	return rc.client.Fetch(url)
+}
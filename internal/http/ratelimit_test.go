@@ -0,0 +1,39 @@
+package http
+
+import (
+	"npoleon/internal/clock"
+	"testing"
+	"time"
+)
+
+type timingClient struct {
+	clock clock.Clock
+	times *[]time.Time
+}
+
+func (tc timingClient) Fetch(url string) ([]byte, error) {
+	*tc.times = append(*tc.times, tc.clock.Now())
+	return []byte(url), nil
+}
+
+func TestRateLimitedClient(t *testing.T) {
+	// > Arrange
+	start := time.Date(2024, 1, 6, 8, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(start)
+	var times []time.Time
+	client := CreateRateLimitedClient(timingClient{clock: fakeClock, times: &times}, fakeClock, time.Second)
+
+	// > Act
+	_, _ = client.Fetch("https://www.nporadio2.nl/1")
+	_, _ = client.Fetch("https://www.nporadio2.nl/2")
+	fakeClock.Sleep(5 * time.Second)
+	_, _ = client.Fetch("https://www.nporadio2.nl/3")
+
+	// > Assert
+	expected := []time.Duration{0, time.Second, 6 * time.Second}
+	for idx, offset := range expected {
+		if !times[idx].Equal(start.Add(offset)) {
+			t.Errorf("Expected request %d to start at +%v, got +%v", idx+1, offset, times[idx].Sub(start))
+		}
+	}
+}
@@ -3,6 +3,11 @@ package lastfm
 import (
 	"errors"
 	"github.com/shkh/lastfm-go/lastfm"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"npoleon/internal/nporadio"
+	"strconv"
 	"time"
 )
 
@@ -15,51 +20,143 @@ type ApiInterface interface {
 	GetSessionKey() string
 	SetSession(sessionkey string)
 	GetCorrection(artist string, title string) (lastfm.TrackGetCorrection, error)
-	ScrobbleTrack(artist string, title string, timestamp time.Time) (lastfm.TrackScrobble, error)
+	GetInfo(artist string, title string) (lastfm.TrackGetInfo, error)
+	ScrobbleTrack(track nporadio.Track) (ScrobbleResult, error)
+	GetUser() (string, error)
 }
 
 // ----------------------------------------------------------------------------
 
+// requestTimeout keeps a stalled connection to Last.fm from holding up the
+// scrobbler, which keeps the scrobble history locked while it waits
+const requestTimeout = 30 * time.Second
+
+// Api sends the requests itself rather than through lastfm-go, so that the
+// HTTP client and the server can be chosen. It still uses lastfm-go's types
+// for the responses.
 type Api struct {
-	api *lastfm.Api
+	key        string
+	secret     string
+	sessionKey string
+	httpClient *http.Client
+	baseUrl    string
+}
+
+// CreateApiWithBaseUrl creates an API that talks to another server than
+// Last.fm, e.g. a fake one in tests
+func CreateApiWithBaseUrl(key string, secret string, httpClient *http.Client, baseUrl string) *Api {
+	return &Api{
+		key:        key,
+		secret:     secret,
+		httpClient: httpClient,
+		baseUrl:    baseUrl,
+	}
 }
 
 // ----------------------------------------------------------------------------
 
-func (a *Api) GetToken() (string, error) {
-	return a.api.GetToken()
+func (a *Api) GetToken() (token string, err error) {
+	defer trace("auth.getToken", time.Now(), &err)
+
+	var res lastfm.AuthGetToken
+	if err = a.get("auth.getToken", nil, &res); err != nil {
+		return "", err
+	}
+	return res.Token, nil
 }
 
+// GetAuthTokenUrl returns the page on which the user gives Npoleon access to
+// their account
 func (a *Api) GetAuthTokenUrl(token string) string {
-	return a.api.GetAuthTokenUrl(token)
+	params := url.Values{}
+	params.Set("api_key", a.key)
+	params.Set("token", token)
+	return lastfm.UriBrowserBase + "?" + params.Encode()
 }
 
-func (a *Api) LoginWithToken(token string) error {
-	return a.api.LoginWithToken(token)
+func (a *Api) LoginWithToken(token string) (err error) {
+	defer trace("auth.getSession", time.Now(), &err)
+
+	var res lastfm.AuthGetSession
+	if err = a.post("auth.getSession", map[string]string{"token": token}, false, &res); err != nil {
+		return err
+	}
+	a.sessionKey = res.Key
+	return nil
 }
 
 func (a *Api) GetSessionKey() string {
-	return a.api.GetSessionKey()
+	return a.sessionKey
 }
 
 func (a *Api) SetSession(sessionkey string) {
-	a.api.SetSession(sessionkey)
+	a.sessionKey = sessionkey
 }
 
-func (a *Api) GetCorrection(artist string, title string) (lastfm.TrackGetCorrection, error) {
-	return a.api.Track.GetCorrection(lastfm.P{
+func (a *Api) GetCorrection(artist string, title string) (res lastfm.TrackGetCorrection, err error) {
+	defer trace("track.getCorrection", time.Now(), &err, "artist", artist, "title", title)
+	err = a.get("track.getCorrection", map[string]string{
 		"artist": artist,
 		"track":  title,
-	})
+	}, &res)
+	return res, err
+}
+
+func (a *Api) GetInfo(artist string, title string) (res lastfm.TrackGetInfo, err error) {
+	defer trace("track.getInfo", time.Now(), &err, "artist", artist, "title", title)
+	err = a.get("track.getInfo", map[string]string{
+		"artist":      artist,
+		"track":       title,
+		"autocorrect": "1",
+	}, &res)
+	return res, err
+}
+
+func (a *Api) ScrobbleTrack(track nporadio.Track) (res ScrobbleResult, err error) {
+	defer trace("track.scrobble", time.Now(), &err, "play", track)
+
+	params := map[string]string{
+		"artist":       track.Artist,
+		"track":        track.Title,
+		"timestamp":    strconv.FormatInt(track.ScrobbleTime().Unix(), 10),
+		"chosenByUser": "0",
+	}
+	if track.AlbumArtist != "" {
+		params["albumArtist"] = track.AlbumArtist
+	}
+	if track.Album != "" {
+		params["album"] = track.Album
+	}
+	if track.Duration > 0 {
+		params["duration"] = strconv.Itoa(int(track.Duration.Seconds()))
+	}
+	if track.Mbid != "" {
+		params["mbid"] = track.Mbid
+	}
+	err = a.post("track.scrobble", params, true, &res)
+	return res, err
+}
+
+// GetUser returns the name of the user that the session belongs to. Unlike
+// most other calls it is signed with the session key, so it fails if the
+// session is no longer valid.
+func (a *Api) GetUser() (name string, err error) {
+	defer trace("user.getInfo", time.Now(), &err)
+
+	var res lastfm.UserGetInfo
+	if err = a.post("user.getInfo", nil, true, &res); err != nil {
+		return "", err
+	}
+	return res.Name, nil
 }
 
-func (a *Api) ScrobbleTrack(artist string, title string, playedAt time.Time) (lastfm.TrackScrobble, error) {
-	return a.api.Track.Scrobble(lastfm.P{
-		"artist":       artist,
-		"track":        title,
-		"timestamp":    playedAt.Unix(),
-		"chosenByUser": 0,
-	})
+// trace logs every request to Last.fm at debug level
+func trace(method string, started time.Time, err *error, args ...any) {
+	args = append(args, "method", method, "duration", time.Since(started))
+	if *err != nil {
+		args = append(args, "error", (*err).Error())
+	}
+	slog.Debug("Last.fm "+method, args...)
 }
 
 // ----------------------------------------------------------------------------
@@ -67,6 +164,15 @@ func (a *Api) ScrobbleTrack(artist string, title string, playedAt time.Time) (la
 type FakeApi struct {
 	SessionKey           string
 	LoginWithTokenResult error
+	ScrobbleTrackResult  ScrobbleResult
+	GetCorrectionResult  *lastfm.TrackGetCorrection
+	GetCorrectionCalls   int
+	GetInfoResult        *lastfm.TrackGetInfo
+	GetInfoCalls         int
+	ScrobbleTrackCalls   int
+	ScrobbleTrackDelay   time.Duration
+	GetUserResult        string
+	GetUserError         error
 }
 
 func (f *FakeApi) GetToken() (string, error) {
@@ -90,17 +196,33 @@ func (f *FakeApi) SetSession(sessionkey string) {
 }
 
 func (f *FakeApi) GetCorrection(artist string, title string) (lastfm.TrackGetCorrection, error) {
-	return lastfm.TrackGetCorrection{}, errors.New("not implemented")
+	f.GetCorrectionCalls++
+	if f.GetCorrectionResult == nil {
+		return lastfm.TrackGetCorrection{}, errors.New("not implemented")
+	}
+	return *f.GetCorrectionResult, nil
+}
+
+func (f *FakeApi) GetInfo(artist string, title string) (lastfm.TrackGetInfo, error) {
+	f.GetInfoCalls++
+	if f.GetInfoResult == nil {
+		return lastfm.TrackGetInfo{}, errors.New("not implemented")
+	}
+	return *f.GetInfoResult, nil
 }
 
-func (f *FakeApi) ScrobbleTrack(artist string, title string, playedAt time.Time) (lastfm.TrackScrobble, error) {
-	return lastfm.TrackScrobble{}, nil
+func (f *FakeApi) ScrobbleTrack(track nporadio.Track) (ScrobbleResult, error) {
+	f.ScrobbleTrackCalls++
+	time.Sleep(f.ScrobbleTrackDelay)
+	return f.ScrobbleTrackResult, nil
+}
+
+func (f *FakeApi) GetUser() (string, error) {
+	return f.GetUserResult, f.GetUserError
 }
 
 // ----------------------------------------------------------------------------
 
 var CreateApi = func(key string, secret string) ApiInterface {
-	return &Api{
-		api: lastfm.New(key, secret),
-	}
+	return CreateApiWithBaseUrl(key, secret, &http.Client{Timeout: requestTimeout}, lastfm.UriApiSecBase)
 }
@@ -0,0 +1,157 @@
+package lastfm
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"npoleon/internal/clock"
+	"npoleon/internal/lastfm/fakeserver"
+	"npoleon/internal/nporadio"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestApi_FakeServer(t *testing.T) {
+	dir := createTestFile(".npoleon/config", "")
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC)
+	server := fakeserver.Start(clock.NewFake(now), "key", "secret")
+	defer server.Close()
+
+	CreateApi = func(key string, secret string) ApiInterface {
+		return CreateApiWithBaseUrl(key, secret, http.DefaultClient, server.URL)
+	}
+
+	t.Run("Client logs in with an authorized token", func(t *testing.T) {
+		// > Arrange
+		client, _ := CreateClient("key", "secret")
+		_, token, err := client.GetAuthTokenUrl()
+		if err != nil {
+			t.Fatalf("Requesting token failed: %v", err)
+		}
+		server.AuthorizeToken(token)
+
+		// > Act
+		err = client.Login(token)
+
+		// > Assert
+		if err != nil {
+			t.Errorf("Login failed: %v", err)
+		}
+	})
+
+	t.Run("Client scrobbles corrected and enriched track", func(t *testing.T) {
+		// > Arrange
+		server.AddSession("session")
+		server.SetCorrection("Beyonce", "Halo", "Beyoncé", "Halo")
+		server.SetTrackInfo("Beyoncé", "Halo", fakeserver.TrackInfo{Album: "I Am... Sasha Fierce", Duration: 261 * time.Second})
+		client, _ := CreateAuthenticatedClient("key", "secret", "session")
+		track := nporadio.Track{
+			Id:       uuid.New(),
+			Artist:   "Beyonce",
+			Title:    "Halo",
+			PlayedAt: now.Add(-10 * time.Minute),
+		}
+
+		// > Act
+		err := client.Scrobble(track)
+
+		// > Assert
+		if err != nil {
+			t.Fatalf("Scrobbling failed: %v", err)
+		}
+		scrobbles := server.Scrobbles()
+		if len(scrobbles) != 1 {
+			t.Fatalf("Expected 1 scrobble, got %v", len(scrobbles))
+		}
+		if scrobbles[0].Artist != "Beyoncé" || !scrobbles[0].Timestamp.Equal(track.PlayedAt) {
+			t.Errorf("Expected corrected scrobble at %v, got %v at %v", track.PlayedAt, scrobbles[0].Artist, scrobbles[0].Timestamp)
+		}
+		if scrobbles[0].Album != "I Am... Sasha Fierce" || scrobbles[0].Duration != 261*time.Second {
+			t.Errorf("Expected album and duration to be submitted, got %v and %v", scrobbles[0].Album, scrobbles[0].Duration)
+		}
+	})
+
+	t.Run("Client reports ignored scrobble", func(t *testing.T) {
+		// > Arrange
+		server.AddSession("session")
+		client, _ := CreateAuthenticatedClient("key", "secret", "session")
+		track := nporadio.Track{
+			Id:       uuid.New(),
+			Artist:   "Golden Earring",
+			Title:    "Radar Love",
+			PlayedAt: now.AddDate(0, 0, -20),
+		}
+
+		// > Act
+		err := client.Scrobble(track)
+
+		// > Assert
+		var ignored IgnoredError
+		if !errors.As(err, &ignored) || ignored.Code != TimestampTooOld {
+			t.Errorf("Expected scrobble to be ignored because it is too old, got %v", err)
+		}
+	})
+
+	t.Run("Client looks up each track once before scrobbling", func(t *testing.T) {
+		// > Arrange
+		server.AddSession("session")
+		server.SetCorrection("Tiesto", "Adagio for Strings", "Tiësto", "Adagio for Strings")
+		server.SetTrackInfo("Tiësto", "Adagio for Strings", fakeserver.TrackInfo{Duration: 9 * time.Minute})
+		client, _ := CreateAuthenticatedClient("key", "secret", "session")
+		var tracks []nporadio.Track
+		for hour := 3; hour > 0; hour-- {
+			tracks = append(tracks, nporadio.Track{
+				Id:       uuid.New(),
+				Artist:   "Tiesto",
+				Title:    "Adagio for Strings",
+				PlayedAt: now.Add(-time.Duration(hour) * time.Hour),
+			})
+		}
+		before := len(server.Requests())
+
+		// > Act
+		client.Prefetch(tracks)
+		for _, track := range tracks {
+			_ = client.Scrobble(track)
+		}
+
+		// > Assert
+		lookups := map[string]int{}
+		for _, method := range server.Requests()[before:] {
+			lookups[method]++
+		}
+		if lookups["track.getcorrection"] != 1 || lookups["track.getinfo"] != 1 {
+			t.Errorf("Expected a single correction and info lookup, got %v", lookups)
+		}
+		scrobbles := server.Scrobbles()
+		if last := scrobbles[len(scrobbles)-1]; last.Artist != "Tiësto" || last.Duration != 9*time.Minute {
+			t.Errorf("Expected corrected track with its duration, got %v", last)
+		}
+	})
+}
+
+func TestApi_ScrobbleTrack_Timeout(t *testing.T) {
+	// > Arrange
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	api := CreateApiWithBaseUrl("key", "secret", &http.Client{Timeout: 50 * time.Millisecond}, server.URL)
+	api.SetSession("session")
+	track := nporadio.Track{Id: uuid.New(), Artist: "Doe Maar", Title: "Smoorverliefd", PlayedAt: time.Now()}
+
+	// > Act
+	_, err := api.ScrobbleTrack(track)
+
+	// > Assert
+	if err == nil {
+		t.Errorf("Expected the request to time out")
+	}
+}
@@ -0,0 +1,61 @@
+package lastfm
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// fileCache is a key-value store that is kept in a JSON file in the
+// application directory, so that its contents survive between runs
+type fileCache[T any] struct {
+	file    string
+	mutex   sync.Mutex
+	loaded  bool
+	entries map[string]T
+}
+
+func newFileCache[T any](file string) *fileCache[T] {
+	return &fileCache[T]{
+		file:    file,
+		entries: make(map[string]T),
+	}
+}
+
+func (c *fileCache[T]) get(key string) (T, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.load()
+	entry, exists := c.entries[key]
+	return entry, exists
+}
+
+func (c *fileCache[T]) put(key string, entry T) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.load()
+	c.entries[key] = entry
+
+	contents, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(GetApplicationPath(c.file), contents, 0644)
+}
+
+// load reads the cache from disk once. A missing or damaged file results in
+// an empty cache that will be overwritten.
+func (c *fileCache[T]) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	contents, err := os.ReadFile(GetApplicationPath(c.file))
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(contents, &c.entries)
+}
@@ -3,7 +3,11 @@ package lastfm
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"npoleon/internal/credentials"
 	"npoleon/internal/nporadio"
+	"npoleon/internal/rewriting"
+	"npoleon/internal/util"
 )
 
 // ----------------------------------------------------------------------------
@@ -12,14 +16,27 @@ type ClientInterface interface {
 	GetAuthTokenUrl() (string, string, error)
 	Login(token string) error
 	ResumeSession()
+	VerifySession() (string, error)
 	Scrobble(track nporadio.Track) error
+	Skip(track nporadio.Track, reason string) error
+	Enrich(track nporadio.Track) nporadio.Track
+	Prefetch(tracks []nporadio.Track)
+	WithRules(rules rewriting.Rules) ClientInterface
+	WithFeaturingStrategy(strategy rewriting.FeaturingStrategy) ClientInterface
+	WithDryRun(dryRun bool) ClientInterface
 }
 
 // ----------------------------------------------------------------------------
 
 type Client struct {
-	api        ApiInterface
-	sessionKey string
+	api         ApiInterface
+	sessionKey  string
+	featuring   rewriting.FeaturingStrategy
+	rules       rewriting.Rules
+	dryRun      bool
+	credentials credentials.Store
+	corrections *fileCache[correction]
+	trackInfo   *fileCache[trackInfo]
 }
 
 // ----------------------------------------------------------------------------
@@ -40,10 +57,16 @@ func (c Client) Login(token string) error {
 	}
 
 	c.sessionKey = c.api.GetSessionKey()
-	return appendToFile("LASTFM_SESSION_KEY="+c.sessionKey, "config")
+	return c.credentials.Set(credentials.SessionKey, c.sessionKey)
 }
 
 func (c Client) Scrobble(track nporadio.Track) error {
+	lock, err := lockLogs()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	isScrobbled, err := hasBeenScrobbled(track)
 
 	if err != nil {
@@ -54,43 +77,145 @@ func (c Client) Scrobble(track nporadio.Track) error {
 		return nil
 	}
 
+	isIgnored, err := hasBeenIgnored(track)
+	if err != nil {
+		return err
+	}
+
+	if isIgnored {
+		return ErrIgnoredBefore
+	}
+
+	original := track
+	track = c.featuring.Apply(track)
+	normalized := track
+	track, applied := c.rules.Apply(track)
 	track = c.correctTrack(track)
-	_, err = c.api.ScrobbleTrack(track.Artist, track.Title, track.PlayedAt)
+	track = c.addTrackInfo(track)
+
+	if c.dryRun {
+		slog.Info("Would scrobble "+track.String(), "play", track)
+		if normalized != original {
+			slog.Info(fmt.Sprintf("  normalized featured artists (%s): %s – %s", c.featuring, normalized.Artist, normalized.Title))
+		}
+		for _, rule := range applied {
+			slog.Info("  applied " + rule.String())
+		}
+		return nil
+	}
+
+	res, err := c.api.ScrobbleTrack(track)
 
 	if err != nil {
 		return errors.New("failed to scrobble " + track.String())
 	}
 
+	var ignored IgnoredError
+	if err = findIgnoredError(track, res); errors.As(err, &ignored) {
+		// Recorded like a scrobble, so that the play isn't submitted again
+		if logErr := logIgnored(track, ignored); logErr != nil {
+			return errors.New("failed to record that Last.fm ignored " + track.String())
+		}
+		return err
+	}
+
 	err = logScrobble(track)
 
 	if err != nil {
 		return errors.New("failed to record scrobble of " + track.String())
 	}
 
-	fmt.Println("Scrobbled", track.String())
+	if track.IsImported() {
+		slog.Info(
+			fmt.Sprintf("Imported %s as %s", track.String(), util.FormatTime(track.ScrobbleTime())),
+			"play", track,
+			"scrobbled_at", track.ScrobbleTime(),
+		)
+		return nil
+	}
+
+	slog.Info("Scrobbled "+track.String(), "play", track)
+	return nil
+}
+
+func (c Client) WithRules(rules rewriting.Rules) ClientInterface {
+	c.rules = rules
+	return c
+}
+
+func (c Client) WithFeaturingStrategy(strategy rewriting.FeaturingStrategy) ClientInterface {
+	c.featuring = strategy
+	return c
+}
+
+func (c Client) WithDryRun(dryRun bool) ClientInterface {
+	c.dryRun = dryRun
+	return c
+}
+
+func (c Client) Skip(track nporadio.Track, reason string) error {
+	lock, err := lockLogs()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	isSkipped, err := hasBeenSkipped(track)
+	if err != nil {
+		return err
+	}
+
+	if isSkipped {
+		return nil
+	}
+
+	if c.dryRun {
+		slog.Info("Would skip "+track.String()+": "+reason, "play", track, "reason", reason)
+		return nil
+	}
+
+	if err = logSkip(track, reason); err != nil {
+		return errors.New("failed to record skip of " + track.String())
+	}
+
+	slog.Info("Skipped "+track.String()+": "+reason, "play", track, "reason", reason)
 	return nil
 }
 
 func (c Client) correctTrack(track nporadio.Track) nporadio.Track {
-	res, _ := c.api.GetCorrection(track.Artist, track.Title)
+	if cached, exists := c.corrections.get(trackKey(track.Artist, track.Title)); exists {
+		track.Artist = cached.Artist
+		track.Title = cached.Title
+		return track
+	}
+
+	res, err := c.api.GetCorrection(track.Artist, track.Title)
+	if err != nil {
+		// Try again next time, the correction service is not essential
+		return track
+	}
 
-	if res.Correction.TrackCorrected == "1" || res.Correction.ArtistCorrected == "1" {
-		track.Artist = res.Correction.Track.Artist.Name
-		track.Title = res.Correction.Track.Name
+	// lastfm-go expects the corrected flags as elements, but Last.fm sends
+	// them as attributes, so rely on the corrected names instead
+	entry := correction{Artist: track.Artist, Title: track.Title}
+	corrected := res.Correction.Track
+	if corrected.Name != "" && corrected.Artist.Name != "" {
+		entry.Artist = corrected.Artist.Name
+		entry.Title = corrected.Name
 	}
+	_ = c.corrections.put(trackKey(track.Artist, track.Title), entry)
 
+	track.Artist = entry.Artist
+	track.Title = entry.Title
 	return track
 }
 
 // ----------------------------------------------------------------------------
 
+// CreateAuthenticatedClient stores the session key in the config file when
+// logging in. Use CreateClientFromStore to keep it somewhere safer.
 func CreateAuthenticatedClient(key string, secret string, session string) (ClientInterface, error) {
-	client := Client{
-		api:        CreateApi(key, secret),
-		sessionKey: session,
-	}
-	client.ResumeSession()
-	return client, nil
+	return createClient(key, secret, session, credentials.CreateConfigFile(GetApplicationPath("config"))), nil
 }
 
 func CreateClient(key string, secret string) (ClientInterface, error) {
@@ -101,16 +226,69 @@ func CreateClient(key string, secret string) (ClientInterface, error) {
 	return CreateAuthenticatedClient(key, secret, "")
 }
 
+// CreateClientFromStore reads the secret and session key from the credential
+// store, or from the config file if they have not been stored. The API key is
+// read in the same way if it is empty.
+func CreateClientFromStore(store credentials.Store, apiKey string) (ClientInterface, error) {
+	values := map[string]string{credentials.ApiKey: apiKey}
+	for _, name := range []string{credentials.ApiKey, credentials.ApiSecret, credentials.SessionKey} {
+		if values[name] != "" {
+			continue
+		}
+
+		value, err := credentials.Lookup(store, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from the %s: %w", name, store.Describe(), err)
+		}
+		values[name] = value
+	}
+
+	if values[credentials.ApiKey] == "" || values[credentials.ApiSecret] == "" {
+		return nil, errors.New("please set LASTFM_API_KEY and LASTFM_API_SECRET before continuing")
+	}
+
+	return createClient(
+		values[credentials.ApiKey],
+		values[credentials.ApiSecret],
+		values[credentials.SessionKey],
+		store,
+	), nil
+}
+
+func createClient(key string, secret string, session string, store credentials.Store) Client {
+	client := Client{
+		api:         CreateApi(key, secret),
+		sessionKey:  session,
+		credentials: store,
+		corrections: newCorrectionCache(),
+		trackInfo:   newTrackInfoCache(),
+	}
+	client.ResumeSession()
+	return client
+}
+
 func (c Client) ResumeSession() {
 	if c.sessionKey != "" {
 		c.api.SetSession(c.sessionKey)
 	}
 }
 
+// VerifySession asks Last.fm who is logged in, and returns the name of the
+// user. It fails if the session key has been revoked.
+func (c Client) VerifySession() (string, error) {
+	if c.sessionKey == "" {
+		return "", errors.New("you are not logged in")
+	}
+	return c.api.GetUser()
+}
+
 // ----------------------------------------------------------------------------
 
 func CreateTestClient(api FakeApi) ClientInterface {
 	return Client{
-		api: &api,
+		api:         &api,
+		credentials: credentials.CreateConfigFile(GetApplicationPath("config")),
+		corrections: newCorrectionCache(),
+		trackInfo:   newTrackInfoCache(),
 	}
 }
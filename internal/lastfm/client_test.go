@@ -1,11 +1,15 @@
 package lastfm
 
 import (
+	"encoding/xml"
 	"errors"
 	"github.com/google/uuid"
+	"github.com/shkh/lastfm-go/lastfm"
+	"npoleon/internal/credentials"
 	"npoleon/internal/nporadio"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -65,6 +69,40 @@ func TestCreateAuthenticatedClient(t *testing.T) {
 	}
 }
 
+func TestCreateClientFromStore(t *testing.T) {
+	// > Arrange
+	dir := createTestFile(".npoleon/config", "LASTFM_API_KEY=key\n")
+	defer os.RemoveAll(dir)
+
+	api := &FakeApi{SessionKey: "n3wsess10n"}
+	var secret string
+	CreateApi = func(key string, s string) ApiInterface {
+		secret = s
+		return api
+	}
+	store := credentials.CreateKeyFile(dir+"credentials", dir+"credentials.key")
+	_ = store.Set(credentials.ApiSecret, "s3cr3t")
+
+	// > Act
+	client, err := CreateClientFromStore(store, "key")
+	if err != nil {
+		t.Fatalf("Creating client failed: %v", err)
+	}
+	err = client.Login("token")
+
+	// > Assert
+	if err != nil || secret != "s3cr3t" {
+		t.Errorf("Expected secret to be read from store, got '%v' (%v)", secret, err)
+	}
+	if session, _ := store.Get(credentials.SessionKey); session != "n3wsess10n" {
+		t.Errorf("Expected session key in store, got '%v'", session)
+	}
+	contents, _ := os.ReadFile(dir + ".npoleon/config")
+	if string(contents) != "LASTFM_API_KEY=key\n" {
+		t.Errorf("Expected config to be left alone, got '%v'", string(contents))
+	}
+}
+
 func TestClient_Login(t *testing.T) {
 	t.Run("Login successful", func(t *testing.T) {
 		// > Arrange
@@ -138,3 +176,179 @@ func TestClient_Scrobble(t *testing.T) {
 		}
 	})
 }
+
+func TestClient_Scrobble_Ignored(t *testing.T) {
+	// > Arrange
+	dir := createTestFile(".npoleon/config", "")
+	defer os.RemoveAll(dir)
+
+	var result ScrobbleResult
+	_ = xml.Unmarshal([]byte(`
+		<scrobbles accepted="0" ignored="1">
+			<scrobble>
+				<track corrected="0">Zij gelooft in mij</track>
+				<artist corrected="0">André Hazes</artist>
+				<ignoredMessage code="3">Timestamp was too old</ignoredMessage>
+			</scrobble>
+		</scrobbles>`), &result)
+
+	client := CreateTestClient(FakeApi{ScrobbleTrackResult: result})
+	track := nporadio.Track{
+		Id:       uuid.New(),
+		Artist:   "André Hazes",
+		Title:    "Zij gelooft in mij",
+		PlayedAt: time.Now().AddDate(0, -1, 0),
+	}
+
+	// > Act
+	err := client.Scrobble(track)
+
+	// > Assert
+	var ignored IgnoredError
+	if !errors.As(err, &ignored) || ignored.Code != TimestampTooOld {
+		t.Errorf("Expected track to be ignored because it is too old, got %v", err)
+	}
+	if res, _ := hasBeenScrobbled(track); res {
+		t.Errorf("Ignored track should not have been recorded as scrobbled")
+	}
+}
+
+func TestClient_Scrobble_Corrections(t *testing.T) {
+	// > Arrange
+	dir := createTestFile(".npoleon/config", "")
+	defer os.RemoveAll(dir)
+
+	var correction lastfm.TrackGetCorrection
+	_ = xml.Unmarshal([]byte(`
+		<corrections>
+			<correction index="0" artistcorrected="1" trackcorrected="0">
+				<track><name>Halo</name><artist><name>Beyoncé</name></artist></track>
+			</correction>
+		</corrections>`), &correction)
+
+	api := &FakeApi{GetCorrectionResult: &correction}
+	CreateApi = func(key string, secret string) ApiInterface {
+		return api
+	}
+	client, _ := CreateAuthenticatedClient("key", "secret", "session")
+
+	// > Act
+	for i := 0; i < 2; i++ {
+		_ = client.Scrobble(nporadio.Track{
+			Id:       uuid.New(),
+			Artist:   "Beyonce",
+			Title:    "Halo",
+			PlayedAt: time.Now().Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	// > Assert
+	if api.GetCorrectionCalls != 1 {
+		t.Errorf("Expected 1 correction lookup, got %v", api.GetCorrectionCalls)
+	}
+	contents, _ := os.ReadFile(dir + ".npoleon/corrections.json")
+	if !strings.Contains(string(contents), "Beyoncé") {
+		t.Errorf("Correction was not cached, found '%v'", string(contents))
+	}
+}
+
+func TestClient_Scrobble_DryRun(t *testing.T) {
+	// > Arrange
+	dir := createTestFile(".npoleon/config", "")
+	defer os.RemoveAll(dir)
+
+	api := &FakeApi{}
+	CreateApi = func(key string, secret string) ApiInterface {
+		return api
+	}
+	client, _ := CreateAuthenticatedClient("key", "secret", "session")
+	client = client.WithDryRun(true)
+	track := nporadio.Track{
+		Id:       uuid.New(),
+		Artist:   "Kraftwerk",
+		Title:    "Das Model",
+		PlayedAt: time.Now(),
+	}
+
+	// > Act
+	err := client.Scrobble(track)
+
+	// > Assert
+	if err != nil {
+		t.Errorf("Dry run failed: %v", err)
+	}
+	if api.ScrobbleTrackCalls != 0 {
+		t.Errorf("Dry run should not submit scrobbles")
+	}
+	if res, _ := hasBeenScrobbled(track); res {
+		t.Errorf("Dry run should not record scrobbles")
+	}
+}
+
+func TestClient_Scrobble_Concurrently(t *testing.T) {
+	// > Arrange
+	dir := createTestFile(".npoleon/config", "")
+	defer os.RemoveAll(dir)
+
+	api := &FakeApi{ScrobbleTrackDelay: 50 * time.Millisecond}
+	CreateApi = func(key string, secret string) ApiInterface {
+		return api
+	}
+	track := nporadio.Track{
+		Id:       uuid.New(),
+		Artist:   "Doe Maar",
+		Title:    "Is dit alles",
+		PlayedAt: time.Now(),
+	}
+
+	// > Act
+	// Two clients scrobble the same play at the same time, as if they were
+	// running in different processes
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, _ := CreateAuthenticatedClient("egg", "shaped", "head")
+			_ = client.Scrobble(track)
+		}()
+	}
+	wg.Wait()
+
+	// > Assert
+	if api.ScrobbleTrackCalls != 1 {
+		t.Errorf("Expected the play to be scrobbled once, got %d", api.ScrobbleTrackCalls)
+	}
+}
+
+func TestClient_VerifySession(t *testing.T) {
+	tests := []struct {
+		name     string
+		session  string
+		api      *FakeApi
+		expected string
+		fails    bool
+	}{
+		{name: "Valid session", session: "farm", api: &FakeApi{GetUserResult: "chun"}, expected: "chun"},
+		{name: "Revoked session", session: "farm", api: &FakeApi{GetUserError: errors.New("Invalid session key")}, fails: true},
+		{name: "Not logged in", api: &FakeApi{GetUserResult: "chun"}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// > Arrange
+			CreateApi = func(key string, secret string) ApiInterface {
+				return test.api
+			}
+			client, _ := CreateAuthenticatedClient("alien", "ant", test.session)
+
+			// > Act
+			name, err := client.VerifySession()
+
+			// > Assert
+			if (err != nil) != test.fails || name != test.expected {
+				t.Errorf("Expected %q (fails: %v), got %q (%v)", test.expected, test.fails, name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package lastfm
+
+type correction struct {
+	Artist string `json:"artist"`
+	Title  string `json:"title"`
+}
+
+// The outcome of track.getCorrection is cached, so that each artist and title
+// combination only needs to be looked up once
+func newCorrectionCache() *fileCache[correction] {
+	return newFileCache[correction]("corrections.json")
+}
+
+func trackKey(artist string, title string) string {
+	return artist + "\x00" + title
+}
@@ -0,0 +1,121 @@
+package lastfm
+
+import (
+	"errors"
+	"github.com/shkh/lastfm-go/lastfm"
+	"npoleon/internal/nporadio"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Last.fm error code for tracks that it does not know about
+const errorTrackNotFound = 6
+
+type trackInfo struct {
+	Album    string        `json:"album,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Mbid     string        `json:"mbid,omitempty"`
+}
+
+func newTrackInfoCache() *fileCache[trackInfo] {
+	return newFileCache[trackInfo]("track-info.json")
+}
+
+// maxConcurrentLookups is how many tracks Prefetch looks up on Last.fm at the
+// same time
+const maxConcurrentLookups = 4
+
+// Enrich adds the duration, album and MBID that Last.fm knows of a track. The
+// track is looked up under the name with which it would be scrobbled, but is
+// returned with its original name. Tracks that cannot be looked up are
+// returned as-is.
+func (c Client) Enrich(track nporadio.Track) nporadio.Track {
+	renamed := c.rename(track)
+	enriched := c.addTrackInfo(renamed)
+
+	track.Album = enriched.Album
+	track.Duration = enriched.Duration
+	track.Mbid = enriched.Mbid
+	return track
+}
+
+// Prefetch looks up the corrections and information of tracks that are about
+// to be scrobbled, a few at a time, so that Scrobble finds them in the cache
+func (c Client) Prefetch(tracks []nporadio.Track) {
+	queue := make(chan nporadio.Track)
+	var wg sync.WaitGroup
+	for worker := 0; worker < maxConcurrentLookups; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for track := range queue {
+				c.addTrackInfo(c.rename(track))
+			}
+		}()
+	}
+
+	// Tracks are played more than once in a longer backfill
+	seen := make(map[string]bool)
+	for _, track := range tracks {
+		key := trackKey(track.Artist, track.Title)
+		if !seen[key] {
+			seen[key] = true
+			queue <- track
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// rename applies the featuring strategy, rules and corrections, which
+// determine the name under which a track is scrobbled
+func (c Client) rename(track nporadio.Track) nporadio.Track {
+	track = c.featuring.Apply(track)
+	track, _ = c.rules.Apply(track)
+	return c.correctTrack(track)
+}
+
+func (c Client) addTrackInfo(track nporadio.Track) nporadio.Track {
+	key := trackKey(track.Artist, track.Title)
+
+	info, exists := c.trackInfo.get(key)
+	if !exists {
+		res, err := c.api.GetInfo(track.Artist, track.Title)
+
+		var lastfmErr *lastfm.LastfmError
+		if errors.As(err, &lastfmErr) && lastfmErr.Code == errorTrackNotFound {
+			_ = c.trackInfo.put(key, trackInfo{})
+			return track
+		}
+		if err != nil {
+			return track
+		}
+
+		info = convertTrackInfo(res)
+		_ = c.trackInfo.put(key, info)
+	}
+
+	if track.Album == "" {
+		track.Album = info.Album
+	}
+	if track.Duration == 0 {
+		track.Duration = info.Duration
+	}
+	if track.Mbid == "" {
+		track.Mbid = info.Mbid
+	}
+
+	return track
+}
+
+func convertTrackInfo(res lastfm.TrackGetInfo) trackInfo {
+	// Last.fm reports durations in milliseconds, or 0 if it does not know
+	milliseconds, _ := strconv.Atoi(res.Duration)
+
+	return trackInfo{
+		Album:    res.Album.Title,
+		Duration: time.Duration(milliseconds) * time.Millisecond,
+		Mbid:     res.Mbid,
+	}
+}
@@ -0,0 +1,76 @@
+package lastfm
+
+import (
+	"encoding/xml"
+	"github.com/shkh/lastfm-go/lastfm"
+	"npoleon/internal/nporadio"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClient_Enrich(t *testing.T) {
+	// > Arrange
+	dir := createTestFile(".npoleon/config", "")
+	defer os.RemoveAll(dir)
+
+	var info lastfm.TrackGetInfo
+	_ = xml.Unmarshal([]byte(`
+		<track>
+			<name>Bohemian Rhapsody</name>
+			<mbid>b1a9c0e9-d987-4042-ae91-78d6a3267d69</mbid>
+			<duration>354000</duration>
+			<artist><name>Queen</name></artist>
+			<album position="11"><artist>Queen</artist><title>A Night at the Opera</title></album>
+		</track>`), &info)
+
+	api := &FakeApi{GetInfoResult: &info}
+	CreateApi = func(key string, secret string) ApiInterface {
+		return api
+	}
+	client, _ := CreateAuthenticatedClient("key", "secret", "session")
+	track := nporadio.Track{Artist: "Queen", Title: "Bohemian Rhapsody"}
+
+	// > Act
+	res := client.Enrich(track)
+	_ = client.Enrich(track)
+
+	// > Assert
+	if res.Duration != 354*time.Second {
+		t.Errorf("Expected duration of 5:54, got %v", res.Duration)
+	}
+	if res.Album != "A Night at the Opera" {
+		t.Errorf("Expected album 'A Night at the Opera', got '%v'", res.Album)
+	}
+	if res.Mbid != "b1a9c0e9-d987-4042-ae91-78d6a3267d69" {
+		t.Errorf("Expected MBID to be set, got '%v'", res.Mbid)
+	}
+	if api.GetInfoCalls != 1 {
+		t.Errorf("Expected 1 track info lookup, got %v", api.GetInfoCalls)
+	}
+}
+
+func TestClient_Enrich_Failure(t *testing.T) {
+	// > Arrange
+	dir := createTestFile(".npoleon/config", "")
+	defer os.RemoveAll(dir)
+
+	api := &FakeApi{}
+	CreateApi = func(key string, secret string) ApiInterface {
+		return api
+	}
+	client, _ := CreateAuthenticatedClient("key", "secret", "session")
+	track := nporadio.Track{Artist: "Ome Henk", Title: "Opblaaskrokodil"}
+
+	// > Act
+	res := client.Enrich(track)
+	_ = client.Enrich(track)
+
+	// > Assert
+	if res != track {
+		t.Errorf("Track should not have been changed")
+	}
+	if api.GetInfoCalls != 2 {
+		t.Errorf("Failed lookups should be retried, got %v lookups", api.GetInfoCalls)
+	}
+}
@@ -0,0 +1,504 @@
+// Package fakeserver imitates version 2.0 of the Last.fm API, so that
+// lastfm.Api can be tested without the internet or a Last.fm account. Point
+// the API at its URL with lastfm.CreateApiWithBaseUrl.
+package fakeserver
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"npoleon/internal/clock"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Last.fm only accepts this many scrobbles per request
+const maxBatchSize = 50
+
+// Last.fm ignores scrobbles that are older than two weeks, or from the future
+const acceptanceWindow = 14 * 24 * time.Hour
+const maxClockSkew = time.Hour
+
+// Error codes as documented by Last.fm
+const (
+	errorInvalidMethod     = 3
+	errorInvalidToken      = 4
+	errorInvalidParameters = 6
+	errorInvalidSessionKey = 9
+	errorInvalidApiKey     = 10
+	errorInvalidSignature  = 13
+	errorUnauthorizedToken = 14
+)
+
+type Scrobble struct {
+	Artist       string
+	Track        string
+	Timestamp    time.Time
+	Album        string
+	AlbumArtist  string
+	Duration     time.Duration
+	Mbid         string
+	ChosenByUser bool
+	IgnoredCode  int
+}
+
+type NowPlaying struct {
+	Artist      string
+	Track       string
+	Album       string
+	AlbumArtist string
+	Duration    time.Duration
+}
+
+type correction struct {
+	artist string
+	title  string
+}
+
+type TrackInfo struct {
+	Album    string
+	Duration time.Duration
+	Mbid     string
+}
+
+type Server struct {
+	URL string
+
+	server      *httptest.Server
+	clock       clock.Clock
+	apiKey      string
+	secret      string
+	mutex       sync.Mutex
+	tokens      map[string]bool
+	sessions    map[string]bool
+	corrections map[string]correction
+	trackInfo   map[string]TrackInfo
+	ignored     map[string]bool
+	scrobbles   []Scrobble
+	nowPlaying  []NowPlaying
+	requests    []string
+}
+
+// Start creates a server that only accepts requests that are signed with the
+// given API key and secret
+func Start(clock clock.Clock, apiKey string, secret string) *Server {
+	s := &Server{
+		clock:       clock,
+		apiKey:      apiKey,
+		secret:      secret,
+		tokens:      make(map[string]bool),
+		sessions:    make(map[string]bool),
+		corrections: make(map[string]correction),
+		trackInfo:   make(map[string]TrackInfo),
+		ignored:     make(map[string]bool),
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// AuthorizeToken does what a user does by allowing the application access to
+// their account in a browser
+func (s *Server) AuthorizeToken(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens[token] = true
+}
+
+// AddSession makes the server accept a session key without logging in
+func (s *Server) AddSession(sessionKey string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sessions[sessionKey] = true
+}
+
+func (s *Server) SetCorrection(artist string, title string, correctedArtist string, correctedTitle string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.corrections[key(artist, title)] = correction{artist: correctedArtist, title: correctedTitle}
+}
+
+func (s *Server) SetTrackInfo(artist string, title string, info TrackInfo) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.trackInfo[key(artist, title)] = info
+}
+
+// IgnoreArtist makes the server ignore all scrobbles of an artist, like it
+// does for artists that fail Last.fm's filters
+func (s *Server) IgnoreArtist(artist string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ignored[strings.ToLower(artist)] = true
+}
+
+// Scrobbles returns all submitted scrobbles, including ignored ones
+func (s *Server) Scrobbles() []Scrobble {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Scrobble{}, s.scrobbles...)
+}
+
+func (s *Server) NowPlaying() []NowPlaying {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]NowPlaying{}, s.nowPlaying...)
+}
+
+// Requests returns the API methods that were called, in order
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func key(artist string, title string) string {
+	return strings.ToLower(artist) + "\n" + strings.ToLower(title)
+}
+
+// ----------------------------------------------------------------------------
+
+type apiError struct {
+	code    int
+	message string
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := r.Form
+	method := strings.ToLower(params.Get("method"))
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, method)
+	s.mutex.Unlock()
+
+	var inner string
+	var err *apiError
+
+	switch method {
+	case "auth.gettoken":
+		inner, err = s.getToken(params)
+	case "auth.getsession":
+		inner, err = s.getSession(params)
+	case "track.getcorrection":
+		inner, err = s.getCorrection(params)
+	case "track.getinfo":
+		inner, err = s.getInfo(params)
+	case "track.scrobble":
+		inner, err = s.scrobble(params)
+	case "track.updatenowplaying":
+		inner, err = s.updateNowPlaying(params)
+	default:
+		err = &apiError{errorInvalidMethod, "Invalid Method - No method with that name in this package"}
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	if err != nil {
+		_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<lfm status="failed"><error code="%d">%s</error></lfm>`, err.code, escape(err.message))
+		return
+	}
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<lfm status="ok">%s</lfm>`, inner)
+}
+
+func (s *Server) checkApiKey(params url.Values) *apiError {
+	if params.Get("api_key") != s.apiKey {
+		return &apiError{errorInvalidApiKey, "Invalid API key - You must be granted a valid key by last.fm"}
+	}
+	return nil
+}
+
+// checkSignature verifies api_sig, which is the MD5 hash of all parameters
+// sorted by name, followed by the secret
+func (s *Server) checkSignature(params url.Values) *apiError {
+	if err := s.checkApiKey(params); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range params {
+		if name != "api_sig" && name != "format" && name != "callback" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var plain strings.Builder
+	for _, name := range names {
+		plain.WriteString(name + params.Get(name))
+	}
+	plain.WriteString(s.secret)
+
+	hash := md5.Sum([]byte(plain.String()))
+	if params.Get("api_sig") != hex.EncodeToString(hash[:]) {
+		return &apiError{errorInvalidSignature, "Invalid method signature supplied"}
+	}
+	return nil
+}
+
+func (s *Server) checkSession(params url.Values) *apiError {
+	if err := s.checkSignature(params); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.sessions[params.Get("sk")] {
+		return &apiError{errorInvalidSessionKey, "Invalid session key - Please re-authenticate"}
+	}
+	return nil
+}
+
+func (s *Server) getToken(params url.Values) (string, *apiError) {
+	if err := s.checkApiKey(params); err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token := fmt.Sprintf("token%d", len(s.tokens)+1)
+	s.tokens[token] = false
+	return "<token>" + token + "</token>", nil
+}
+
+func (s *Server) getSession(params url.Values) (string, *apiError) {
+	if err := s.checkSignature(params); err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token := params.Get("token")
+	authorized, exists := s.tokens[token]
+	if !exists {
+		return "", &apiError{errorInvalidToken, "Invalid authentication token supplied"}
+	}
+	if !authorized {
+		return "", &apiError{errorUnauthorizedToken, "Unauthorized Token - This token has not been authorized"}
+	}
+
+	// Tokens can only be used once
+	delete(s.tokens, token)
+	sessionKey := fmt.Sprintf("session%d", len(s.sessions)+1)
+	s.sessions[sessionKey] = true
+
+	return "<session><name>npoleon</name><key>" + sessionKey + "</key><subscriber>0</subscriber></session>", nil
+}
+
+func (s *Server) getCorrection(params url.Values) (string, *apiError) {
+	if err := s.checkApiKey(params); err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	corrected, exists := s.corrections[key(params.Get("artist"), params.Get("track"))]
+	s.mutex.Unlock()
+
+	if !exists {
+		return "<corrections></corrections>", nil
+	}
+
+	return fmt.Sprintf(
+		`<corrections><correction index="0" artistcorrected="%d" trackcorrected="%d">`+
+			`<track><name>%s</name><mbid></mbid><url></url><artist><name>%s</name><mbid></mbid><url></url></artist></track>`+
+			`</correction></corrections>`,
+		flag(corrected.artist != params.Get("artist")),
+		flag(corrected.title != params.Get("track")),
+		escape(corrected.title),
+		escape(corrected.artist),
+	), nil
+}
+
+func (s *Server) getInfo(params url.Values) (string, *apiError) {
+	if err := s.checkApiKey(params); err != nil {
+		return "", err
+	}
+
+	artist, title := params.Get("artist"), params.Get("track")
+
+	s.mutex.Lock()
+	if corrected, exists := s.corrections[key(artist, title)]; exists && params.Get("autocorrect") == "1" {
+		artist, title = corrected.artist, corrected.title
+	}
+	info, exists := s.trackInfo[key(artist, title)]
+	s.mutex.Unlock()
+
+	if !exists {
+		return "", &apiError{errorInvalidParameters, "Track not found"}
+	}
+
+	return fmt.Sprintf(
+		`<track><name>%s</name><mbid>%s</mbid><duration>%d</duration><artist><name>%s</name></artist><album><title>%s</title></album></track>`,
+		escape(title),
+		escape(info.Mbid),
+		info.Duration.Milliseconds(),
+		escape(artist),
+		escape(info.Album),
+	), nil
+}
+
+// scrobble accepts both a single scrobble, e.g. artist=..., and a batch, e.g.
+// artist[0]=...&artist[1]=...
+func (s *Server) scrobble(params url.Values) (string, *apiError) {
+	if err := s.checkSession(params); err != nil {
+		return "", err
+	}
+
+	var scrobbles []Scrobble
+	if params.Has("artist") {
+		scrobble, err := s.parseScrobble(params, "")
+		if err != nil {
+			return "", err
+		}
+		scrobbles = append(scrobbles, scrobble)
+	}
+	for idx := 0; idx < maxBatchSize; idx++ {
+		suffix := fmt.Sprintf("[%d]", idx)
+		if !params.Has("artist" + suffix) {
+			break
+		}
+		scrobble, err := s.parseScrobble(params, suffix)
+		if err != nil {
+			return "", err
+		}
+		scrobbles = append(scrobbles, scrobble)
+	}
+	if len(scrobbles) == 0 {
+		return "", &apiError{errorInvalidParameters, "Invalid parameters - Your request is missing a required parameter"}
+	}
+
+	var accepted, ignored int
+	var body strings.Builder
+	for idx := range scrobbles {
+		scrobble := &scrobbles[idx]
+		message := s.ignoreReason(scrobble)
+		if scrobble.IgnoredCode == 0 {
+			accepted++
+		} else {
+			ignored++
+		}
+
+		body.WriteString(fmt.Sprintf(
+			`<scrobble><track corrected="0">%s</track><artist corrected="0">%s</artist>`+
+				`<album corrected="0">%s</album><albumArtist corrected="0">%s</albumArtist>`+
+				`<timestamp>%d</timestamp><ignoredMessage code="%d">%s</ignoredMessage></scrobble>`,
+			escape(scrobble.Track),
+			escape(scrobble.Artist),
+			escape(scrobble.Album),
+			escape(scrobble.AlbumArtist),
+			scrobble.Timestamp.Unix(),
+			scrobble.IgnoredCode,
+			escape(message),
+		))
+	}
+
+	s.mutex.Lock()
+	s.scrobbles = append(s.scrobbles, scrobbles...)
+	s.mutex.Unlock()
+
+	return fmt.Sprintf(`<scrobbles accepted="%d" ignored="%d">%s</scrobbles>`, accepted, ignored, body.String()), nil
+}
+
+func (s *Server) parseScrobble(params url.Values, suffix string) (Scrobble, *apiError) {
+	timestamp, err := strconv.ParseInt(params.Get("timestamp"+suffix), 10, 64)
+	if err != nil || params.Get("track"+suffix) == "" {
+		return Scrobble{}, &apiError{errorInvalidParameters, "Invalid parameters - Your request is missing a required parameter"}
+	}
+	duration, _ := strconv.Atoi(params.Get("duration" + suffix))
+
+	return Scrobble{
+		Artist:       params.Get("artist" + suffix),
+		Track:        params.Get("track" + suffix),
+		Timestamp:    time.Unix(timestamp, 0),
+		Album:        params.Get("album" + suffix),
+		AlbumArtist:  params.Get("albumArtist" + suffix),
+		Duration:     time.Duration(duration) * time.Second,
+		Mbid:         params.Get("mbid" + suffix),
+		ChosenByUser: params.Get("chosenByUser"+suffix) == "1",
+	}, nil
+}
+
+// ignoreReason sets the code with which Last.fm would ignore the scrobble, and
+// returns the accompanying message
+func (s *Server) ignoreReason(scrobble *Scrobble) string {
+	s.mutex.Lock()
+	artistIgnored := s.ignored[strings.ToLower(scrobble.Artist)]
+	s.mutex.Unlock()
+
+	now := s.clock.Now()
+	switch {
+	case artistIgnored:
+		scrobble.IgnoredCode = 1
+		return "Artist name failed filter"
+	case scrobble.Timestamp.Before(now.Add(-acceptanceWindow)):
+		scrobble.IgnoredCode = 3
+		return "Timestamp too old"
+	case scrobble.Timestamp.After(now.Add(maxClockSkew)):
+		scrobble.IgnoredCode = 4
+		return "Timestamp too new"
+	}
+	return ""
+}
+
+func (s *Server) updateNowPlaying(params url.Values) (string, *apiError) {
+	if err := s.checkSession(params); err != nil {
+		return "", err
+	}
+	if params.Get("artist") == "" || params.Get("track") == "" {
+		return "", &apiError{errorInvalidParameters, "Invalid parameters - Your request is missing a required parameter"}
+	}
+
+	duration, _ := strconv.Atoi(params.Get("duration"))
+	nowPlaying := NowPlaying{
+		Artist:      params.Get("artist"),
+		Track:       params.Get("track"),
+		Album:       params.Get("album"),
+		AlbumArtist: params.Get("albumArtist"),
+		Duration:    time.Duration(duration) * time.Second,
+	}
+
+	s.mutex.Lock()
+	s.nowPlaying = append(s.nowPlaying, nowPlaying)
+	s.mutex.Unlock()
+
+	return fmt.Sprintf(
+		`<nowplaying><track corrected="0">%s</track><artist corrected="0">%s</artist>`+
+			`<album corrected="0">%s</album><albumArtist corrected="0">%s</albumArtist>`+
+			`<ignoredMessage code="0"></ignoredMessage></nowplaying>`,
+		escape(nowPlaying.Track),
+		escape(nowPlaying.Artist),
+		escape(nowPlaying.Album),
+		escape(nowPlaying.AlbumArtist),
+	), nil
+}
+
+func flag(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func escape(text string) string {
+	var res strings.Builder
+	_ = xml.EscapeText(&res, []byte(text))
+	return res.String()
+}
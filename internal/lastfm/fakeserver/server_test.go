@@ -0,0 +1,193 @@
+package fakeserver
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"npoleon/internal/clock"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startServer(t *testing.T) (*Server, clock.Fake) {
+	fakeClock := clock.NewFake(time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC))
+	server := Start(fakeClock, "key", "secret")
+	t.Cleanup(server.Close)
+	return server, fakeClock
+}
+
+type response struct {
+	Error struct {
+		Code int `xml:"code,attr"`
+	} `xml:"error"`
+	Token   string `xml:"token"`
+	Session struct {
+		Key string `xml:"key"`
+	} `xml:"session"`
+	Scrobbles struct {
+		Accepted int        `xml:"accepted,attr"`
+		Ignored  int        `xml:"ignored,attr"`
+		Scrobble []struct{} `xml:"scrobble"`
+	} `xml:"scrobbles"`
+}
+
+// call posts the parameters like a Last.fm client does, signed with the secret
+// and the API key "key"
+func call(t *testing.T, server *Server, secret string, params url.Values) response {
+	t.Helper()
+
+	params.Set("api_key", "key")
+	var names []string
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var plain strings.Builder
+	for _, name := range names {
+		plain.WriteString(name + params.Get(name))
+	}
+	hash := md5.Sum([]byte(plain.String() + secret))
+	params.Set("api_sig", hex.EncodeToString(hash[:]))
+
+	res, err := http.PostForm(server.URL, params)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var body response
+	if err := xml.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("Unexpected response: %v", err)
+	}
+	return body
+}
+
+func expectErrorCode(t *testing.T, res response, code int) {
+	t.Helper()
+
+	if res.Error.Code != code {
+		t.Errorf("Expected error code %v, got %v", code, res.Error.Code)
+	}
+}
+
+func TestServer_Authentication(t *testing.T) {
+	t.Run("Token must be authorized before it can be used", func(t *testing.T) {
+		// > Arrange
+		server, _ := startServer(t)
+		token := call(t, server, "secret", url.Values{"method": {"auth.getToken"}}).Token
+
+		// > Act
+		unauthorized := call(t, server, "secret", url.Values{"method": {"auth.getSession"}, "token": {token}})
+		server.AuthorizeToken(token)
+		res := call(t, server, "secret", url.Values{"method": {"auth.getSession"}, "token": {token}})
+
+		// > Assert
+		expectErrorCode(t, unauthorized, errorUnauthorizedToken)
+		if res.Session.Key == "" {
+			t.Errorf("Expected session key, got error %v", res.Error.Code)
+		}
+	})
+
+	t.Run("Requests signed with the wrong secret are refused", func(t *testing.T) {
+		// > Arrange
+		server, _ := startServer(t)
+		server.AddSession("session")
+
+		// > Act
+		res := call(t, server, "wrong secret", url.Values{
+			"method":    {"track.scrobble"},
+			"sk":        {"session"},
+			"artist":    {"Doe Maar"},
+			"track":     {"Smoorverliefd"},
+			"timestamp": {"1704542400"},
+		})
+
+		// > Assert
+		expectErrorCode(t, res, errorInvalidSignature)
+	})
+
+	t.Run("Unknown session keys are refused", func(t *testing.T) {
+		// > Arrange
+		server, _ := startServer(t)
+
+		// > Act
+		res := call(t, server, "secret", url.Values{
+			"method": {"track.updateNowPlaying"},
+			"sk":     {"unknown"},
+			"artist": {"Doe Maar"},
+			"track":  {"Smoorverliefd"},
+		})
+
+		// > Assert
+		expectErrorCode(t, res, errorInvalidSessionKey)
+	})
+}
+
+func TestServer_Scrobble(t *testing.T) {
+	// > Arrange
+	server, fakeClock := startServer(t)
+	server.AddSession("session")
+	server.IgnoreArtist("Spam")
+	now := fakeClock.Now().Unix()
+	old := fakeClock.Now().AddDate(0, 0, -15).Unix()
+
+	// > Act
+	res := call(t, server, "secret", url.Values{
+		"method":       {"track.scrobble"},
+		"sk":           {"session"},
+		"artist[0]":    {"Doe Maar"},
+		"track[0]":     {"Smoorverliefd"},
+		"timestamp[0]": {itoa(now)},
+		"artist[1]":    {"Spam"},
+		"track[1]":     {"Jingle"},
+		"timestamp[1]": {itoa(now)},
+		"artist[2]":    {"Golden Earring"},
+		"track[2]":     {"Radar Love"},
+		"timestamp[2]": {itoa(old)},
+	})
+
+	// > Assert
+	if res.Error.Code != 0 {
+		t.Fatalf("Scrobbling failed with error %v", res.Error.Code)
+	}
+	if res.Scrobbles.Accepted != 1 || res.Scrobbles.Ignored != 2 || len(res.Scrobbles.Scrobble) != 3 {
+		t.Errorf("Expected 1 accepted and 2 ignored scrobbles, got %v and %v", res.Scrobbles.Accepted, res.Scrobbles.Ignored)
+	}
+	scrobbles := server.Scrobbles()
+	if len(scrobbles) != 3 || scrobbles[0].Track != "Smoorverliefd" || scrobbles[0].Timestamp.Unix() != now {
+		t.Fatalf("Expected scrobbles to be recorded, got %v", scrobbles)
+	}
+	if scrobbles[1].IgnoredCode != 1 || scrobbles[2].IgnoredCode != 3 {
+		t.Errorf("Expected codes 1 and 3, got %v and %v", scrobbles[1].IgnoredCode, scrobbles[2].IgnoredCode)
+	}
+}
+
+func TestServer_UpdateNowPlaying(t *testing.T) {
+	// > Arrange
+	server, _ := startServer(t)
+	server.AddSession("session")
+
+	// > Act
+	res := call(t, server, "secret", url.Values{
+		"method":   {"track.updateNowPlaying"},
+		"sk":       {"session"},
+		"artist":   {"Doe Maar"},
+		"track":    {"Smoorverliefd"},
+		"duration": {"211"},
+	})
+
+	// > Assert
+	nowPlaying := server.NowPlaying()
+	if res.Error.Code != 0 || len(nowPlaying) != 1 || nowPlaying[0].Duration != 211*time.Second {
+		t.Errorf("Expected now playing to be recorded, got %v (error %v)", nowPlaying, res.Error.Code)
+	}
+}
+
+func itoa(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
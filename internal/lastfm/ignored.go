@@ -0,0 +1,60 @@
+package lastfm
+
+import (
+	"errors"
+	"fmt"
+	"npoleon/internal/nporadio"
+	"strings"
+)
+
+type IgnoredCode int
+
+// Codes as documented for the ignoredMessage element of track.scrobble
+const (
+	NotIgnored          IgnoredCode = 0
+	ArtistIgnored       IgnoredCode = 1
+	TrackIgnored        IgnoredCode = 2
+	TimestampTooOld     IgnoredCode = 3
+	TimestampTooNew     IgnoredCode = 4
+	DailyLimitExceeded  IgnoredCode = 5
+	UnknownIgnoreReason IgnoredCode = -1
+)
+
+// ErrIgnoredBefore is returned for plays that Last.fm ignored before. They are
+// not submitted again.
+var ErrIgnoredBefore = errors.New("the play was ignored by Last.fm before")
+
+type IgnoredError struct {
+	Track   nporadio.Track
+	Code    IgnoredCode
+	Message string
+}
+
+func (e IgnoredError) Error() string {
+	return fmt.Sprintf("Last.fm ignored %s: %s (code %d)", e.Track.String(), e.Message, e.Code)
+}
+
+// findIgnoredError returns an IgnoredError with the code and message that
+// Last.fm gave if it ignored the scrobble
+func findIgnoredError(track nporadio.Track, res ScrobbleResult) error {
+	if res.Ignored == 0 {
+		return nil
+	}
+
+	code := UnknownIgnoreReason
+	message := "no reason given"
+	for _, scrobble := range res.Scrobbles {
+		if scrobble.IgnoredMessage.Code != 0 {
+			code = IgnoredCode(scrobble.IgnoredMessage.Code)
+		}
+		if body := strings.TrimSpace(scrobble.IgnoredMessage.Body); body != "" {
+			message = body
+		}
+	}
+
+	return IgnoredError{
+		Track:   track,
+		Code:    code,
+		Message: message,
+	}
+}
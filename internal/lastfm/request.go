@@ -0,0 +1,120 @@
+package lastfm
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/shkh/lastfm-go/lastfm"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// get calls a method that only needs the API key. Errors that Last.fm
+// reports are returned as a *lastfm.LastfmError, like lastfm-go does.
+func (a *Api) get(method string, args map[string]string, result any) error {
+	params := url.Values{}
+	params.Set("method", method)
+	params.Set("api_key", a.key)
+	for name, value := range args {
+		params.Set(name, value)
+	}
+
+	req, err := http.NewRequest("GET", a.baseUrl+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return a.send(method, req, result)
+}
+
+// post calls a method that has to be signed with the secret, and with the
+// session key if withSession is set
+func (a *Api) post(method string, args map[string]string, withSession bool, result any) error {
+	params := map[string]string{
+		"method":  method,
+		"api_key": a.key,
+	}
+	if withSession {
+		if a.sessionKey == "" {
+			return errors.New("not logged in to Last.fm")
+		}
+		params["sk"] = a.sessionKey
+	}
+	for name, value := range args {
+		params[name] = value
+	}
+
+	form := url.Values{}
+	for name, value := range params {
+		form.Set(name, value)
+	}
+	form.Set("api_sig", sign(params, a.secret))
+
+	req, err := http.NewRequest("POST", a.baseUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.send(method, req, result)
+}
+
+func (a *Api) send(method string, req *http.Request, result any) error {
+	req.Header.Set("User-Agent", "npoleon")
+
+	res, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Last.fm explains other errors in the body
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("%s failed: %s", method, res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	return parseResponse(method, body, result)
+}
+
+// sign returns the MD5 hash of all parameters, sorted by name, followed by the
+// secret
+func sign(params map[string]string, secret string) string {
+	var names []string
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := md5.New()
+	for _, name := range names {
+		hash.Write([]byte(name + params[name]))
+	}
+	hash.Write([]byte(secret))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func parseResponse(method string, body []byte, result any) error {
+	var base lastfm.Base
+	if err := xml.Unmarshal(body, &base); err != nil {
+		return fmt.Errorf("unexpected response to %s: %w", method, err)
+	}
+	if base.Status == lastfm.ApiResponseStatusFailed {
+		var apiErr lastfm.ApiError
+		if err := xml.Unmarshal(base.Inner, &apiErr); err != nil {
+			return fmt.Errorf("unexpected error from %s: %w", method, err)
+		}
+		return &lastfm.LastfmError{
+			Code:    apiErr.Code,
+			Message: strings.TrimSpace(apiErr.Message),
+			Caller:  method,
+		}
+	}
+	return xml.Unmarshal(base.Inner, result)
+}
@@ -0,0 +1,20 @@
+package lastfm
+
+import "encoding/xml"
+
+// ScrobbleResult is the response to track.scrobble. lastfm-go leaves out the
+// code attribute of ignoredMessage, which is why Npoleon doesn't use its
+// result.
+type ScrobbleResult struct {
+	XMLName   xml.Name `xml:"scrobbles"`
+	Accepted  int      `xml:"accepted,attr"`
+	Ignored   int      `xml:"ignored,attr"`
+	Scrobbles []struct {
+		Track          string `xml:"track"`
+		Artist         string `xml:"artist"`
+		IgnoredMessage struct {
+			Code int    `xml:"code,attr"`
+			Body string `xml:",chardata"`
+		} `xml:"ignoredMessage"`
+	} `xml:"scrobble"`
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/joho/godotenv"
 	"log"
+	"npoleon/internal/locking"
 	"npoleon/internal/nporadio"
 	"os"
 	"strings"
@@ -14,21 +15,36 @@ var userHomeDir = func() (string, error) {
 }
 
 func Initialize() {
-	dir := getApplicationDir()
+	dir := GetApplicationDir()
 	_ = godotenv.Load(dir + "/config")
 }
 
-func getApplicationDir() string {
+func GetApplicationPath(file string) string {
+	return fmt.Sprintf("%s/%s", GetApplicationDir(), file)
+}
+
+// profile is empty for the default profile. Other profiles have their own
+// directory, so that they have separate credentials and scrobble histories.
+var profile string
+
+func SetProfile(name string) {
+	profile = name
+}
+
+func GetApplicationDir() string {
 	dirname, err := userHomeDir()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if profile != "" {
+		return dirname + "/.npoleon/profiles/" + profile
+	}
 	return dirname + "/.npoleon"
 }
 
 func appendToFile(contents string, file string) error {
-	path := fmt.Sprintf("%s/%s", getApplicationDir(), file)
+	path := fmt.Sprintf("%s/%s", GetApplicationDir(), file)
 
 	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -41,23 +57,60 @@ func appendToFile(contents string, file string) error {
 	return err
 }
 
+// lockLogs takes an advisory lock that other npoleon processes also take
+// before they check whether a play has been scrobbled. It must be held until
+// the scrobble has been recorded, so that two processes that run at the same
+// time, e.g. a backfill and a live session, never scrobble the same play.
+func lockLogs() (*locking.FileLock, error) {
+	return locking.Lock(GetApplicationPath("scrobbles.lock"))
+}
+
+// AcquireInstance prevents more than one npoleon process from running for the
+// current profile at the same time
+func AcquireInstance() (*locking.FileLock, error) {
+	return locking.AcquireInstance(GetApplicationPath("npoleon.pid"))
+}
+
 func hasBeenScrobbled(track nporadio.Track) (bool, error) {
-	date := track.PlayedAt.Format("2006-01-02")
-	path := fmt.Sprintf("%s/%s.log", getApplicationDir(), date)
+	lines, err := readLog(track)
+	if err != nil {
+		return false, err
+	}
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return false, nil
+	for _, line := range lines {
+		if line == track.PlayIdentifier() {
+			return true, nil
+		}
 	}
 
-	content, err := os.ReadFile(path)
+	return false, nil
+}
+
+func hasBeenSkipped(track nporadio.Track) (bool, error) {
+	lines, err := readLog(track)
 	if err != nil {
 		return false, err
 	}
 
-	lines := strings.Split(string(content), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, track.PlayIdentifier()+" skipped") {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// hasBeenIgnored tells whether Last.fm ignored the play before, in which case
+// it would ignore it again
+func hasBeenIgnored(track nporadio.Track) (bool, error) {
+	lines, err := readLog(track)
+	if err != nil {
+		return false, err
+	}
 
 	for _, line := range lines {
-		if line == track.PlayIdentifier() {
+		if strings.HasPrefix(line, track.PlayIdentifier()+" ignored") {
 			return true, nil
 		}
 	}
@@ -65,8 +118,38 @@ func hasBeenScrobbled(track nporadio.Track) (bool, error) {
 	return false, nil
 }
 
+func readLog(track nporadio.Track) ([]string, error) {
+	date := track.PlayedAt.Format("2006-01-02")
+	path := fmt.Sprintf("%s/%s.log", GetApplicationDir(), date)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Split(string(content), "\n"), nil
+}
+
 func logScrobble(track nporadio.Track) error {
 	date := track.PlayedAt.Format("2006-01-02")
 
 	return appendToFile(track.PlayIdentifier(), fmt.Sprintf("%s.log", date))
 }
+
+func logSkip(track nporadio.Track, reason string) error {
+	date := track.PlayedAt.Format("2006-01-02")
+	entry := fmt.Sprintf("%s skipped: %s", track.PlayIdentifier(), reason)
+
+	return appendToFile(entry, fmt.Sprintf("%s.log", date))
+}
+
+func logIgnored(track nporadio.Track, ignored IgnoredError) error {
+	date := track.PlayedAt.Format("2006-01-02")
+	entry := fmt.Sprintf("%s ignored (code %d): %s", track.PlayIdentifier(), ignored.Code, ignored.Message)
+
+	return appendToFile(entry, fmt.Sprintf("%s.log", date))
+}
@@ -163,3 +163,32 @@ func TestHasBeenScrobbled(t *testing.T) {
 		}
 	})
 }
+
+func TestLogSkip(t *testing.T) {
+	// > Arrange
+	dir := createTestFile(".npoleon/config", "")
+	defer os.RemoveAll(dir)
+	playedAt, _ := util.ParseTime("2024-01-01 07:00:00")
+
+	track := nporadio.Track{
+		Id:       uuid.New(),
+		Artist:   "NPO Radio 2",
+		Title:    "Jingle",
+		PlayedAt: playedAt.Time,
+	}
+
+	// > Act
+	_ = logSkip(track, "station jingle")
+
+	// > Assert
+	contents, _ := os.ReadFile(dir + ".npoleon/2024-01-01.log")
+	if string(contents) != track.PlayIdentifier()+" skipped: station jingle\n" {
+		t.Errorf("Log file does not contain expected entry, found '%v'", string(contents))
+	}
+	if res, _ := hasBeenSkipped(track); !res {
+		t.Errorf("Track was not seen as skipped")
+	}
+	if res, _ := hasBeenScrobbled(track); res {
+		t.Errorf("Skipped track is seen as scrobbled")
+	}
+}
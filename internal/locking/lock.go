@@ -0,0 +1,107 @@
+package locking
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned by TryLock when another process holds the lock
+var ErrLocked = errors.New("the file is locked by another process")
+
+// FileLock is an advisory lock on a file. The operating system releases it
+// when the process exits, so a crash never leaves a stale lock behind.
+type FileLock struct {
+	file *os.File
+}
+
+// Lock waits until the lock on the file at path can be taken. The file is
+// created if it doesn't exist yet.
+func Lock(path string) (*FileLock, error) {
+	file, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(file, true); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &FileLock{file: file}, nil
+}
+
+// TryLock takes the lock on the file at path, or returns ErrLocked
+// immediately if another process holds it
+func TryLock(path string) (*FileLock, error) {
+	file, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(file, false); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &FileLock{file: file}, nil
+}
+
+func openLockFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+func (l *FileLock) Unlock() error {
+	if err := unlockFile(l.file); err != nil {
+		_ = l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// InstanceError is returned when another process already holds an instance
+// lock
+type InstanceError struct {
+	Path string
+	Pid  int
+}
+
+func (e *InstanceError) Error() string {
+	if e.Pid == 0 {
+		return fmt.Sprintf("another npoleon process is already running (see %s)", e.Path)
+	}
+	return fmt.Sprintf("another npoleon process is already running (PID %d)", e.Pid)
+}
+
+// AcquireInstance makes sure that only one process at a time holds the lock at
+// path. The process ID of the holder is written to the file, so that it can
+// be named when another process tries to acquire the lock.
+func AcquireInstance(path string) (*FileLock, error) {
+	lock, err := TryLock(path)
+	if errors.Is(err, ErrLocked) {
+		return nil, &InstanceError{Path: path, Pid: readPid(path)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = lock.file.Truncate(0); err == nil {
+		_, err = lock.file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		_ = lock.Unlock()
+		return nil, err
+	}
+	return lock, nil
+}
+
+func readPid(path string) int {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(contents)))
+	return pid
+}
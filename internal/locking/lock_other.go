@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package locking
+
+import "os"
+
+// Other platforms don't support advisory locks, so there is no protection
+// against concurrent processes there
+func lockFile(file *os.File, wait bool) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,89 @@
+package locking
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTryLock(t *testing.T) {
+	// > Arrange
+	path := filepath.Join(t.TempDir(), "nested", "test.lock")
+	lock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// > Act
+	_, lockedErr := TryLock(path)
+	_ = lock.Unlock()
+	second, unlockedErr := TryLock(path)
+
+	// > Assert
+	if !errors.Is(lockedErr, ErrLocked) {
+		t.Errorf("Expected ErrLocked while the lock is held, got %v", lockedErr)
+	}
+	if unlockedErr != nil {
+		t.Errorf("Expected lock to be available after Unlock, got %v", unlockedErr)
+	} else {
+		_ = second.Unlock()
+	}
+}
+
+func TestLock_Waits(t *testing.T) {
+	// > Arrange
+	path := filepath.Join(t.TempDir(), "test.lock")
+	first, _ := Lock(path)
+	acquired := make(chan struct{})
+
+	// > Act
+	go func() {
+		second, err := Lock(path)
+		if err == nil {
+			_ = second.Unlock()
+		}
+		close(acquired)
+	}()
+
+	// > Assert
+	select {
+	case <-acquired:
+		t.Fatalf("Expected Lock to wait while the lock is held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_ = first.Unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected Lock to return once the lock was released")
+	}
+}
+
+func TestAcquireInstance(t *testing.T) {
+	// > Arrange
+	path := filepath.Join(t.TempDir(), "npoleon.pid")
+	_ = os.WriteFile(path, []byte("99999999\n"), 0644)
+
+	// > Act
+	lock, err := AcquireInstance(path)
+	_, secondErr := AcquireInstance(path)
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Expected a stale PID file to be ignored, got %v", err)
+	}
+	defer lock.Unlock()
+
+	var instanceErr *InstanceError
+	if !errors.As(secondErr, &instanceErr) || instanceErr.Pid != os.Getpid() {
+		t.Fatalf("Expected an InstanceError naming PID %d, got %v", os.Getpid(), secondErr)
+	}
+	expected := "another npoleon process is already running (PID " + strconv.Itoa(os.Getpid()) + ")"
+	if instanceErr.Error() != expected {
+		t.Errorf("Expected '%v', got '%v'", expected, instanceErr.Error())
+	}
+}
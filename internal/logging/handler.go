@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// ConsoleHandler prints messages for people rather than for machines: info
+// messages as they are, and warnings and errors with a prefix. Fields are left
+// out, except on debug messages, which are only shown with --verbose.
+type ConsoleHandler struct {
+	out   io.Writer
+	level slog.Level
+	mutex *sync.Mutex
+	attrs []slog.Attr
+	group string
+}
+
+func NewConsoleHandler(out io.Writer, level slog.Level) *ConsoleHandler {
+	return &ConsoleHandler{out: out, level: level, mutex: &sync.Mutex{}}
+}
+
+func (h *ConsoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *ConsoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var line strings.Builder
+	switch {
+	case record.Level >= slog.LevelError:
+		line.WriteString("Error: ")
+	case record.Level >= slog.LevelWarn:
+		line.WriteString("Warning: ")
+	case record.Level < slog.LevelInfo:
+		line.WriteString("Debug: ")
+	}
+	line.WriteString(record.Message)
+
+	if record.Level < slog.LevelInfo {
+		for _, attr := range h.attrs {
+			writeAttr(&line, "", attr)
+		}
+		record.Attrs(func(attr slog.Attr) bool {
+			writeAttr(&line, h.group, attr)
+			return true
+		})
+	}
+	line.WriteString("\n")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, err := io.WriteString(h.out, line.String())
+	return err
+}
+
+// writeAttr writes groups, e.g. the fields of a play, as "play.title=..."
+func writeAttr(line *strings.Builder, prefix string, attr slog.Attr) {
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range value.Group() {
+			writeAttr(line, prefix, member)
+		}
+		return
+	}
+	_, _ = fmt.Fprintf(line, " %s%s=%q", prefix, attr.Key, value.String())
+}
+
+func (h *ConsoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, attr := range attrs {
+		if h.group != "" {
+			attr.Key = h.group + attr.Key
+		}
+		clone.attrs = append(clone.attrs, attr)
+	}
+	return &clone
+}
+
+func (h *ConsoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.group = h.group + name + "."
+	return &clone
+}
+
+// fanout passes records on to several handlers, e.g. to the console and to a
+// log file
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range f {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+	for _, handler := range f {
+		if !handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := handler.Handle(ctx, record.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanout, len(f))
+	for idx, handler := range f {
+		handlers[idx] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	handlers := make(fanout, len(f))
+	for idx, handler := range f {
+		handlers[idx] = handler.WithGroup(name)
+	}
+	return handlers
+}
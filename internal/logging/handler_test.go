@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    slog.Level
+		log      func(logger *slog.Logger)
+		expected string
+	}{
+		{
+			name:     "Info messages are shown as they are",
+			level:    slog.LevelInfo,
+			log:      func(logger *slog.Logger) { logger.Info("Scrobbled a track", "station", "nporadio2") },
+			expected: "Scrobbled a track\n",
+		},
+		{
+			name:     "Warnings and errors get a prefix",
+			level:    slog.LevelInfo,
+			log:      func(logger *slog.Logger) { logger.Warn("careful"); logger.Error("broken") },
+			expected: "Warning: careful\nError: broken\n",
+		},
+		{
+			name:     "Debug messages are hidden by default",
+			level:    slog.LevelInfo,
+			log:      func(logger *slog.Logger) { logger.Debug("GET https://www.nporadio2.nl") },
+			expected: "",
+		},
+		{
+			name:  "Debug messages include their fields",
+			level: slog.LevelDebug,
+			log: func(logger *slog.Logger) {
+				logger.With("station", "nporadio2").WithGroup("request").Debug(
+					"GET https://www.nporadio2.nl",
+					"status", 200,
+					"duration", 1500*time.Millisecond,
+				)
+			},
+			expected: "Debug: GET https://www.nporadio2.nl station=\"nporadio2\" request.status=\"200\" request.duration=\"1.5s\"\n",
+		},
+		{
+			name:     "Quiet mode only shows warnings and errors",
+			level:    slog.LevelWarn,
+			log:      func(logger *slog.Logger) { logger.Info("Scrobbled a track"); logger.Warn("careful") },
+			expected: "Warning: careful\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// > Arrange
+			var out bytes.Buffer
+			logger := slog.New(NewConsoleHandler(&out, test.level))
+
+			// > Act
+			test.log(logger)
+
+			// > Assert
+			if out.String() != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const (
+	TextFormat = "text"
+	JsonFormat = "json"
+)
+
+// Options determine which records are logged, and where to
+type Options struct {
+	Level  slog.Level
+	Format string
+	// File also receives every record, in addition to the console
+	File string
+}
+
+// GetLevel turns --verbose and --quiet into a level
+func GetLevel(verbose bool, quiet bool) (slog.Level, error) {
+	switch {
+	case verbose && quiet:
+		return 0, fmt.Errorf("--verbose cannot be combined with --quiet")
+	case verbose:
+		return slog.LevelDebug, nil
+	case quiet:
+		return slog.LevelWarn, nil
+	default:
+		return slog.LevelInfo, nil
+	}
+}
+
+// CheckFormat returns an error for formats other than "text" and "json"
+func CheckFormat(format string) error {
+	if format != TextFormat && format != JsonFormat {
+		return fmt.Errorf(`"%s" is not a valid log format, use "text" or "json"`, format)
+	}
+	return nil
+}
+
+// Setup makes slog write to the console, and to a log file if there is one.
+// In the text format the console shows the messages the way Npoleon always
+// has, while the log file gets every field. The returned file must be closed
+// when the program ends, and is nil if there is no log file.
+func Setup(options Options, console io.Writer) (io.Closer, error) {
+	if err := CheckFormat(options.Format); err != nil {
+		return nil, err
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: options.Level}
+	handlers := []slog.Handler{
+		createHandler(options.Format, console, handlerOptions, true),
+	}
+
+	var file *os.File
+	if options.File != "" {
+		if err := os.MkdirAll(filepath.Dir(options.File), 0700); err != nil {
+			return nil, err
+		}
+		var err error
+		file, err = os.OpenFile(options.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		handlers = append(handlers, createHandler(options.Format, file, handlerOptions, false))
+	}
+
+	slog.SetDefault(slog.New(fanout(handlers)))
+	if file == nil {
+		return nil, nil
+	}
+	return file, nil
+}
+
+func createHandler(format string, out io.Writer, options *slog.HandlerOptions, console bool) slog.Handler {
+	switch {
+	case format == JsonFormat:
+		return slog.NewJSONHandler(out, options)
+	case console:
+		return NewConsoleHandler(out, options.Level.Level())
+	default:
+		return slog.NewTextHandler(out, options)
+	}
+}
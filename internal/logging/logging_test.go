@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetup_LogFile(t *testing.T) {
+	// > Arrange
+	defer slog.SetDefault(slog.Default())
+	var console bytes.Buffer
+	path := filepath.Join(t.TempDir(), "logs", "npoleon.log")
+
+	// > Act
+	file, err := Setup(Options{Level: slog.LevelInfo, Format: JsonFormat, File: path}, &console)
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	slog.Info("Scrobbled a track", "station", "nporadio2")
+	_ = file.Close()
+
+	// > Assert
+	contents, _ := os.ReadFile(path)
+	var record map[string]any
+	if err = json.Unmarshal(contents, &record); err != nil {
+		t.Fatalf("Expected a JSON record in the log file, got %q", contents)
+	}
+	if record["msg"] != "Scrobbled a track" || record["station"] != "nporadio2" {
+		t.Errorf("Expected the message and station in the log file, got %v", record)
+	}
+	if !strings.Contains(console.String(), `"station":"nporadio2"`) {
+		t.Errorf("Expected JSON on the console, got %q", console.String())
+	}
+}
+
+func TestGetLevel(t *testing.T) {
+	tests := []struct {
+		verbose  bool
+		quiet    bool
+		expected slog.Level
+		fails    bool
+	}{
+		{expected: slog.LevelInfo},
+		{verbose: true, expected: slog.LevelDebug},
+		{quiet: true, expected: slog.LevelWarn},
+		{verbose: true, quiet: true, fails: true},
+	}
+
+	for _, test := range tests {
+		// > Act
+		level, err := GetLevel(test.verbose, test.quiet)
+
+		// > Assert
+		if (err != nil) != test.fails || level != test.expected {
+			t.Errorf("Expected %v for verbose=%v quiet=%v, got %v (%v)", test.expected, test.verbose, test.quiet, level, err)
+		}
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	if err := CheckFormat("xml"); err == nil {
+		t.Errorf("Expected xml to be refused")
+	}
+}
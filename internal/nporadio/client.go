@@ -4,23 +4,69 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"npoleon/internal/clock"
 	"npoleon/internal/http"
+	"npoleon/internal/util"
 	"regexp"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var now = func() time.Time { return time.Now() }
+// NPO is asked for at most this many pages at the same time
+const maxConcurrentRequests = 4
+
+var location, _ = time.LoadLocation("Europe/Amsterdam")
+
+// PlaylistRetention is how far back NPO's websites list playlists. Older days
+// return empty pages, so those plays can no longer be scrobbled.
+const PlaylistRetention = 31 * 24 * time.Hour
+
+// OldestAvailable returns the earliest moment for which NPO still keeps the
+// playlist, i.e. the start of the oldest day that is listed
+func OldestAvailable(now time.Time) time.Time {
+	return startOfDay(now.Add(-PlaylistRetention))
+}
+
+// CheckAvailable returns an error when plays since 'from' are no longer
+// listed by NPO
+func CheckAvailable(from time.Time, now time.Time) error {
+	oldest := OldestAvailable(now)
+	if from.Before(oldest) {
+		return fmt.Errorf(
+			"NPO only keeps playlists of the last %d days, so nothing played before %s can be scrobbled",
+			int(PlaylistRetention.Hours()/24),
+			util.FormatTime(oldest),
+		)
+	}
+	return nil
+}
+
+// GetStationUrl returns the address of the station's website, without a
+// trailing slash
+func GetStationUrl(stationId StationId) string {
+	return fmt.Sprintf("https://www.%s.nl", stationId)
+}
 
 func GetBuildId(httpClient http.ClientInterface, stationId StationId) (string, error) {
-	mainPage := fmt.Sprintf("https://www.%s.nl/", stationId)
-	resp, err := httpClient.Fetch(mainPage)
+	return getBuildId(httpClient, GetStationUrl(stationId), stationId)
+}
+
+func getBuildId(httpClient http.ClientInterface, baseUrl string, stationId StationId) (string, error) {
+	resp, err := httpClient.Fetch(baseUrl + "/")
 	if err != nil {
 		return "", err
 	}
 
+	return ParseBuildId(resp, stationId)
+}
+
+// ParseBuildId finds the buildId in the main page of a station's website
+func ParseBuildId(page []byte, stationId StationId) (string, error) {
 	re := regexp.MustCompile(`"buildId":"([^"]+)"`)
-	matches := re.FindStringSubmatch(string(resp))
+	matches := re.FindStringSubmatch(string(page))
 
 	if len(matches) < 1 {
 		msg := fmt.Sprintf("failed to identify buildId for %s", stationId)
@@ -30,14 +76,49 @@ func GetBuildId(httpClient http.ClientInterface, stationId StationId) (string, e
 	return matches[1], nil
 }
 
+// Enricher adds information to tracks that NPO does not provide, e.g. their
+// duration. Only the latest play is enriched, to tell whether it is still
+// playing. Plays that are fetched for a backfill are enriched when they are
+// scrobbled, so that plays that aren't scrobbled aren't looked up.
+type Enricher interface {
+	Enrich(track Track) Track
+}
+
+// FetchProgress is told how far FetchRange has got. Its methods are called
+// from several goroutines at the same time.
+type FetchProgress interface {
+	StartFetching(days int)
+	PageFetched()
+	DayFetched(tracks int)
+}
+
 type Client struct {
 	httpClient http.ClientInterface
 	stationId  StationId
-	buildId    string
+	baseUrl    string
+	build      *build
+	enricher   Enricher
+	progress   FetchProgress
+	clock      clock.Clock
+}
+
+// build holds the buildId of NPO's website, which changes whenever a new
+// version of the website is deployed. It is shared by all copies of a Client.
+type build struct {
+	mutex sync.Mutex
+	id    string
 }
 
 func CreateClient(httpClient http.ClientInterface, stationId StationId) (Client, error) {
-	buildId, err := GetBuildId(httpClient, stationId)
+	return CreateClientWithBaseUrl(httpClient, stationId, GetStationUrl(stationId))
+}
+
+// CreateClientWithBaseUrl creates a client that talks to another server than
+// the station's website, e.g. a local stand-in for tests
+func CreateClientWithBaseUrl(httpClient http.ClientInterface, stationId StationId, baseUrl string) (Client, error) {
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+
+	buildId, err := getBuildId(httpClient, baseUrl, stationId)
 	if err != nil {
 		return Client{}, err
 	}
@@ -45,15 +126,86 @@ func CreateClient(httpClient http.ClientInterface, stationId StationId) (Client,
 	return Client{
 		httpClient: httpClient,
 		stationId:  stationId,
-		buildId:    buildId,
+		baseUrl:    baseUrl,
+		build:      &build{id: buildId},
+		clock:      clock.Real{},
 	}, nil
 }
 
+func (c Client) StationId() StationId {
+	return c.stationId
+}
+
+func (c Client) WithClock(clock clock.Clock) Client {
+	c.clock = clock
+	return c
+}
+
+func (c Client) WithEnricher(enricher Enricher) Client {
+	c.enricher = enricher
+	return c
+}
+
+func (c Client) WithProgress(progress FetchProgress) Client {
+	c.progress = progress
+	return c
+}
+
+type playlistPage struct {
+	tracks  []Track
+	plays   []Play
+	date    string
+	maxPage int
+}
+
 func (c Client) fetchPage(date time.Time, page int) ([]Track, error) {
+	res, err := c.fetchPlaylistPage(date, page)
+	return res.tracks, err
+}
+
+// fetchPlaylistPage retries once with a new buildId if the website has been
+// redeployed since the last request, as NPO no longer serves pages for the
+// previous buildId
+func (c Client) fetchPlaylistPage(date time.Time, page int) (playlistPage, error) {
+	buildId := c.getBuildId()
+
+	res, err := c.fetchPlaylistPageForBuild(buildId, date, page)
+	if err != nil && c.refreshBuildId(buildId) {
+		return c.fetchPlaylistPageForBuild(c.getBuildId(), date, page)
+	}
+	return res, err
+}
+
+func (c Client) getBuildId() string {
+	c.build.mutex.Lock()
+	defer c.build.mutex.Unlock()
+	return c.build.id
+}
+
+// refreshBuildId reports whether the buildId has changed since 'stale' was
+// used, which may also have been noticed by another request in the meantime
+func (c Client) refreshBuildId(stale string) bool {
+	c.build.mutex.Lock()
+	defer c.build.mutex.Unlock()
+
+	if c.build.id != stale {
+		return true
+	}
+
+	buildId, err := getBuildId(c.httpClient, c.baseUrl, c.stationId)
+	if err != nil || buildId == stale {
+		return false
+	}
+
+	c.build.id = buildId
+	return true
+}
+
+func (c Client) fetchPlaylistPageForBuild(buildId string, date time.Time, page int) (playlistPage, error) {
 	endpoint := fmt.Sprintf(
-		"https://www.%s.nl/_next/data/%s/gedraaid/%s.json?page=%d&date=%s",
-		c.stationId,
-		c.buildId,
+		"%s/_next/data/%s/gedraaid/%s.json?page=%d&date=%s",
+		c.baseUrl,
+		buildId,
 		date.Format("2-1-2006"),
 		page,
 		date.Format("2-1-2006"),
@@ -61,26 +213,33 @@ func (c Client) fetchPage(date time.Time, page int) ([]Track, error) {
 
 	resp, err := c.httpClient.Fetch(endpoint)
 	if err != nil {
-		return nil, err
+		return playlistPage{}, err
 	}
 
 	var response Response
 	err = json.Unmarshal(resp, &response)
 	if err != nil {
-		return nil, err
+		return playlistPage{}, err
 	}
 
 	tracks, err := convertResponse(response)
 	if err != nil {
-		return nil, err
+		return playlistPage{}, err
 	}
 
-	return tracks, nil
+	inferEndTimes(tracks)
+	return playlistPage{
+		tracks:  tracks,
+		plays:   response.PageProps.TrackPlays,
+		date:    response.PageProps.InitialValues.Date,
+		maxPage: response.PageProps.Pagination.MaxPage,
+	}, nil
 }
 
-func (c Client) FetchCurrent() (*Track, error) {
-	location, _ := time.LoadLocation("Europe/Amsterdam")
-	tracks, err := c.fetchPage(now().In(location), 1)
+// FetchLatest returns the most recent play of today, even if it has already
+// finished or has only just started
+func (c Client) FetchLatest() (*Track, error) {
+	tracks, err := c.fetchPage(c.clock.Now().In(location), 1)
 
 	if err != nil {
 		return nil, err
@@ -91,57 +250,174 @@ func (c Client) FetchCurrent() (*Track, error) {
 	}
 
 	var track = tracks[0]
-	if !track.IsPlayedAt(now()) {
-		return nil, nil
+	if c.enricher != nil {
+		track = c.enricher.Enrich(track)
 	}
-
 	return &track, nil
 }
 
+// FetchRange fetches all days in the range concurrently, but never sends more
+// than maxConcurrentRequests requests to NPO at the same time. Once a request
+// fails, no new requests are sent.
 func (c Client) FetchRange(from time.Time, until time.Time) ([]Track, error) {
-	var allTracks []Track
-	var page = 1
-	var now = until
-	for {
-		if now.Before(from) {
-			break
-		}
+	days := listDays(from, until)
+	pool := newRequestPool(maxConcurrentRequests)
+	fetches := make([]*dayFetch, len(days))
+	if c.progress != nil {
+		c.progress.StartFetching(len(days))
+	}
 
-		currentTracks, err := c.fetchPage(now, page)
+	for idx, day := range days {
+		fetch := &dayFetch{day: day}
+		fetches[idx] = fetch
+		pool.add(func() error {
+			return c.fetchDay(pool, fetch, from)
+		})
+	}
+	if err := pool.run(); err != nil {
+		return nil, err
+	}
 
+	var allTracks []Track
+	for _, fetch := range fetches {
+		tracks, err := fetch.convert()
 		if err != nil {
 			return nil, err
 		}
+		allTracks = append(allTracks, tracks...)
+	}
 
-		if len(currentTracks) == 0 {
-			// If 'from' time has not been reached yet, go the previous day
-			break
-		}
+	allTracks = removeDuplicatePlays(allTracks)
+	sort.Stable(ByPlayedAt(allTracks))
+	inferEndTimes(allTracks)
 
-		allTracks = append(allTracks, currentTracks...)
+	return removeTracksOutsideRange(allTracks, from, until), nil
+}
 
-		if containsTracksBeforeDate(currentTracks, from) {
-			break
-		}
+// dayFetch collects the pages of a single day. Its plays are converted all at
+// once, so that plays around midnight and DST transitions are resolved using
+// the plays around them, even when those are on another page.
+type dayFetch struct {
+	day   time.Time
+	pages []playlistPage
+	// remaining counts the pages that other tasks are still fetching
+	remaining atomic.Int32
+}
 
-		page++
-		now = currentTracks[len(currentTracks)-1].PlayedAt
+func (f *dayFetch) convert() ([]Track, error) {
+	var plays []Play
+	for _, page := range f.pages {
+		plays = append(plays, page.plays...)
 	}
+	return convertPlays(plays, f.pages[0].date)
+}
 
-	if from.Before(now) {
-		year, month, day := now.Add(-24 * time.Hour).Date()
-		location, _ := time.LoadLocation("Europe/Amsterdam")
-		yesterday := time.Date(year, month, day, 23, 59, 59, 0, location)
-		olderTracks, err := c.FetchRange(from, yesterday)
-		if err != nil {
-			return nil, err
+// fetchDay fetches the first page of a day, and then either the pages it needs
+// one by one, or adds all other pages to the pool
+func (c Client) fetchDay(pool *requestPool, fetch *dayFetch, from time.Time) error {
+	first, err := c.fetchCounted(fetch.day, 1)
+	if err != nil {
+		return err
+	}
+	fetch.pages = []playlistPage{first}
+
+	switch {
+	case len(first.tracks) == 0 || first.maxPage <= 1 || containsTracksBeforeDate(first.tracks, from):
+		// No other pages are needed
+	case isSameDay(fetch.day, from):
+		// Pages run from the latest to the earliest plays of a day, so on the
+		// day on which the range starts only the pages up to 'from' are needed
+		for page := 2; page <= first.maxPage; page++ {
+			res, err := c.fetchCounted(fetch.day, page)
+			if err != nil {
+				return err
+			}
+			if len(res.tracks) == 0 {
+				break
+			}
+			fetch.pages = append(fetch.pages, res)
+			if containsTracksBeforeDate(res.tracks, from) {
+				break
+			}
 		}
-		allTracks = append(allTracks, olderTracks...)
+	default:
+		// Every task fills in its own page, so the pages aren't locked
+		fetch.pages = append(fetch.pages, make([]playlistPage, first.maxPage-1)...)
+		fetch.remaining.Store(int32(first.maxPage - 1))
+		for page := 2; page <= first.maxPage; page++ {
+			page := page
+			pool.add(func() error {
+				res, err := c.fetchCounted(fetch.day, page)
+				if err != nil {
+					return err
+				}
+				fetch.pages[page-1] = res
+				if fetch.remaining.Add(-1) == 0 {
+					c.dayFetched(fetch)
+				}
+				return nil
+			})
+		}
+		return nil
 	}
 
-	filteredTracks := removeTracksOutsideRange(allTracks, from, until)
-	sort.Sort(ByPlayedAt(filteredTracks))
-	return filteredTracks, nil
+	c.dayFetched(fetch)
+	return nil
+}
+
+func (c Client) dayFetched(fetch *dayFetch) {
+	if c.progress == nil {
+		return
+	}
+	var plays int
+	for _, page := range fetch.pages {
+		plays += len(page.plays)
+	}
+	c.progress.DayFetched(plays)
+}
+
+func (c Client) fetchCounted(date time.Time, page int) (playlistPage, error) {
+	res, err := c.fetchPlaylistPage(date, page)
+	if err == nil && c.progress != nil {
+		c.progress.PageFetched()
+	}
+	return res, err
+}
+
+// listDays returns the start of every day in the range, latest day first
+func listDays(from time.Time, until time.Time) []time.Time {
+	first := startOfDay(from)
+	var days []time.Time
+
+	for day := startOfDay(until); !day.Before(first); day = day.AddDate(0, 0, -1) {
+		days = append(days, day)
+	}
+
+	return days
+}
+
+func startOfDay(moment time.Time) time.Time {
+	year, month, day := moment.In(location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, location)
+}
+
+func isSameDay(a time.Time, b time.Time) bool {
+	return startOfDay(a).Equal(startOfDay(b))
+}
+
+func removeDuplicatePlays(tracks []Track) []Track {
+	seen := make(map[string]bool)
+	var result []Track
+
+	for _, t := range tracks {
+		key := t.Id.String() + " " + t.PlayedAt.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, t)
+	}
+	return result
 }
 
 func removeTracksOutsideRange(tracks []Track, start time.Time, end time.Time) []Track {
@@ -1,10 +1,16 @@
 package nporadio
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"npoleon/internal/clock"
 	"npoleon/internal/http"
+	"npoleon/internal/nporadio/fakeserver"
 	"npoleon/internal/util"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -90,14 +96,23 @@ func TestCreateClient(t *testing.T) {
 	client, _ := CreateClient(httpClient, NpoRadio1)
 
 	// > Assert
-	if client.buildId != expected {
-		t.Errorf("Expected %v, got %v", expected, client.buildId)
+	if client.getBuildId() != expected {
+		t.Errorf("Expected %v, got %v", expected, client.getBuildId())
 	}
 }
 
 // ----------------------------------------------------------------------------
 
-func TestClient_FetchCurrent(t *testing.T) {
+type fakeEnricher struct {
+	duration time.Duration
+}
+
+func (e fakeEnricher) Enrich(track Track) Track {
+	track.Duration = e.duration
+	return track
+}
+
+func TestClient_FetchLatest(t *testing.T) {
 	createFakeResponseClient := func(page int) http.ClientInterface {
 		httpClient := http.FakeClient{Responses: make(map[string][]byte)}
 		httpClient.MakeFetchReturn("https://www.npo3fm.nl/", `{"buildId":"s3r10usR3qu3st"}`)
@@ -123,36 +138,77 @@ func TestClient_FetchCurrent(t *testing.T) {
 		if len(res) != 12 {
 			t.Errorf("Expected %v, got %v", 12, len(res))
 		}
+		if !res[1].EndsAt.Equal(res[0].PlayedAt) {
+			t.Errorf("Expected track to end when the next one started, got %v", res[1].EndsAt)
+		}
+		if !res[0].EndsAt.IsZero() {
+			t.Errorf("End of the latest track should be unknown, got %v", res[0].EndsAt)
+		}
 	})
 
 	t.Run("Client fetches the current track", func(t *testing.T) {
 		// > Arrange
 		httpClient := createFakeResponseClient(1)
 		client, _ := CreateClient(httpClient, NpoRadio3)
-		date, _ := util.ParseTime("2023-12-24 19:55")
-		now = func() time.Time { return date.Time }
+		date, _ := util.ParseTime("2023-12-24 19:56")
+		client = client.WithClock(clock.NewFake(date.Time))
 
 		// > Act
-		res, err := client.FetchCurrent()
+		res, err := client.FetchLatest()
 
 		// > Assert
 		if res == nil || res.Title != "FELIZ NAVIDAD" {
 			t.Errorf("Expected %v, got %v", "FELIZ NAVIDAD", err)
+		} else if !res.IsCurrentAt(date.Time) {
+			t.Errorf("Expected track to be scrobbleable")
+		}
+	})
+
+	t.Run("Track that has only just started is not scrobbleable yet", func(t *testing.T) {
+		// > Arrange
+		httpClient := createFakeResponseClient(1)
+		client, _ := CreateClient(httpClient, NpoRadio3)
+		date, _ := util.ParseTime("2023-12-24 19:55")
+		client = client.WithClock(clock.NewFake(date.Time))
+
+		// > Act
+		track, _ := client.FetchLatest()
+
+		// > Assert
+		if track == nil || track.IsCurrentAt(date.Time) {
+			t.Errorf("Track has not been played long enough to be scrobbled")
 		}
 	})
 
-	t.Run("Client fetches a track that has finished playing", func(t *testing.T) {
+	t.Run("Client uses the duration of an enriched track", func(t *testing.T) {
+		// > Arrange
+		httpClient := createFakeResponseClient(1)
+		client, _ := CreateClient(httpClient, NpoRadio3)
+		client = client.WithEnricher(fakeEnricher{duration: 6 * time.Minute})
+		date, _ := util.ParseTime("2023-12-24 19:59")
+		client = client.WithClock(clock.NewFake(date.Time))
+
+		// > Act
+		res, _ := client.FetchLatest()
+
+		// > Assert
+		if res == nil || res.Duration != 6*time.Minute || !res.IsCurrentAt(date.Time) {
+			t.Errorf("Expected enriched track to still be playing, got %v", res)
+		}
+	})
+
+	t.Run("Track that has finished playing is not current", func(t *testing.T) {
 		// > Arrange
 		httpClient := createFakeResponseClient(1)
 		client, _ := CreateClient(httpClient, NpoRadio3)
 		date, _ := util.ParseTime("2023-12-24 22:08")
-		now = func() time.Time { return date.Time }
+		client = client.WithClock(clock.NewFake(date.Time))
 
 		// > Act
-		track, _ := client.FetchCurrent()
+		track, _ := client.FetchLatest()
 
 		// > Assert
-		if track != nil {
+		if track == nil || track.IsCurrentAt(date.Time) {
 			t.Errorf("No track should be playing right now")
 		}
 	})
@@ -230,3 +286,333 @@ func TestClient_FetchRange(t *testing.T) {
 		}
 	})
 }
+
+type concurrencyTrackingClient struct {
+	http.FakeClient
+	mutex    *sync.Mutex
+	inFlight *int
+	maxSeen  *int
+}
+
+func (c concurrencyTrackingClient) Fetch(url string) ([]byte, error) {
+	c.mutex.Lock()
+	*c.inFlight++
+	if *c.inFlight > *c.maxSeen {
+		*c.maxSeen = *c.inFlight
+	}
+	c.mutex.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.mutex.Lock()
+	*c.inFlight--
+	c.mutex.Unlock()
+
+	return c.FakeClient.Fetch(url)
+}
+
+func createPlaylistPage(date string, page int, maxPage int, times ...string) string {
+	var plays []string
+	for _, playTime := range times {
+		digits := strings.ReplaceAll(date, "-", "") + strings.ReplaceAll(playTime, ":", "")
+		id := fmt.Sprintf("00000000-0000-0000-0000-%012s", digits)
+		plays = append(plays, fmt.Sprintf(`{"id":"%s","artist":"Artist","track":"%s %s","time":"%s"}`, id, date, playTime, playTime))
+	}
+	return fmt.Sprintf(
+		`{"pageProps":{"trackPlays":[%s],"initialValues":{"date":"%s"},"pagination":{"currentPage":%d,"maxPage":%d}}}`,
+		strings.Join(plays, ","),
+		date,
+		page,
+		maxPage,
+	)
+}
+
+func TestClient_FetchRange_Concurrently(t *testing.T) {
+	// > Arrange
+	fake := http.FakeClient{Responses: make(map[string][]byte)}
+	fake.MakeFetchReturn("https://www.nporadio2.nl/", `{"buildId":"p4r4ll3l"}`)
+
+	endpoint := "https://www.nporadio2.nl/_next/data/p4r4ll3l/gedraaid/%s.json?page=%d&date=%s"
+	for _, date := range []string{"1-3-2024", "2-3-2024", "3-3-2024"} {
+		fake.MakeFetchReturn(fmt.Sprintf(endpoint, date, 1, date), createPlaylistPage(date, 1, 3, "23:50", "18:00"))
+		// The first play of page 3 is also the last play of page 2
+		fake.MakeFetchReturn(fmt.Sprintf(endpoint, date, 2, date), createPlaylistPage(date, 2, 3, "12:00", "09:00"))
+		fake.MakeFetchReturn(fmt.Sprintf(endpoint, date, 3, date), createPlaylistPage(date, 3, 3, "09:00", "00:10"))
+	}
+
+	httpClient := concurrencyTrackingClient{
+		FakeClient: fake,
+		mutex:      &sync.Mutex{},
+		inFlight:   new(int),
+		maxSeen:    new(int),
+	}
+	client, _ := CreateClient(httpClient, NpoRadio2)
+	from, _ := util.ParseTime("2024-03-01 10:00")
+	until, _ := util.ParseTime("2024-03-03 20:00")
+
+	// > Act
+	res, err := client.FetchRange(from.Time, until.Time)
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Fetching range failed: %v", err)
+	}
+	var titles []string
+	for _, track := range res {
+		titles = append(titles, track.Title)
+	}
+	expected := []string{
+		"1-3-2024 12:00", "1-3-2024 18:00", "1-3-2024 23:50",
+		"2-3-2024 00:10", "2-3-2024 09:00", "2-3-2024 12:00", "2-3-2024 18:00", "2-3-2024 23:50",
+		"3-3-2024 00:10", "3-3-2024 09:00", "3-3-2024 12:00", "3-3-2024 18:00",
+	}
+	if strings.Join(titles, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected %v, got %v", expected, titles)
+	}
+	if *httpClient.maxSeen > maxConcurrentRequests {
+		t.Errorf("Expected at most %v concurrent requests, got %v", maxConcurrentRequests, *httpClient.maxSeen)
+	}
+}
+
+// gatedClient holds up all playlist requests until it is released, and keeps
+// track of the requests that start after that
+type gatedClient struct {
+	http.FakeClient
+	release <-chan struct{}
+	mutex   *sync.Mutex
+	late    *[]string
+}
+
+func (c gatedClient) Fetch(url string) ([]byte, error) {
+	if !strings.Contains(url, "/gedraaid/") {
+		return c.FakeClient.Fetch(url)
+	}
+
+	select {
+	case <-c.release:
+		c.mutex.Lock()
+		*c.late = append(*c.late, url)
+		c.mutex.Unlock()
+	default:
+	}
+
+	if _, exists := c.Responses[url]; exists {
+		<-c.release
+	}
+	return c.FakeClient.Fetch(url)
+}
+
+// signalHandler closes signal once a record with the message is logged
+type signalHandler struct {
+	message string
+	signal  chan struct{}
+	once    *sync.Once
+}
+
+func (h signalHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h signalHandler) Handle(_ context.Context, record slog.Record) error {
+	if record.Message == h.message {
+		h.once.Do(func() { close(h.signal) })
+	}
+	return nil
+}
+
+func (h signalHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h signalHandler) WithGroup(string) slog.Handler { return h }
+
+func TestClient_FetchRange_Failure(t *testing.T) {
+	// > Arrange
+	fake := http.FakeClient{Responses: make(map[string][]byte)}
+	fake.MakeFetchReturn("https://www.nporadio2.nl/", `{"buildId":"f41l"}`)
+
+	endpoint := "https://www.nporadio2.nl/_next/data/f41l/gedraaid/%s.json?page=%d&date=%s"
+	for day := 1; day < 20; day++ {
+		date := fmt.Sprintf("%d-3-2024", day)
+		for page := 1; page <= 3; page++ {
+			fake.MakeFetchReturn(fmt.Sprintf(endpoint, date, page, date), createPlaylistPage(date, page, 3, "12:00"))
+		}
+	}
+
+	// The other requests are held up until the pool has noticed that the
+	// playlist of 20 March, which is fetched first, is missing
+	failed := make(chan struct{})
+	previous := slog.Default()
+	slog.SetDefault(slog.New(signalHandler{message: "Stopped fetching after a failure", signal: failed, once: &sync.Once{}}))
+	defer slog.SetDefault(previous)
+
+	httpClient := gatedClient{FakeClient: fake, release: failed, mutex: &sync.Mutex{}, late: &[]string{}}
+	client, _ := CreateClient(httpClient, NpoRadio2)
+	from, _ := util.ParseTime("2024-03-01 00:00")
+	until, _ := util.ParseTime("2024-03-20 23:00")
+
+	// > Act
+	_, err := client.FetchRange(from.Time, until.Time)
+
+	// > Assert
+	if err == nil {
+		t.Fatalf("Expected fetching the range to fail")
+	}
+	if len(*httpClient.late) > 0 {
+		t.Errorf("Expected no requests after the failure, got %v", *httpClient.late)
+	}
+}
+
+func TestClient_FetchRange_DaylightSavingTime(t *testing.T) {
+	createDstFakeResponsesClient := func(date string) http.ClientInterface {
+		httpClient := http.FakeClient{Responses: make(map[string][]byte)}
+		httpClient.MakeFetchReturn("https://www.nporadio2.nl/", `{"buildId":"z0m3rt1jd"}`)
+
+		for page := 1; page <= 2; page++ {
+			fixture, _ := os.ReadFile(fmt.Sprintf("testdata/%s-%d.json", date, page))
+			httpClient.MakeFetchReturn(
+				fmt.Sprintf("https://www.nporadio2.nl/_next/data/z0m3rt1jd/gedraaid/%s.json?page=%d&date=%s", date, page, date),
+				string(fixture),
+			)
+		}
+		return httpClient
+	}
+
+	t.Run("Clocks are set forward on the last Sunday of March", func(t *testing.T) {
+		// > Arrange
+		client, _ := CreateClient(createDstFakeResponsesClient("31-3-2024"), NpoRadio2)
+		from, _ := util.ParseTime("2024-03-31 00:00")
+		until, _ := util.ParseTime("2024-03-31 04:00")
+
+		// > Act
+		res, err := client.FetchRange(from.Time, until.Time)
+
+		// > Assert
+		if err != nil || len(res) != 4 {
+			t.Fatalf("Expected 4 tracks, got %v (%v)", len(res), err)
+		}
+		if gap := res[2].PlayedAt.Sub(res[1].PlayedAt); gap != 7*time.Minute {
+			t.Errorf("Expected 7 minutes between 01:57 and 03:04, got %v", gap)
+		}
+		if res[1].End().Sub(res[1].PlayedAt) != 7*time.Minute {
+			t.Errorf("Expected track before the transition to last 7 minutes, got %v", res[1].End().Sub(res[1].PlayedAt))
+		}
+	})
+
+	t.Run("Clocks are set back on the last Sunday of October", func(t *testing.T) {
+		// > Arrange
+		client, _ := CreateClient(createDstFakeResponsesClient("27-10-2024"), NpoRadio2)
+		from, _ := util.ParseTime("2024-10-27 00:00")
+		until, _ := util.ParseTime("2024-10-27 04:00")
+
+		// > Act
+		res, err := client.FetchRange(from.Time, until.Time)
+
+		// > Assert
+		if err != nil || len(res) != 6 {
+			t.Fatalf("Expected 6 tracks, got %v (%v)", len(res), err)
+		}
+		var times []string
+		for _, track := range res {
+			times = append(times, track.PlayedAt.Format("15:04 -0700"))
+		}
+		expected := "01:58 +0200, 02:15 +0200, 02:45 +0200, 02:20 +0100, 02:50 +0100, 03:05 +0100"
+		if strings.Join(times, ", ") != expected {
+			t.Errorf("Expected %v, got %v", expected, strings.Join(times, ", "))
+		}
+	})
+}
+
+func TestClient_FakeServer(t *testing.T) {
+	start := time.Date(2024, 1, 6, 8, 0, 0, 0, location)
+	var plays []fakeserver.Play
+	for idx := 0; idx < 30; idx++ {
+		plays = append(plays, fakeserver.Play{
+			Artist:   "Artist",
+			Title:    fmt.Sprintf("Track %d", idx+1),
+			PlayedAt: start.Add(time.Duration(idx) * 4 * time.Minute),
+		})
+	}
+
+	t.Run("Client fetches pages from base URL", func(t *testing.T) {
+		// > Arrange
+		fakeClock := clock.NewFake(start.Add(2 * time.Hour))
+		server := fakeserver.Start(fakeClock, plays)
+		defer server.Close()
+		client, err := CreateClientWithBaseUrl(&http.Client{}, NpoRadio2, server.URL+"/")
+		if err != nil {
+			t.Fatalf("Creating client failed: %v", err)
+		}
+		client = client.WithClock(fakeClock)
+
+		// > Act
+		res, err := client.FetchRange(start, start.Add(2*time.Hour))
+
+		// > Assert
+		if err != nil || len(res) != 30 {
+			t.Fatalf("Expected 30 tracks, got %v (%v)", len(res), err)
+		}
+		if res[0].Title != "Track 1" || res[29].Title != "Track 30" {
+			t.Errorf("Expected tracks in chronological order, got %v and %v", res[0].Title, res[29].Title)
+		}
+	})
+
+	t.Run("Client picks up new buildId after redeploy", func(t *testing.T) {
+		// > Arrange
+		fakeClock := clock.NewFake(start.Add(30 * time.Minute))
+		server := fakeserver.Start(fakeClock, plays)
+		defer server.Close()
+		client, _ := CreateClientWithBaseUrl(&http.Client{}, NpoRadio2, server.URL)
+		client = client.WithClock(fakeClock)
+		server.Redeploy()
+
+		// > Act
+		track, err := client.FetchLatest()
+
+		// > Assert
+		if err != nil || track == nil || track.Title != "Track 8" {
+			t.Fatalf("Expected Track 8, got %v (%v)", track, err)
+		}
+		if client.getBuildId() != server.BuildId() {
+			t.Errorf("Expected buildId %v, got %v", server.BuildId(), client.getBuildId())
+		}
+	})
+
+	t.Run("Client reports server errors", func(t *testing.T) {
+		// > Arrange
+		fakeClock := clock.NewFake(start.Add(30 * time.Minute))
+		server := fakeserver.Start(fakeClock, plays)
+		defer server.Close()
+		client, _ := CreateClientWithBaseUrl(&http.Client{}, NpoRadio2, server.URL)
+		client = client.WithClock(fakeClock)
+		server.FailNext(503, 503)
+
+		// > Act
+		_, err := client.FetchLatest()
+
+		// > Assert
+		if err == nil || !strings.Contains(err.Error(), "503") {
+			t.Errorf("Expected error for unavailable server, got %v", err)
+		}
+	})
+}
+
+func TestCheckAvailable(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, location)
+
+	t.Run("recent plays are available", func(t *testing.T) {
+		// > Act
+		err := CheckAvailable(time.Date(2024, 1, 30, 0, 0, 0, 0, location), now)
+
+		// > Assert
+		if err != nil {
+			t.Errorf("Expected no error, got '%v'", err)
+		}
+	})
+
+	t.Run("plays older than the retention are not", func(t *testing.T) {
+		// > Act
+		err := CheckAvailable(time.Date(2024, 1, 29, 23, 59, 0, 0, location), now)
+
+		// > Assert
+		if err == nil || !strings.Contains(err.Error(), "before 2024-01-30 00:00:00 +01:00 ") {
+			t.Errorf("Expected an error mentioning 2024-01-30 00:00:00 +01:00, got '%v'", err)
+		}
+	})
+}
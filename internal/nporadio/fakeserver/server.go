@@ -0,0 +1,245 @@
+// Package fakeserver imitates the website of an NPO radio station, so that
+// nporadio.Client and the scrobbler can be tested without the internet.
+package fakeserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"npoleon/internal/clock"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NPO shows this many plays per page of a playlist
+const DefaultPageSize = 12
+
+var location, _ = time.LoadLocation("Europe/Amsterdam")
+
+var playlistPath = regexp.MustCompile(`^/_next/data/([^/]+)/gedraaid/(\d{1,2}-\d{1,2}-\d{4})\.json$`)
+
+// A Play is part of the script of a server. It only shows up in the playlist
+// once the server's clock has reached PlayedAt. Plays without an Id are given a
+// UUID, like the ones NPO uses.
+type Play struct {
+	Id       string
+	Artist   string
+	Title    string
+	PlayedAt time.Time
+}
+
+type Server struct {
+	URL string
+
+	server   *httptest.Server
+	clock    clock.Clock
+	mutex    sync.Mutex
+	plays    []Play
+	pageSize int
+	buildId  string
+	deploys  int
+	delay    time.Duration
+	failures []int
+	requests []string
+}
+
+// Start creates a server that serves the given plays and shows the time
+// according to the given clock
+func Start(clock clock.Clock, plays []Play) *Server {
+	s := &Server{
+		clock:    clock,
+		pageSize: DefaultPageSize,
+		buildId:  "build1",
+		deploys:  1,
+	}
+	s.AddPlays(plays...)
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) AddPlays(plays ...Play) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, play := range plays {
+		if play.Id == "" {
+			play.Id = fmt.Sprintf("00000000-0000-4000-8000-%012d", len(s.plays)+1)
+		}
+		s.plays = append(s.plays, play)
+	}
+	sort.SliceStable(s.plays, func(i, j int) bool {
+		return s.plays[i].PlayedAt.Before(s.plays[j].PlayedAt)
+	})
+}
+
+func (s *Server) SetPageSize(size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pageSize = size
+}
+
+// SetDelay makes every response take the given duration, as measured by the
+// server's clock
+func (s *Server) SetDelay(delay time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.delay = delay
+}
+
+// FailNext makes the next requests fail with the given status codes, in order
+func (s *Server) FailNext(statusCodes ...int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = append(s.failures, statusCodes...)
+}
+
+// Redeploy changes the buildId, after which pages for the previous buildId can
+// no longer be found
+func (s *Server) Redeploy() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.deploys++
+	s.buildId = fmt.Sprintf("build%d", s.deploys)
+	return s.buildId
+}
+
+func (s *Server) BuildId() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.buildId
+}
+
+// Requests returns the paths and queries of all requests so far
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, r.URL.RequestURI())
+	delay := s.delay
+	var failure int
+	if len(s.failures) > 0 {
+		failure, s.failures = s.failures[0], s.failures[1:]
+	}
+	s.mutex.Unlock()
+
+	if delay > 0 {
+		s.clock.Sleep(delay)
+	}
+	if failure != 0 {
+		http.Error(w, http.StatusText(failure), failure)
+		return
+	}
+
+	if r.URL.Path == "/" {
+		s.serveMainPage(w)
+		return
+	}
+
+	matches := playlistPath.FindStringSubmatch(r.URL.Path)
+	if matches == nil || matches[1] != s.BuildId() {
+		http.NotFound(w, r)
+		return
+	}
+
+	date, err := time.ParseInLocation("2-1-2006", matches[2], location)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	s.servePlaylist(w, date, page)
+}
+
+func (s *Server) serveMainPage(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(
+		w,
+		`<!DOCTYPE html><html><body><div id="__next"></div>`+
+			`<script id="__NEXT_DATA__" type="application/json">{"props":{},"page":"/","buildId":"%s"}</script>`+
+			`</body></html>`,
+		s.BuildId(),
+	)
+}
+
+type response struct {
+	PageProps pageProps `json:"pageProps"`
+}
+
+type pageProps struct {
+	TrackPlays    []trackPlay   `json:"trackPlays"`
+	InitialValues initialValues `json:"initialValues"`
+	Pagination    pagination    `json:"pagination"`
+}
+
+type trackPlay struct {
+	Id     string `json:"id"`
+	Artist string `json:"artist"`
+	Track  string `json:"track"`
+	Time   string `json:"time"`
+}
+
+type initialValues struct {
+	Date string `json:"date"`
+}
+
+type pagination struct {
+	CurrentPage int `json:"currentPage"`
+	MaxPage     int `json:"maxPage"`
+}
+
+// servePlaylist serves the plays of a day that have already happened, newest
+// first, just like NPO does
+func (s *Server) servePlaylist(w http.ResponseWriter, date time.Time, page int) {
+	now := s.clock.Now()
+
+	s.mutex.Lock()
+	var plays []trackPlay
+	for idx := len(s.plays) - 1; idx >= 0; idx-- {
+		play := s.plays[idx]
+		playedAt := play.PlayedAt.In(location)
+		if playedAt.After(now) || playedAt.Format("2-1-2006") != date.Format("2-1-2006") {
+			continue
+		}
+		plays = append(plays, trackPlay{
+			Id:     play.Id,
+			Artist: play.Artist,
+			Track:  play.Title,
+			Time:   playedAt.Format("15:04"),
+		})
+	}
+	pageSize := s.pageSize
+	s.mutex.Unlock()
+
+	maxPage := max(1, (len(plays)+pageSize-1)/pageSize)
+	start := min((page-1)*pageSize, len(plays))
+	end := min(start+pageSize, len(plays))
+
+	res := response{PageProps: pageProps{
+		TrackPlays:    append([]trackPlay{}, plays[start:end]...),
+		InitialValues: initialValues{Date: date.Format("02-01-2006")},
+		Pagination:    pagination{CurrentPage: page, MaxPage: maxPage},
+	}}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
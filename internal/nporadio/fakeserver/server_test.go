@@ -0,0 +1,108 @@
+package fakeserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"npoleon/internal/clock"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func createPlays(count int, start time.Time) []Play {
+	var plays []Play
+	for idx := 0; idx < count; idx++ {
+		plays = append(plays, Play{
+			Artist:   "Artist",
+			Title:    "Title",
+			PlayedAt: start.Add(time.Duration(idx) * 4 * time.Minute),
+		})
+	}
+	return plays
+}
+
+func TestServer_Playlist(t *testing.T) {
+	// > Arrange
+	start := time.Date(2024, 1, 6, 8, 0, 0, 0, location)
+	fakeClock := clock.NewFake(start.Add(time.Hour))
+	server := Start(fakeClock, createPlays(30, start))
+	defer server.Close()
+
+	// > Act
+	status, body := get(t, server.URL+"/_next/data/build1/gedraaid/6-1-2024.json?page=1&date=6-1-2024")
+
+	// > Assert
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", status)
+	}
+	var res response
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	// 16 plays have started within the first hour
+	if res.PageProps.Pagination.MaxPage != 2 || len(res.PageProps.TrackPlays) != DefaultPageSize {
+		t.Errorf("Expected 2 pages of 12 plays, got %v plays and %v pages", len(res.PageProps.TrackPlays), res.PageProps.Pagination.MaxPage)
+	}
+	if res.PageProps.TrackPlays[0].Time != "09:00" || res.PageProps.InitialValues.Date != "06-01-2024" {
+		t.Errorf("Expected newest play at 09:00 on 06-01-2024, got %v on %v", res.PageProps.TrackPlays[0].Time, res.PageProps.InitialValues.Date)
+	}
+}
+
+func TestServer_Redeploy(t *testing.T) {
+	// > Arrange
+	server := Start(clock.NewFake(time.Date(2024, 1, 6, 12, 0, 0, 0, location)), nil)
+	defer server.Close()
+
+	// > Act
+	buildId := server.Redeploy()
+	oldStatus, _ := get(t, server.URL+"/_next/data/build1/gedraaid/6-1-2024.json?page=1&date=6-1-2024")
+	newStatus, _ := get(t, server.URL+"/_next/data/"+buildId+"/gedraaid/6-1-2024.json?page=1&date=6-1-2024")
+	_, mainPage := get(t, server.URL+"/")
+
+	// > Assert
+	if oldStatus != http.StatusNotFound || newStatus != http.StatusOK {
+		t.Errorf("Expected only the new buildId to work, got %v and %v", oldStatus, newStatus)
+	}
+	if !strings.Contains(mainPage, `"buildId":"`+buildId+`"`) {
+		t.Errorf("Expected main page to contain new buildId, got %v", mainPage)
+	}
+}
+
+func TestServer_FailuresAndDelays(t *testing.T) {
+	// > Arrange
+	now := time.Date(2024, 1, 6, 12, 0, 0, 0, location)
+	fakeClock := clock.NewFake(now)
+	server := Start(fakeClock, nil)
+	defer server.Close()
+	server.FailNext(http.StatusServiceUnavailable)
+	server.SetDelay(3 * time.Second)
+
+	// > Act
+	first, _ := get(t, server.URL+"/")
+	second, _ := get(t, server.URL+"/")
+
+	// > Assert
+	if first != http.StatusServiceUnavailable || second != http.StatusOK {
+		t.Errorf("Expected only the first request to fail, got %v and %v", first, second)
+	}
+	if elapsed := fakeClock.Now().Sub(now); elapsed != 6*time.Second {
+		t.Errorf("Expected two slow responses to take 6s, took %v", elapsed)
+	}
+	if len(server.Requests()) != 2 {
+		t.Errorf("Expected 2 requests to be recorded, got %v", len(server.Requests()))
+	}
+}
@@ -0,0 +1,98 @@
+package nporadio
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// requestPool runs tasks on a fixed number of workers, so that no more than
+// that many requests are sent to NPO at the same time. Tasks may add more
+// tasks, e.g. for the other pages of a day. As soon as a task fails, the tasks
+// that haven't started yet are dropped.
+type requestPool struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	workers int
+	queue   []func() error
+	// pending counts the tasks that are queued or running
+	pending int
+	err     error
+}
+
+func newRequestPool(workers int) *requestPool {
+	pool := &requestPool{workers: workers}
+	pool.cond = sync.NewCond(&pool.mutex)
+	return pool
+}
+
+// add queues a task, unless a task has already failed
+func (p *requestPool) add(task func() error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.err != nil {
+		return
+	}
+	p.queue = append(p.queue, task)
+	p.pending++
+	p.cond.Signal()
+}
+
+// run returns once all tasks are done, or once the running tasks are done
+// after the first failure, which is then returned
+func (p *requestPool) run() error {
+	var wg sync.WaitGroup
+	for worker := 0; worker < p.workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work()
+		}()
+	}
+	wg.Wait()
+
+	return p.err
+}
+
+func (p *requestPool) work() {
+	for {
+		task := p.next()
+		if task == nil {
+			return
+		}
+		p.done(task())
+	}
+}
+
+// next waits for a task, and returns nil when there is nothing left to do
+func (p *requestPool) next() func() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for len(p.queue) == 0 && p.pending > 0 {
+		p.cond.Wait()
+	}
+	if len(p.queue) == 0 {
+		return nil
+	}
+
+	task := p.queue[0]
+	p.queue = p.queue[1:]
+	return task
+}
+
+func (p *requestPool) done(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.pending--
+	if err != nil && p.err == nil {
+		slog.Debug("Stopped fetching after a failure", "dropped", len(p.queue), "error", err.Error())
+		p.err = err
+		p.pending -= len(p.queue)
+		p.queue = nil
+	}
+	if p.pending == 0 {
+		p.cond.Broadcast()
+	}
+}
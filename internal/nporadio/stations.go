@@ -25,3 +25,8 @@ func GetStationId(station string) (StationId, error) {
 	err := errors.New(fmt.Sprintf("invalid station '%s'", station))
 	return "", err
 }
+
+// Stations returns all stations that Npoleon supports
+func Stations() []StationId {
+	return []StationId{NpoRadio1, NpoRadio2, NpoRadio3}
+}
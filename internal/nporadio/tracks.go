@@ -3,10 +3,20 @@ package nporadio
 import (
 	"fmt"
 	"github.com/google/uuid"
+	"log/slog"
+	"npoleon/internal/clock"
 	"npoleon/internal/util"
+	"sort"
 	"time"
 )
 
+// Used when neither the next play nor the duration of a track is known
+const fallbackDuration = 3 * time.Minute
+
+// Last.fm only accepts scrobbles of tracks that have been played for at least
+// half their duration, or for four minutes
+const maxScrobbleThreshold = 4 * time.Minute
+
 type Response struct {
 	PageProps PageProps `json:"pageProps"`
 }
@@ -36,14 +46,48 @@ type Pagination struct {
 // ----------------------------------------------------------------------------
 
 type Track struct {
-	Id       uuid.UUID
-	Artist   string
-	Title    string
-	PlayedAt time.Time
+	Id          uuid.UUID
+	Artist      string
+	Title       string
+	AlbumArtist string
+	Album       string
+	Duration    time.Duration
+	Mbid        string
+	PlayedAt    time.Time
+	// EndsAt is when the next play in the playlist started, if known
+	EndsAt time.Time
+	// ScrobbledAt replaces PlayedAt as the timestamp that is submitted to
+	// Last.fm, e.g. when an old play is imported into the acceptance window
+	ScrobbledAt time.Time
 }
 
 func (t Track) String() string {
-	return fmt.Sprintf("%s – %s (%s)", t.Artist, t.Title, t.PlayedAt)
+	return fmt.Sprintf("%s – %s (%s)", t.Artist, t.Title, util.FormatTime(t.PlayedAt))
+}
+
+// LogValue adds the fields of a play to log records
+func (t Track) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("id", t.Id.String()),
+		slog.String("artist", t.Artist),
+		slog.String("title", t.Title),
+		slog.Time("played_at", t.PlayedAt),
+	}
+	if t.Duration > 0 {
+		attrs = append(attrs, slog.Duration("duration", t.Duration))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (t Track) ScrobbleTime() time.Time {
+	if t.IsImported() {
+		return t.ScrobbledAt
+	}
+	return t.PlayedAt
+}
+
+func (t Track) IsImported() bool {
+	return !t.ScrobbledAt.IsZero()
 }
 
 func (t Track) PlayIdentifier() string {
@@ -57,11 +101,48 @@ func (t Track) Equal(other Track) bool {
 		t.PlayedAt.Equal(other.PlayedAt)
 }
 
+// End estimates when a track stopped playing. Either the next play or the
+// duration is used, whichever comes first, so that talk breaks between two
+// tracks are not counted.
+func (t Track) End() time.Time {
+	end := t.PlayedAt.Add(fallbackDuration)
+
+	if t.Duration > 0 {
+		end = t.PlayedAt.Add(t.Duration)
+		if !t.EndsAt.IsZero() && t.EndsAt.Before(end) {
+			end = t.EndsAt
+		}
+	} else if !t.EndsAt.IsZero() {
+		end = t.EndsAt
+	}
+
+	return end
+}
+
 func (t Track) IsPlayedAt(moment time.Time) bool {
 	start := t.PlayedAt.Add(-time.Minute)
-	end := t.PlayedAt.Add(3 * time.Minute)
 
-	return moment.After(start) && moment.Before(end)
+	return moment.After(start) && moment.Before(t.End())
+}
+
+func (t Track) IsScrobbleableAt(moment time.Time) bool {
+	return !moment.Before(t.ScrobbleableFrom())
+}
+
+// IsCurrentAt tells whether the track is being played at the moment and has
+// been played long enough to be scrobbled, which is when the live scrobbler
+// scrobbles it
+func (t Track) IsCurrentAt(moment time.Time) bool {
+	return t.IsPlayedAt(moment) && t.IsScrobbleableAt(moment)
+}
+
+func (t Track) ScrobbleableFrom() time.Time {
+	threshold := t.End().Sub(t.PlayedAt) / 2
+	if threshold > maxScrobbleThreshold {
+		threshold = maxScrobbleThreshold
+	}
+
+	return t.PlayedAt.Add(threshold)
 }
 
 // ----------------------------------------------------------------------------
@@ -76,27 +157,89 @@ func (t ByPlayedAt) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
 
 // ----------------------------------------------------------------------------
 
+// inferEndTimes sets the end of each track to the start of the play that
+// followed it
+func inferEndTimes(tracks []Track) {
+	ordered := make([]int, len(tracks))
+	for idx := range ordered {
+		ordered[idx] = idx
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return tracks[ordered[i]].PlayedAt.Before(tracks[ordered[j]].PlayedAt)
+	})
+
+	for idx := 0; idx < len(ordered)-1; idx++ {
+		current := &tracks[ordered[idx]]
+		next := tracks[ordered[idx+1]]
+		if next.PlayedAt.After(current.PlayedAt) {
+			current.EndsAt = next.PlayedAt
+		}
+	}
+}
+
 func convertResponse(response Response) ([]Track, error) {
-	var tracks []Track
+	return convertPlays(response.PageProps.TrackPlays, response.PageProps.InitialValues.Date)
+}
+
+// dateParser reads the dates of playlists in Amsterdam time, regardless of
+// the time zone chosen by the user
+var dateParser = util.CreateTimeParser(clock.Real{})
+
+// convertPlays converts the plays of a single day, which NPO lists from the
+// latest to the earliest play with only a time of day. Shows that run past
+// midnight add plays to the end of the day, so whenever the time of day jumps
+// back while walking through the plays in chronological order, the remaining
+// plays are moved to the next day.
+func convertPlays(plays []Play, date string) ([]Track, error) {
+	if len(plays) == 0 {
+		return nil, nil
+	}
+
+	day, err := dateParser.ParseTime(date)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, play := range response.PageProps.TrackPlays {
-		track, err := convertTrack(play, response.PageProps.InitialValues.Date)
+	tracks := make([]Track, len(plays))
+	var previous time.Time
+	var previousMinutes = -1
+	var dayOffset = 0
+
+	for idx := len(plays) - 1; idx >= 0; idx-- {
+		hour, minute, err := parseTimeOfDay(plays[idx].Time)
+		if err != nil {
+			return []Track{}, err
+		}
+
+		minutes := hour*60 + minute
+		if previousMinutes >= 0 && minutes < previousMinutes-12*60 {
+			dayOffset++
+		}
+		previousMinutes = minutes
+
+		playedAt := util.ResolveLocalTime(day.Time.AddDate(0, 0, dayOffset), hour, minute, previous)
+		track, err := convertTrack(plays[idx], playedAt)
 		if err != nil {
 			return []Track{}, err
 		}
-		tracks = append(tracks, track)
+
+		tracks[idx] = track
+		previous = playedAt
 	}
 
 	return tracks, nil
 }
 
-func convertTrack(play Play, date string) (Track, error) {
-	trackId, err := uuid.Parse(play.Id)
+func parseTimeOfDay(input string) (int, int, error) {
+	res, err := time.Parse("15:04", input)
 	if err != nil {
-		return Track{}, err
+		return 0, 0, err
 	}
+	return res.Hour(), res.Minute(), nil
+}
 
-	playedAt, err := util.ParseTime(date + " " + play.Time)
+func convertTrack(play Play, playedAt time.Time) (Track, error) {
+	trackId, err := uuid.Parse(play.Id)
 	if err != nil {
 		return Track{}, err
 	}
@@ -105,6 +248,6 @@ func convertTrack(play Play, date string) (Track, error) {
 		Id:       trackId,
 		Artist:   play.Artist,
 		Title:    play.Track,
-		PlayedAt: playedAt.Time,
+		PlayedAt: playedAt,
 	}, nil
 }
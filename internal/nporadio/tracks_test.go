@@ -1,9 +1,13 @@
 package nporadio
 
 import (
+	"encoding/json"
 	"github.com/google/uuid"
 	"npoleon/internal/util"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestConvertResponse(t *testing.T) {
@@ -139,4 +143,173 @@ func TestTrack_IsPlayedAt(t *testing.T) {
 			t.Errorf("Track that starts playing in a minute should not be playing")
 		}
 	})
+
+	t.Run("Six minutes after a long track started playing", func(t *testing.T) {
+		// > Arrange
+		now, _ := util.ParseTime("2024-11-11 11:17:00")
+		longTrack := track
+		longTrack.Duration = 8 * time.Minute
+
+		// > Act
+		res := longTrack.IsPlayedAt(now.Time)
+
+		// > Assert
+		if !res {
+			t.Errorf("Track that lasts eight minutes should still be playing")
+		}
+	})
+
+	t.Run("Two minutes after a short track started playing", func(t *testing.T) {
+		// > Arrange
+		now, _ := util.ParseTime("2024-11-11 11:13:00")
+		shortTrack := track
+		shortTrack.Duration = 90 * time.Second
+
+		// > Act
+		res := shortTrack.IsPlayedAt(now.Time)
+
+		// > Assert
+		if res {
+			t.Errorf("Track that lasts ninety seconds should no longer be playing")
+		}
+	})
+}
+
+func TestTrack_End(t *testing.T) {
+	playedAt, _ := util.ParseTime("2024-11-11 11:11:00")
+
+	var testDataTrackEnd = []struct {
+		name     string
+		duration time.Duration
+		endsAt   time.Duration
+		expected time.Duration
+	}{
+		{"Nothing is known", 0, 0, 3 * time.Minute},
+		{"Only the next play is known", 0, 12 * time.Minute, 12 * time.Minute},
+		{"Only the duration is known", 5 * time.Minute, 0, 5 * time.Minute},
+		{"Next play after a talk break", 5 * time.Minute, 11 * time.Minute, 5 * time.Minute},
+		{"Track was cut off early", 5 * time.Minute, 4 * time.Minute, 4 * time.Minute},
+	}
+
+	for _, data := range testDataTrackEnd {
+		t.Run(data.name, func(t *testing.T) {
+			// > Arrange
+			track := Track{PlayedAt: playedAt.Time, Duration: data.duration}
+			if data.endsAt > 0 {
+				track.EndsAt = playedAt.Time.Add(data.endsAt)
+			}
+
+			// > Act
+			res := track.End()
+
+			// > Assert
+			if !res.Equal(playedAt.Time.Add(data.expected)) {
+				t.Errorf("Expected track to end after %v, got %v", data.expected, res.Sub(playedAt.Time))
+			}
+		})
+	}
+}
+
+func TestTrack_IsScrobbleableAt(t *testing.T) {
+	playedAt, _ := util.ParseTime("2024-11-11 11:11:00")
+
+	var testDataIsScrobbleableAt = []struct {
+		name     string
+		duration time.Duration
+		elapsed  time.Duration
+		expected bool
+	}{
+		{"Less than half of a short track", 3 * time.Minute, 80 * time.Second, false},
+		{"Half of a short track", 3 * time.Minute, 90 * time.Second, true},
+		{"Less than four minutes of a long track", 12 * time.Minute, 3 * time.Minute, false},
+		{"Four minutes of a long track", 12 * time.Minute, 4 * time.Minute, true},
+	}
+
+	for _, data := range testDataIsScrobbleableAt {
+		t.Run(data.name, func(t *testing.T) {
+			// > Arrange
+			track := Track{PlayedAt: playedAt.Time, Duration: data.duration}
+
+			// > Act
+			res := track.IsScrobbleableAt(playedAt.Time.Add(data.elapsed))
+
+			// > Assert
+			if res != data.expected {
+				t.Errorf("Expected %v, got %v", data.expected, res)
+			}
+		})
+	}
+}
+
+func TestTrack_IsCurrentAt(t *testing.T) {
+	playedAt, _ := util.ParseTime("2024-11-11 11:11:00")
+	track := Track{PlayedAt: playedAt.Time, Duration: 3 * time.Minute}
+
+	var testDataIsCurrentAt = []struct {
+		name     string
+		elapsed  time.Duration
+		expected bool
+	}{
+		{"Before the track started", -2 * time.Minute, false},
+		{"Less than half of the track", time.Minute, false},
+		{"Half of the track", 90 * time.Second, true},
+		{"After the track ended", 3 * time.Minute, false},
+	}
+
+	for _, data := range testDataIsCurrentAt {
+		t.Run(data.name, func(t *testing.T) {
+			// > Act
+			res := track.IsCurrentAt(playedAt.Time.Add(data.elapsed))
+
+			// > Assert
+			if res != data.expected {
+				t.Errorf("Expected %v, got %v", data.expected, res)
+			}
+		})
+	}
+}
+
+func TestConvertResponse_AcrossMidnight(t *testing.T) {
+	// > Arrange
+	fixture, _ := os.ReadFile("testdata/20-4-2024-1.json")
+	var response Response
+	_ = json.Unmarshal(fixture, &response)
+
+	// > Act
+	res, err := convertResponse(response)
+
+	// > Assert
+	if err != nil || len(res) != 4 {
+		t.Fatalf("Expected 4 tracks, got %v (%v)", len(res), err)
+	}
+	expected := []string{"2024-04-21 00:08", "2024-04-21 00:02", "2024-04-20 23:56", "2024-04-20 23:51"}
+	for idx, track := range res {
+		if track.PlayedAt.Format("2006-01-02 15:04") != expected[idx] {
+			t.Errorf("Expected %v to be played at %v, got %v", track.Title, expected[idx], track.PlayedAt)
+		}
+	}
+}
+
+func TestConvertResponse_UserTimeZone(t *testing.T) {
+	// > Arrange
+	fixture, _ := os.ReadFile("testdata/20-4-2024-1.json")
+	var response Response
+	_ = json.Unmarshal(fixture, &response)
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	util.SetLocation(tokyo)
+	defer util.SetLocation(location)
+
+	// > Act
+	res, err := convertResponse(response)
+
+	// > Assert
+	if err != nil || len(res) != 4 {
+		t.Fatalf("Expected 4 tracks, got %v (%v)", len(res), err)
+	}
+	if res[3].PlayedAt.In(location).Format("2006-01-02 15:04") != "2024-04-20 23:51" {
+		t.Errorf("Expected playlists to be read in Amsterdam time, got %v", res[3].PlayedAt)
+	}
+	if !strings.HasSuffix(res[3].String(), "(2024-04-21 06:51:00 +09:00)") {
+		t.Errorf("Expected the time in Tokyo with its offset, got '%v'", res[3].String())
+	}
 }
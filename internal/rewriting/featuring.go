@@ -0,0 +1,138 @@
+package rewriting
+
+import (
+	"fmt"
+	"npoleon/internal/nporadio"
+	"regexp"
+	"strings"
+)
+
+type FeaturingStrategy string
+
+const (
+	KeepFeaturing  FeaturingStrategy = "keep"
+	MoveFeaturing  FeaturingStrategy = "artist"
+	StripFeaturing FeaturingStrategy = "strip"
+	SplitFeaturing FeaturingStrategy = "album-artist"
+)
+
+const featuringMarker = `(?:feat\.?|ft\.?|featuring)`
+
+var titleFeaturingBracketsRe = regexp.MustCompile(`(?i)^(.*?)\s*[(\[]` + featuringMarker + `\s+([^)\]]+)[)\]](.*)$`)
+var titleFeaturingRe = regexp.MustCompile(`(?i)^(.*?)\s+` + featuringMarker + `\s+(.+)$`)
+var artistFeaturingRe = regexp.MustCompile(`(?i)^(.*?)\s+` + featuringMarker + `\s+(.+)$`)
+var artistJoinRe = regexp.MustCompile(`\s*,\s+|\s+&\s+`)
+var bandJoinRe = regexp.MustCompile(`(?i)\s&\s+(?:the|his|her)\s`)
+
+// bandNames are artists that are joined by "&" or "," but that are a single
+// act rather than an artist featuring others. Names that continue with e.g.
+// "& The" or "& His" are recognized as bands without being listed here.
+var bandNames = map[string]bool{
+	"simon & garfunkel":            true,
+	"earth, wind & fire":           true,
+	"crosby, stills & nash":        true,
+	"crosby, stills, nash & young": true,
+	"hall & oates":                 true,
+	"daryl hall & john oates":      true,
+	"sonny & cher":                 true,
+	"ike & tina turner":            true,
+	"sam & dave":                   true,
+	"peaches & herb":               true,
+	"ashford & simpson":            true,
+	"captain & tennille":           true,
+	"brooks & dunn":                true,
+	"mumford & sons":               true,
+	"chase & status":               true,
+	"kool & the gang":              true,
+	"marcus & martinus":            true,
+	"nick & simon":                 true,
+	"suzan & freek":                true,
+}
+
+func GetFeaturingStrategy(strategy string) (FeaturingStrategy, error) {
+	switch strategy {
+	case "keep", "":
+		return KeepFeaturing, nil
+	case "artist", "move":
+		return MoveFeaturing, nil
+	case "strip":
+		return StripFeaturing, nil
+	case "album-artist", "split":
+		return SplitFeaturing, nil
+	}
+	return "", fmt.Errorf(`invalid strategy "%s", use "keep", "artist", "strip" or "album-artist"`, strategy)
+}
+
+// Apply normalizes featured artists that are marked with e.g. "feat." or "ft.",
+// and artists that are joined by "&" or ",", in which case the first one is
+// the main artist. Known duos and bands, such as Simon & Garfunkel, are left
+// alone.
+func (s FeaturingStrategy) Apply(track nporadio.Track) nporadio.Track {
+	if s == KeepFeaturing || s == "" {
+		return track
+	}
+
+	artist, title, featured := splitFeaturing(track.Artist, track.Title)
+	if len(featured) == 0 {
+		return track
+	}
+
+	switch s {
+	case MoveFeaturing:
+		track.Artist = artist + " feat. " + strings.Join(featured, " & ")
+	case StripFeaturing:
+		track.Artist = artist
+	case SplitFeaturing:
+		track.Artist = artist + " feat. " + strings.Join(featured, " & ")
+		track.AlbumArtist = artist
+	}
+	track.Title = title
+
+	return track
+}
+
+func splitFeaturing(artist string, title string) (string, string, []string) {
+	var featured []string
+
+	if matches := artistFeaturingRe.FindStringSubmatch(artist); matches != nil {
+		artist = strings.TrimSpace(matches[1])
+		featured = append(featured, strings.TrimSpace(matches[2]))
+	} else if artists := splitJoinedArtists(artist); len(artists) > 1 {
+		artist = artists[0]
+		featured = append(featured, artists[1:]...)
+	}
+
+	var fromTitle string
+	if matches := titleFeaturingBracketsRe.FindStringSubmatch(title); matches != nil {
+		title = strings.TrimSpace(matches[1] + matches[3])
+		fromTitle = strings.TrimSpace(matches[2])
+	} else if matches := titleFeaturingRe.FindStringSubmatch(title); matches != nil {
+		title = strings.TrimSpace(matches[1])
+		fromTitle = strings.TrimSpace(matches[2])
+	}
+
+	if fromTitle != "" && !containsFold(featured, fromTitle) {
+		featured = append(featured, fromTitle)
+	}
+
+	return artist, title, featured
+}
+
+// splitJoinedArtists splits e.g. "Marco Borsato, Armin van Buuren & Davina
+// Michelle" into its artists. Commas only separate artists if there is also an
+// "&", as in "Tyler, The Creator" they are part of the name.
+func splitJoinedArtists(artist string) []string {
+	if !strings.Contains(artist, " & ") || bandNames[strings.ToLower(artist)] || bandJoinRe.MatchString(artist) {
+		return []string{artist}
+	}
+	return artistJoinRe.Split(artist, -1)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, existing := range values {
+		if strings.EqualFold(existing, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package rewriting
+
+import (
+	"encoding/json"
+	"npoleon/internal/nporadio"
+	"os"
+	"testing"
+)
+
+func findFixturePlay(t *testing.T, fixture string, title string) nporadio.Track {
+	contents, err := os.ReadFile("../nporadio/testdata/" + fixture)
+	if err != nil {
+		t.Fatalf("Could not read fixture: %v", err)
+	}
+
+	var response nporadio.Response
+	if err = json.Unmarshal(contents, &response); err != nil {
+		t.Fatalf("Could not parse fixture: %v", err)
+	}
+
+	for _, play := range response.PageProps.TrackPlays {
+		if play.Track == title {
+			return nporadio.Track{Artist: play.Artist, Title: play.Track}
+		}
+	}
+
+	t.Fatalf("Fixture %v does not contain '%v'", fixture, title)
+	return nporadio.Track{}
+}
+
+var testDataFeaturingStrategy = []struct {
+	fixture             string
+	title               string
+	strategy            FeaturingStrategy
+	expectedArtist      string
+	expectedTitle       string
+	expectedAlbumArtist string
+}{
+	{"6-1-2024-1.json", "I Love It (feat. Charli XCX)", KeepFeaturing, "Icona Pop", "I Love It (feat. Charli XCX)", ""},
+	{"6-1-2024-1.json", "I Love It (feat. Charli XCX)", MoveFeaturing, "Icona Pop feat. Charli XCX", "I Love It", ""},
+	{"6-1-2024-1.json", "I Love It (feat. Charli XCX)", StripFeaturing, "Icona Pop", "I Love It", ""},
+	{"6-1-2024-1.json", "I Love It (feat. Charli XCX)", SplitFeaturing, "Icona Pop feat. Charli XCX", "I Love It", "Icona Pop"},
+	{"24-12-2023.json", "What You Got (Ayo)", StripFeaturing, "Blanks", "What You Got (Ayo)", ""},
+	{"24-12-2023.json", "Vois sur ton chemin (Techno Mix)", SplitFeaturing, "Bennett", "Vois sur ton chemin (Techno Mix)", ""},
+	{"6-1-2024-1.json", "Hey, Good Lookin'", MoveFeaturing, "Hank Williams", "Hey, Good Lookin'", ""},
+}
+
+func TestFeaturingStrategy_Apply(t *testing.T) {
+	for _, data := range testDataFeaturingStrategy {
+		t.Run(string(data.strategy)+" "+data.title, func(t *testing.T) {
+			// > Arrange
+			track := findFixturePlay(t, data.fixture, data.title)
+
+			// > Act
+			res := data.strategy.Apply(track)
+
+			// > Assert
+			if res.Artist != data.expectedArtist || res.Title != data.expectedTitle {
+				t.Errorf("Expected '%v – %v', got '%v – %v'", data.expectedArtist, data.expectedTitle, res.Artist, res.Title)
+			}
+			if res.AlbumArtist != data.expectedAlbumArtist {
+				t.Errorf("Expected album artist '%v', got '%v'", data.expectedAlbumArtist, res.AlbumArtist)
+			}
+		})
+	}
+}
+
+var testDataSplitFeaturing = []struct {
+	artist           string
+	title            string
+	expectedArtist   string
+	expectedTitle    string
+	expectedFeatured int
+}{
+	{"Icona Pop", "I Love It (feat. Charli XCX) (Radio Edit)", "Icona Pop", "I Love It (Radio Edit)", 1},
+	{"MNDR", "Lock & Load [ft. Killer Mike]", "MNDR", "Lock & Load", 1},
+	{"Calvin Harris featuring Rihanna", "We Found Love", "Calvin Harris", "We Found Love", 1},
+	{"Simon & Garfunkel", "The Boxer", "Simon & Garfunkel", "The Boxer", 0},
+	{"Eminem ft. Rihanna", "Love The Way You Lie Feat. Rihanna", "Eminem", "Love The Way You Lie", 1},
+	{"Featurette", "Feathers", "Featurette", "Feathers", 0},
+	{"Kris Kross Amsterdam & Tabitha", "Wat Is Liefde (feat. Ronnie Flex)", "Kris Kross Amsterdam", "Wat Is Liefde", 2},
+	{"Tyler, The Creator", "EARFQUAKE", "Tyler, The Creator", "EARFQUAKE", 0},
+	{"Calvin Harris & Dua Lipa", "One Kiss", "Calvin Harris", "One Kiss", 1},
+	{"Calvin Harris & Dua Lipa", "One Kiss (feat. Dua Lipa)", "Calvin Harris", "One Kiss", 1},
+	{"Marco Borsato, Armin van Buuren & Davina Michelle", "Hoe Het Danst", "Marco Borsato", "Hoe Het Danst", 2},
+	{"Earth, Wind & Fire", "September", "Earth, Wind & Fire", "September", 0},
+	{"Bob Marley & The Wailers", "Could You Be Loved", "Bob Marley & The Wailers", "Could You Be Loved", 0},
+}
+
+func TestSplitFeaturing(t *testing.T) {
+	for _, data := range testDataSplitFeaturing {
+		t.Run(data.artist+" – "+data.title, func(t *testing.T) {
+			// > Act
+			artist, title, featured := splitFeaturing(data.artist, data.title)
+
+			// > Assert
+			if artist != data.expectedArtist || title != data.expectedTitle {
+				t.Errorf("Expected '%v – %v', got '%v – %v'", data.expectedArtist, data.expectedTitle, artist, title)
+			}
+			if len(featured) != data.expectedFeatured {
+				t.Errorf("Expected %v featured artists, got %v", data.expectedFeatured, featured)
+			}
+		})
+	}
+}
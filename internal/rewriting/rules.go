@@ -0,0 +1,159 @@
+package rewriting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"npoleon/internal/nporadio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rule rewrites the metadata of a track when Field ("artist" or "title")
+// either equals Exact or matches Regex. Artist and Title are templates for the
+// new values: they may refer to regex groups ($1, ${name}) and to the current
+// values of the track ({artist}, {title}).
+type Rule struct {
+	Field  string  `json:"field"`
+	Exact  string  `json:"exact,omitempty"`
+	Regex  string  `json:"regex,omitempty"`
+	Artist *string `json:"artist,omitempty"`
+	Title  *string `json:"title,omitempty"`
+
+	re *regexp.Regexp
+}
+
+type Rules []Rule
+
+type Applied struct {
+	Index  int
+	Rule   Rule
+	Before nporadio.Track
+	After  nporadio.Track
+}
+
+func (a Applied) String() string {
+	return fmt.Sprintf(
+		"rule %d (%s): %s – %s → %s – %s",
+		a.Index+1,
+		a.Rule.describe(),
+		a.Before.Artist,
+		a.Before.Title,
+		a.After.Artist,
+		a.After.Title,
+	)
+}
+
+func LoadRules(path string) (Rules, error) {
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Rules{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseRules(contents)
+}
+
+func ParseRules(contents []byte) (Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(contents, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules file: %w", err)
+	}
+
+	for idx := range rules {
+		if err := rules[idx].compile(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d: %w", idx+1, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// Apply runs all rules in the order in which they were defined. Every rule
+// sees the result of the rules before it.
+func (r Rules) Apply(track nporadio.Track) (nporadio.Track, []Applied) {
+	var applied []Applied
+
+	for idx, rule := range r {
+		after, ok := rule.apply(track)
+		if !ok || (after.Artist == track.Artist && after.Title == track.Title) {
+			continue
+		}
+		applied = append(applied, Applied{
+			Index:  idx,
+			Rule:   rule,
+			Before: track,
+			After:  after,
+		})
+		track = after
+	}
+
+	return track, applied
+}
+
+func (r *Rule) compile() error {
+	if r.Field != "artist" && r.Field != "title" {
+		return fmt.Errorf(`field must be "artist" or "title", got "%s"`, r.Field)
+	}
+	if (r.Exact == "") == (r.Regex == "") {
+		return errors.New(`specify either "exact" or "regex"`)
+	}
+	if r.Artist == nil && r.Title == nil {
+		return errors.New(`specify a new "artist", "title" or both`)
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return err
+		}
+		r.re = re
+	}
+	return nil
+}
+
+func (r Rule) describe() string {
+	if r.re != nil {
+		return fmt.Sprintf("%s ~ /%s/", r.Field, r.Regex)
+	}
+	return fmt.Sprintf("%s = %q", r.Field, r.Exact)
+}
+
+func (r Rule) apply(track nporadio.Track) (nporadio.Track, bool) {
+	value := track.Artist
+	if r.Field == "title" {
+		value = track.Title
+	}
+
+	var expand func(template string) string
+
+	if r.re != nil {
+		match := r.re.FindStringSubmatchIndex(value)
+		if match == nil {
+			return track, false
+		}
+		expand = func(template string) string {
+			return string(r.re.ExpandString(nil, template, value, match))
+		}
+	} else {
+		if value != r.Exact {
+			return track, false
+		}
+		expand = func(template string) string {
+			return template
+		}
+	}
+
+	fields := strings.NewReplacer("{artist}", track.Artist, "{title}", track.Title)
+	result := track
+	if r.Artist != nil {
+		result.Artist = strings.TrimSpace(fields.Replace(expand(*r.Artist)))
+	}
+	if r.Title != nil {
+		result.Title = strings.TrimSpace(fields.Replace(expand(*r.Title)))
+	}
+
+	return result, true
+}
@@ -0,0 +1,73 @@
+package rewriting
+
+import (
+	"npoleon/internal/nporadio"
+	"testing"
+)
+
+const testRules = `[
+	{"field": "artist", "exact": "Beyonce", "artist": "Beyoncé"},
+	{"field": "title", "regex": "^(.*) \\(feat\\. (.+)\\)$", "title": "$1", "artist": "{artist} feat. $2"},
+	{"field": "artist", "exact": "Beyoncé feat. JAY-Z", "artist": "Beyoncé & JAY-Z"}
+]`
+
+var testDataRulesApply = []struct {
+	artist         string
+	title          string
+	expectedArtist string
+	expectedTitle  string
+	expectedRules  int
+}{
+	{"Beyonce", "Halo", "Beyoncé", "Halo", 1},
+	{"Beyonce", "Crazy in Love (feat. JAY-Z)", "Beyoncé & JAY-Z", "Crazy in Love", 3},
+	{"Icona Pop", "I Love It (feat. Charli XCX)", "Icona Pop feat. Charli XCX", "I Love It", 1},
+	{"Beyoncé", "Halo", "Beyoncé", "Halo", 0},
+}
+
+func TestRules_Apply(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	for _, data := range testDataRulesApply {
+		t.Run(data.artist+" – "+data.title, func(t *testing.T) {
+			// > Arrange
+			track := nporadio.Track{Artist: data.artist, Title: data.title}
+
+			// > Act
+			res, applied := rules.Apply(track)
+
+			// > Assert
+			if res.Artist != data.expectedArtist || res.Title != data.expectedTitle {
+				t.Errorf("Expected '%v – %v', got '%v – %v'", data.expectedArtist, data.expectedTitle, res.Artist, res.Title)
+			}
+			if len(applied) != data.expectedRules {
+				t.Errorf("Expected %v applied rules, got %v", data.expectedRules, len(applied))
+			}
+		})
+	}
+}
+
+var testDataParseRules = []string{
+	`{}`,
+	`[{"field": "album", "exact": "x", "artist": "y"}]`,
+	`[{"field": "artist", "artist": "y"}]`,
+	`[{"field": "artist", "exact": "x", "regex": "x", "artist": "y"}]`,
+	`[{"field": "artist", "exact": "x"}]`,
+	`[{"field": "title", "regex": "(", "title": "y"}]`,
+}
+
+func TestParseRules(t *testing.T) {
+	for _, data := range testDataParseRules {
+		t.Run(data, func(t *testing.T) {
+			// > Act
+			_, err := ParseRules([]byte(data))
+
+			// > Assert
+			if err == nil {
+				t.Errorf("Parsing should have failed")
+			}
+		})
+	}
+}
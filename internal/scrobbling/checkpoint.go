@@ -0,0 +1,123 @@
+package scrobbling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"npoleon/internal/locking"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records how far scrobbling a station got, so that a gap can be
+// filled in after the scrobbler has been stopped
+type Checkpoint struct {
+	// Last is when the most recent play that was scrobbled or skipped was
+	// played
+	Last time.Time `json:"last,omitempty"`
+	// Backfill is set while a period in the past is being scrobbled
+	Backfill *Backfill `json:"backfill,omitempty"`
+}
+
+// Backfill remembers the play up to which a backfill of the period from From
+// until Until has been handled, so that it can be resumed when it is
+// interrupted
+type Backfill struct {
+	From     time.Time `json:"from"`
+	Until    time.Time `json:"until"`
+	Progress time.Time `json:"progress"`
+}
+
+// CheckpointFile keeps the checkpoint of a single station. It is locked while
+// it is updated, so that processes that scrobble the same station at the same
+// time don't overwrite each other's progress.
+type CheckpointFile struct {
+	path string
+}
+
+func CreateCheckpointFile(path string) CheckpointFile {
+	return CheckpointFile{path: path}
+}
+
+// Load returns an empty checkpoint if the station hasn't been scrobbled before
+func (f CheckpointFile) Load() (Checkpoint, error) {
+	contents, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	var checkpoint Checkpoint
+	if err = json.Unmarshal(contents, &checkpoint); err != nil {
+		return Checkpoint{}, fmt.Errorf("%s: %w", f.path, err)
+	}
+	return checkpoint, nil
+}
+
+func (f CheckpointFile) update(change func(checkpoint *Checkpoint)) error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	lock, err := locking.Lock(f.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	checkpoint, err := f.Load()
+	if err != nil {
+		return err
+	}
+	change(&checkpoint)
+
+	contents, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(f.path+".tmp", contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.path+".tmp", f.path)
+}
+
+// recordHandled moves the checkpoint forward, but never back, e.g. when a
+// backfill runs alongside a live session. The progress of the backfill that
+// the play is part of, if any, is recorded in the same update.
+func (f CheckpointFile) recordHandled(playedAt time.Time, backfill *Backfill) error {
+	return f.update(func(checkpoint *Checkpoint) {
+		if playedAt.After(checkpoint.Last) {
+			checkpoint.Last = playedAt
+		}
+		if backfill != nil {
+			checkpoint.Backfill = backfill
+		}
+	})
+}
+
+// finishBackfill forgets the backfill, unless it was for a period that this
+// one didn't cover, e.g. because it ran until later
+func (f CheckpointFile) finishBackfill(from time.Time, until time.Time) error {
+	return f.update(func(checkpoint *Checkpoint) {
+		backfill := checkpoint.Backfill
+		if backfill != nil && !backfill.From.After(from) && !backfill.Until.After(until) {
+			checkpoint.Backfill = nil
+		}
+	})
+}
+
+// resumeFrom returns where a backfill from 'from' until 'until' should
+// continue. An interrupted backfill is resumed if it started no later than
+// 'from' and got somewhere within the period, so that a backfill that is
+// started again with e.g. "2h ago" is resumed as well.
+func (c Checkpoint) resumeFrom(from time.Time, until time.Time) time.Time {
+	if c.Backfill == nil || c.Backfill.From.After(from) {
+		return from
+	}
+	if c.Backfill.Progress.After(from) && !c.Backfill.Progress.After(until) {
+		return c.Backfill.Progress
+	}
+	return from
+}
@@ -0,0 +1,165 @@
+package scrobbling
+
+import (
+	"errors"
+	"fmt"
+	"npoleon/internal/clock"
+	"npoleon/internal/http"
+	"npoleon/internal/nporadio"
+	"npoleon/internal/nporadio/fakeserver"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointFile_RecordHandled(t *testing.T) {
+	// > Arrange
+	file := CreateCheckpointFile(filepath.Join(t.TempDir(), "checkpoints", "nporadio2.json"))
+	later := christmasEve("20:00")
+
+	backfill := &Backfill{From: christmasEve("18:00"), Until: christmasEve("21:00"), Progress: christmasEve("19:00")}
+
+	// > Act
+	err := file.recordHandled(later, nil)
+	_ = file.recordHandled(christmasEve("19:00"), backfill)
+	res, _ := file.Load()
+
+	// > Assert
+	if err != nil || !res.Last.Equal(later) {
+		t.Errorf("Expected the checkpoint to stay at %v, got %v (%v)", later, res.Last, err)
+	}
+	if res.Backfill == nil || !res.Backfill.Progress.Equal(backfill.Progress) {
+		t.Errorf("Expected the progress of the backfill to be recorded, got %+v", res.Backfill)
+	}
+}
+
+func TestCheckpoint_ResumeFrom(t *testing.T) {
+	checkpoint := Checkpoint{
+		Backfill: &Backfill{From: christmasEve("18:00"), Until: christmasEve("21:00"), Progress: christmasEve("19:30")},
+	}
+
+	var testData = []struct {
+		name     string
+		from     string
+		until    string
+		expected string
+	}{
+		{"Same period", "18:00", "21:00", "19:30"},
+		{"Relative start that resolved a bit later", "18:02", "21:02", "19:30"},
+		{"Period that starts earlier", "17:00", "21:00", "17:00"},
+		{"Period that ends before the progress", "18:00", "19:00", "18:00"},
+		{"Period that starts after the progress", "20:00", "21:00", "20:00"},
+	}
+
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			// > Act
+			res := checkpoint.resumeFrom(christmasEve(data.from), christmasEve(data.until))
+
+			// > Assert
+			if !res.Equal(christmasEve(data.expected)) {
+				t.Errorf("Expected to start at %v, got %v", data.expected, res.Format("15:04"))
+			}
+		})
+	}
+}
+
+func TestScrobbler_ScrobblePeriod_Checkpoint(t *testing.T) {
+	loc, _ := time.LoadLocation("Europe/Amsterdam")
+	start := time.Date(2024, 1, 6, 20, 0, 0, 0, loc)
+	var plays []fakeserver.Play
+	for idx := 0; idx < 10; idx++ {
+		plays = append(plays, fakeserver.Play{
+			Artist:   "Artist",
+			Title:    fmt.Sprintf("Track %d", idx+1),
+			PlayedAt: start.Add(time.Duration(idx) * 4 * time.Minute),
+		})
+	}
+	until := start.Add(time.Hour)
+
+	fakeClock := clock.NewFake(until)
+	server := fakeserver.Start(fakeClock, plays)
+	defer server.Close()
+
+	createScrobbler := func(file CheckpointFile, lastfmClient fakeLastfmClient) Scrobbler {
+		radioClient, err := nporadio.CreateClientWithBaseUrl(&http.Client{}, nporadio.NpoRadio2, server.URL)
+		if err != nil {
+			t.Fatalf("Creating client failed: %v", err)
+		}
+		scrobbler := CreateScrobbler(radioClient, lastfmClient)
+		scrobbler.SetClock(fakeClock)
+		scrobbler.SetCheckpointFile(file)
+		return scrobbler
+	}
+
+	t.Run("A finished backfill moves the checkpoint to the last play", func(t *testing.T) {
+		// > Arrange
+		file := CreateCheckpointFile(filepath.Join(t.TempDir(), "nporadio2.json"))
+		scrobbler := createScrobbler(file, createFakeLastfmClient())
+
+		// > Act
+		err := scrobbler.ScrobblePeriod(start, until)
+		res, _ := file.Load()
+
+		// > Assert
+		if err != nil || !res.Last.Equal(plays[9].PlayedAt) {
+			t.Errorf("Expected checkpoint at %v, got %v (%v)", plays[9].PlayedAt, res.Last, err)
+		}
+		if res.Backfill != nil {
+			t.Errorf("Expected no backfill in progress, got %+v", res.Backfill)
+		}
+	})
+
+	t.Run("An interrupted backfill is resumed", func(t *testing.T) {
+		// > Arrange
+		file := CreateCheckpointFile(filepath.Join(t.TempDir(), "nporadio2.json"))
+		failingClient := createFakeLastfmClient()
+		failingClient.onScrobble = func() {
+			if len(*failingClient.scrobbled) == 4 {
+				*failingClient.failure = errors.New("Last.fm is down")
+			}
+		}
+		interruptedErr := createScrobbler(file, failingClient).ScrobblePeriod(start, until)
+		resumedClient := createFakeLastfmClient()
+		resumed := createScrobbler(file, resumedClient)
+
+		// > Act
+		err := resumed.ScrobblePeriod(start, until)
+
+		// > Assert
+		if interruptedErr == nil {
+			t.Fatalf("Expected the first backfill to fail")
+		}
+		scrobbled := *resumedClient.scrobbled
+		if err != nil || len(scrobbled) != 7 || scrobbled[0].Title != "Track 4" {
+			t.Errorf("Expected the backfill to resume at Track 4, got %d tracks (%v)", len(scrobbled), err)
+		}
+	})
+
+	t.Run("An interrupted backfill is resumed by a period that starts a bit later", func(t *testing.T) {
+		// > Arrange
+		file := CreateCheckpointFile(filepath.Join(t.TempDir(), "nporadio2.json"))
+		failingClient := createFakeLastfmClient()
+		failingClient.onScrobble = func() {
+			if len(*failingClient.scrobbled) == 4 {
+				*failingClient.failure = errors.New("Last.fm is down")
+			}
+		}
+		_ = createScrobbler(file, failingClient).ScrobblePeriod(start, until)
+		resumedClient := createFakeLastfmClient()
+		resumed := createScrobbler(file, resumedClient)
+
+		// > Act
+		err := resumed.ScrobblePeriod(start.Add(2*time.Minute), until)
+		res, _ := file.Load()
+
+		// > Assert
+		scrobbled := *resumedClient.scrobbled
+		if err != nil || len(scrobbled) != 7 || scrobbled[0].Title != "Track 4" {
+			t.Errorf("Expected the backfill to resume at Track 4, got %d tracks (%v)", len(scrobbled), err)
+		}
+		if res.Backfill != nil {
+			t.Errorf("Expected no backfill in progress, got %+v", res.Backfill)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package scrobbling
+
+import (
+	"npoleon/internal/nporadio"
+	"time"
+)
+
+const DefaultPollInterval = 15 * time.Second
+
+// Adaptive polling never waits longer than maxIdleInterval when nothing is
+// being played, so that short tracks after a talk break are not missed
+const fastPollInterval = 5 * time.Second
+const maxIdleInterval = 45 * time.Second
+const maxPollInterval = 5 * time.Minute
+const transitionLead = 20 * time.Second
+const transitionWindow = 2 * time.Minute
+
+// A poll that comes more than clockJumpTolerance later than planned means that
+// the wall clock jumped, e.g. after a suspend. The gap is then backfilled,
+// starting jumpOverlap before the end of the previous poll.
+const clockJumpTolerance = time.Minute
+const jumpOverlap = 10 * time.Minute
+
+// Polling determines how long the live scrobbler waits before it asks NPO for
+// the current track again. With a fixed interval, errors end the run. In
+// adaptive mode the scrobbler sleeps until the current track can be scrobbled
+// or is about to end, polls faster around transitions, and backs off during
+// talk breaks and after errors.
+type Polling struct {
+	Interval time.Duration
+	Adaptive bool
+}
+
+func (p Polling) interval() time.Duration {
+	if p.Interval <= 0 {
+		return DefaultPollInterval
+	}
+	return p.Interval
+}
+
+func (p Polling) nextDelay(latest *nporadio.Track, now time.Time) time.Duration {
+	if !p.Adaptive || latest == nil {
+		return p.interval()
+	}
+
+	end := latest.End()
+	var delay time.Duration
+
+	switch {
+	case now.Before(latest.ScrobbleableFrom()):
+		delay = latest.ScrobbleableFrom().Sub(now) + time.Second
+	case now.Before(end.Add(-transitionLead)):
+		delay = end.Add(-transitionLead).Sub(now)
+	case now.Before(end.Add(transitionWindow)):
+		delay = fastPollInterval
+	default:
+		// The longer nothing has been played, the less likely it becomes
+		// that the next track starts any second now
+		delay = now.Sub(end) / 4
+		if delay < p.interval() {
+			delay = p.interval()
+		}
+		if delay > maxIdleInterval {
+			delay = maxIdleInterval
+		}
+	}
+
+	return clampDelay(delay, fastPollInterval, maxPollInterval)
+}
+
+func (p Polling) errorBackoff(consecutiveErrors int) time.Duration {
+	delay := p.interval()
+	for i := 1; i < consecutiveErrors && delay < maxPollInterval; i++ {
+		delay *= 2
+	}
+	return clampDelay(delay, fastPollInterval, maxPollInterval)
+}
+
+func clampDelay(delay time.Duration, min time.Duration, max time.Duration) time.Duration {
+	if delay < min {
+		return min
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
@@ -0,0 +1,57 @@
+package scrobbling
+
+import (
+	"npoleon/internal/nporadio"
+	"testing"
+	"time"
+)
+
+func TestPolling_nextDelay(t *testing.T) {
+	playedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	track := &nporadio.Track{PlayedAt: playedAt, Duration: 4 * time.Minute}
+
+	var testDataNextDelay = []struct {
+		name     string
+		polling  Polling
+		track    *nporadio.Track
+		elapsed  time.Duration
+		expected time.Duration
+	}{
+		{"Fixed interval", Polling{Interval: 30 * time.Second}, track, time.Minute, 30 * time.Second},
+		{"Default interval", Polling{}, track, time.Minute, DefaultPollInterval},
+		{"Nothing is known", Polling{Adaptive: true}, nil, 0, DefaultPollInterval},
+		{"Track has just started", Polling{Adaptive: true}, track, 30 * time.Second, 91 * time.Second},
+		{"Track has been scrobbled", Polling{Adaptive: true}, track, 2*time.Minute + time.Second, 99 * time.Second},
+		{"Track is about to end", Polling{Adaptive: true}, track, 3*time.Minute + 50*time.Second, fastPollInterval},
+		{"Track has just ended", Polling{Adaptive: true}, track, 5 * time.Minute, fastPollInterval},
+		{"News has started", Polling{Adaptive: true}, track, 6 * time.Minute, 30 * time.Second},
+		{"Long talk break", Polling{Adaptive: true}, track, 30 * time.Minute, maxIdleInterval},
+	}
+
+	for _, data := range testDataNextDelay {
+		t.Run(data.name, func(t *testing.T) {
+			// > Act
+			res := data.polling.nextDelay(data.track, playedAt.Add(data.elapsed))
+
+			// > Assert
+			if res != data.expected {
+				t.Errorf("Expected %v, got %v", data.expected, res)
+			}
+		})
+	}
+}
+
+func TestPolling_errorBackoff(t *testing.T) {
+	// > Arrange
+	polling := Polling{Interval: 10 * time.Second, Adaptive: true}
+
+	// > Act
+	first := polling.errorBackoff(1)
+	third := polling.errorBackoff(3)
+	many := polling.errorBackoff(100)
+
+	// > Assert
+	if first != 10*time.Second || third != 40*time.Second || many != maxPollInterval {
+		t.Errorf("Unexpected backoff: %v, %v, %v", first, third, many)
+	}
+}
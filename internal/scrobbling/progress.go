@@ -0,0 +1,234 @@
+package scrobbling
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"npoleon/internal/clock"
+	"sync"
+	"time"
+)
+
+// progressLogInterval is how often progress is logged when it isn't shown on
+// a live line
+const progressLogInterval = 30 * time.Second
+
+// Progress reports how far a backfill has got: first how many days and pages
+// of playlists have been fetched, and then how many of the tracks that were
+// found have been scrobbled, skipped or failed. On a terminal it keeps a
+// single line up to date. Otherwise it logs a record every now and then, so
+// that log files don't fill up.
+//
+// The methods that the scrobbler calls do nothing on a nil Progress.
+type Progress struct {
+	mutex *sync.Mutex
+	out   io.Writer
+	live  bool
+	clock clock.Clock
+
+	// shown is set while the live line is on screen
+	shown     bool
+	started   time.Time
+	lastLog   time.Time
+	fetching  bool
+	days      int
+	daysDone  int
+	pages     int
+	found     int
+	scrobbled int
+	skipped   int
+	failed    int
+}
+
+// CreateProgress shows the live line on out, which should be a terminal.
+// Without it, progress is logged.
+func CreateProgress(out io.Writer, live bool) *Progress {
+	return &Progress{
+		mutex: &sync.Mutex{},
+		out:   out,
+		live:  live,
+		clock: clock.Real{},
+	}
+}
+
+func (p *Progress) setClock(clock clock.Clock) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.clock = clock
+}
+
+// StartFetching starts the fetch phase of a new backfill
+func (p *Progress) StartFetching(days int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.fetching = true
+	p.days, p.daysDone, p.pages = days, 0, 0
+	p.found, p.scrobbled, p.skipped, p.failed = 0, 0, 0, 0
+	p.started = p.clock.Now()
+	p.lastLog = p.started
+	p.update()
+}
+
+func (p *Progress) PageFetched() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.pages++
+	p.update()
+}
+
+func (p *Progress) DayFetched(tracks int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.daysDone++
+	p.found += tracks
+	p.update()
+}
+
+// startScrobbling replaces the estimate of the number of tracks with the
+// number of tracks in the range, and restarts the clock for the ETA
+func (p *Progress) startScrobbling(tracks int) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.fetching = false
+	p.found = tracks
+	p.started = p.clock.Now()
+	p.update()
+}
+
+func (p *Progress) trackSkipped(count int) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.skipped += count
+	p.update()
+}
+
+func (p *Progress) trackHandled(skipped bool, err error) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	switch {
+	case err != nil:
+		p.failed++
+	case skipped:
+		p.skipped++
+	default:
+		p.scrobbled++
+	}
+	p.update()
+}
+
+// clear removes the live line, so that other output doesn't end up on it. It
+// is shown again on the next update.
+func (p *Progress) clear() {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.shown {
+		_, _ = fmt.Fprint(p.out, "\r\033[K")
+		p.shown = false
+	}
+}
+
+// finish replaces the live line with a summary, which is also logged when the
+// output isn't a terminal
+func (p *Progress) finish() {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.shown {
+		_, _ = fmt.Fprint(p.out, "\r\033[K")
+		p.shown = false
+	}
+	slog.Info(
+		fmt.Sprintf(
+			"Done: %d track(s) found, %d scrobbled, %d skipped, %d failed",
+			p.found,
+			p.scrobbled,
+			p.skipped,
+			p.failed,
+		),
+		p.attrs(p.clock.Now())...,
+	)
+}
+
+func (p *Progress) update() {
+	now := p.clock.Now()
+	if p.live {
+		_, _ = fmt.Fprint(p.out, "\r\033[K"+p.describe(now))
+		p.shown = true
+		return
+	}
+
+	if now.Sub(p.lastLog) >= progressLogInterval {
+		p.lastLog = now
+		slog.Info("Progress: "+p.describe(now), p.attrs(now)...)
+	}
+}
+
+func (p *Progress) describe(now time.Time) string {
+	if p.fetching {
+		return fmt.Sprintf(
+			"fetched %d/%d day(s), %d page(s), %d track(s) found%s",
+			p.daysDone,
+			p.days,
+			p.pages,
+			p.found,
+			p.eta(now, p.daysDone, p.days),
+		)
+	}
+
+	handled := p.scrobbled + p.skipped + p.failed
+	return fmt.Sprintf(
+		"%d/%d track(s), %d scrobbled, %d skipped, %d failed%s",
+		handled,
+		p.found,
+		p.scrobbled,
+		p.skipped,
+		p.failed,
+		p.eta(now, handled, p.found),
+	)
+}
+
+func (p *Progress) attrs(now time.Time) []any {
+	return []any{
+		"days", p.days,
+		"days_fetched", p.daysDone,
+		"pages", p.pages,
+		"found", p.found,
+		"scrobbled", p.scrobbled,
+		"skipped", p.skipped,
+		"failed", p.failed,
+		"duration", now.Sub(p.started),
+	}
+}
+
+// eta extrapolates the time it took to get this far. It is left out until
+// there is something to extrapolate.
+func (p *Progress) eta(now time.Time, done int, total int) string {
+	if done == 0 || done >= total {
+		return ""
+	}
+	elapsed := now.Sub(p.started)
+	remaining := elapsed * time.Duration(total-done) / time.Duration(done)
+	return fmt.Sprintf(", about %v left", remaining.Round(time.Second))
+}
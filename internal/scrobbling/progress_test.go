@@ -0,0 +1,116 @@
+package scrobbling
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"npoleon/internal/clock"
+	"npoleon/internal/http"
+	"npoleon/internal/logging"
+	"npoleon/internal/nporadio"
+	"npoleon/internal/nporadio/fakeserver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress_Live(t *testing.T) {
+	// > Arrange
+	var out bytes.Buffer
+	fakeClock := clock.NewFake(christmasEve("20:00"))
+	progress := CreateProgress(&out, true)
+	progress.setClock(fakeClock)
+
+	// > Act
+	progress.StartFetching(4)
+	fakeClock.Advance(10 * time.Second)
+	progress.PageFetched()
+	progress.DayFetched(100)
+
+	// > Assert
+	expected := "\r\033[Kfetched 1/4 day(s), 1 page(s), 100 track(s) found, about 30s left"
+	if !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("Expected the live line to end with %q, got %q", expected, out.String())
+	}
+}
+
+// captureLogs makes slog write to a buffer until the test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var out bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewConsoleHandler(&out, slog.LevelInfo)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &out
+}
+
+func TestProgress_Log(t *testing.T) {
+	// > Arrange
+	out := captureLogs(t)
+	fakeClock := clock.NewFake(christmasEve("20:00"))
+	progress := CreateProgress(nil, false)
+	progress.setClock(fakeClock)
+	progress.StartFetching(1)
+	progress.DayFetched(4)
+	progress.startScrobbling(4)
+
+	// > Act
+	for idx := 0; idx < 3; idx++ {
+		fakeClock.Advance(20 * time.Second)
+		progress.trackHandled(idx == 1, nil)
+	}
+	progress.trackHandled(false, errors.New("Last.fm is down"))
+	progress.finish()
+
+	// > Assert
+	expected := "Progress: 2/4 track(s), 1 scrobbled, 1 skipped, 0 failed, about 40s left\n" +
+		"Done: 4 track(s) found, 2 scrobbled, 1 skipped, 1 failed\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestScrobbler_ScrobblePeriod_Progress(t *testing.T) {
+	// > Arrange
+	loc, _ := time.LoadLocation("Europe/Amsterdam")
+	start := time.Date(2024, 1, 5, 22, 0, 0, 0, loc)
+	var plays []fakeserver.Play
+	for idx := 0; idx < 10; idx++ {
+		plays = append(plays, fakeserver.Play{
+			Artist:   "Artist",
+			Title:    fmt.Sprintf("Track %d", idx+1),
+			PlayedAt: start.Add(time.Duration(idx) * 20 * time.Minute),
+		})
+	}
+	fakeClock := clock.NewFake(start.Add(6 * time.Hour))
+	server := fakeserver.Start(fakeClock, plays)
+	defer server.Close()
+
+	radioClient, err := nporadio.CreateClientWithBaseUrl(&http.Client{}, nporadio.NpoRadio2, server.URL)
+	if err != nil {
+		t.Fatalf("Creating client failed: %v", err)
+	}
+	var out bytes.Buffer
+	logs := captureLogs(t)
+	scrobbler := CreateScrobbler(radioClient, createFakeLastfmClient())
+	scrobbler.SetClock(fakeClock)
+	scrobbler.SetProgress(CreateProgress(&out, true))
+
+	// > Act
+	err = scrobbler.ScrobblePeriod(start, start.Add(4*time.Hour))
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "fetched 2/2 day(s)") {
+		t.Errorf("Expected both days to be fetched, got %q", out.String())
+	}
+	if strings.HasSuffix(out.String(), "left") {
+		t.Errorf("Expected the live line to be cleared, got %q", out.String())
+	}
+	expected := "Done: 10 track(s) found, 10 scrobbled, 0 skipped, 0 failed\n"
+	if logs.String() != expected {
+		t.Errorf("Expected %q to be logged, got %q", expected, logs.String())
+	}
+}
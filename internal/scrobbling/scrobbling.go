@@ -1,75 +1,147 @@
 package scrobbling
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"npoleon/internal/clock"
+	"npoleon/internal/filtering"
 	"npoleon/internal/lastfm"
 	"npoleon/internal/nporadio"
+	"npoleon/internal/util"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
-var now = func() time.Time { return time.Now() }
+var errInterrupted = errors.New("interrupted")
 
 type Scrobbler struct {
-	radioClient  nporadio.Client
-	lastfmClient lastfm.ClientInterface
+	radioClient    nporadio.Client
+	lastfmClient   lastfm.ClientInterface
+	outdatedPolicy OutdatedPolicy
+	filter         filtering.Filter
+	clock          clock.Clock
+	polling        Polling
+	checkpoint     *CheckpointFile
+	progress       *Progress
+	interrupt      <-chan os.Signal
 }
 
 func CreateScrobbler(radio nporadio.Client, lastfm lastfm.ClientInterface) Scrobbler {
 	return Scrobbler{
-		radioClient:  radio,
-		lastfmClient: lastfm,
+		radioClient:    radio,
+		lastfmClient:   lastfm,
+		outdatedPolicy: SkipOutdated,
+		clock:          clock.Real{},
+		polling:        Polling{Interval: DefaultPollInterval},
 	}
 }
 
+// SetClock also passes the clock on to the radio client, so that both agree
+// on what time it is
+func (s *Scrobbler) SetClock(clock clock.Clock) {
+	s.clock = clock
+	s.radioClient = s.radioClient.WithClock(clock)
+	if s.progress != nil {
+		s.progress.setClock(clock)
+	}
+}
+
+func (s *Scrobbler) SetPolling(polling Polling) {
+	s.polling = polling
+}
+
+func (s *Scrobbler) SetOutdatedPolicy(policy OutdatedPolicy) {
+	s.outdatedPolicy = policy
+}
+
+func (s *Scrobbler) SetFilter(filter filtering.Filter) {
+	s.filter = filter
+}
+
+// SetProgress reports the progress of backfills, including the playlists that
+// are fetched for them
+func (s *Scrobbler) SetProgress(progress *Progress) {
+	progress.setClock(s.clock)
+	s.progress = progress
+	s.radioClient = s.radioClient.WithProgress(progress)
+}
+
+// SetCheckpointFile makes the scrobbler record its progress, so that it can
+// catch up later and resume interrupted backfills
+func (s *Scrobbler) SetCheckpointFile(file CheckpointFile) {
+	s.checkpoint = &file
+}
+
+// ScrobbleOnce scrobbles the track that is being played, but only once it has
+// been played long enough to be scrobbled. Before that, it tells when it can be
+// scrobbled.
 func (s Scrobbler) ScrobbleOnce() error {
-	track, err := s.radioClient.FetchCurrent()
+	track, err := s.radioClient.FetchLatest()
 	if err != nil {
 		return err
 	}
-	if track == nil {
-		fmt.Println("Nothing is being played right now.")
+
+	now := s.clock.Now()
+	if track == nil || !track.IsPlayedAt(now) {
+		slog.Info("Nothing is being played right now.")
+		return nil
+	}
+	if !track.IsCurrentAt(now) {
+		slog.Info(
+			fmt.Sprintf(
+				"%s hasn't been played long enough to be scrobbled, try again at %s.",
+				track.String(),
+				util.FormatTime(track.ScrobbleableFrom()),
+			),
+			"play", *track,
+			"scrobbleable_from", track.ScrobbleableFrom(),
+		)
 		return nil
 	}
 
-	return s.lastfmClient.Scrobble(*track)
+	return s.scrobble(*track)
 }
 
 func (s Scrobbler) ScrobbleFrom(from time.Time) error {
-	if from.After(now()) {
-		s.waitUntil(from)
+	if from.After(s.clock.Now()) {
+		if err := s.waitUntil(from); err != nil {
+			return ignoreInterruption(err)
+		}
 	}
 
-	err := s.ScrobblePeriod(from, now())
+	err := s.ScrobblePeriod(from, s.clock.Now())
 	if err != nil {
 		return err
 	}
 
-	return s.runUntilConditionIsMet(
-		s.scrobbleCurrentTrack,
+	return ignoreInterruption(s.runUntilConditionIsMet(
+		s.scrobbleCurrentTrack(time.Time{}),
 		func() bool {
 			return false
-		})
+		}))
 }
 
 func (s Scrobbler) ScrobbleUntil(until time.Time) error {
-	return s.runUntilConditionIsMet(
-		s.scrobbleCurrentTrack,
+	return ignoreInterruption(s.runUntilConditionIsMet(
+		s.scrobbleCurrentTrack(until),
 		func() bool {
-			return now().After(until)
+			return s.clock.Now().After(until)
 		},
-	)
+	))
 }
 
 func (s Scrobbler) ScrobblePeriod(from time.Time, until time.Time) error {
-	if from.After(now()) {
-		s.waitUntil(from)
+	if from.After(s.clock.Now()) {
+		if err := s.waitUntil(from); err != nil {
+			return ignoreInterruption(err)
+		}
 	}
 
-	if until.After(now()) {
-		err := s.ScrobblePeriod(from, now())
+	if until.After(s.clock.Now()) {
+		err := s.ScrobblePeriod(from, s.clock.Now())
 		if err != nil {
 			return err
 		}
@@ -82,46 +154,108 @@ func (s Scrobbler) ScrobblePeriod(from time.Time, until time.Time) error {
 		return s.ScrobbleUntil(until)
 	}
 
-	tracks, err := s.radioClient.FetchRange(from, until)
+	start := s.resumeBackfill(from, until)
+	tracks, err := s.radioClient.FetchRange(start, until)
+	if err != nil {
+		s.progress.clear()
+		return err
+	}
+
+	found := len(tracks)
+	s.progress.clear()
+	tracks, err = applyOutdatedPolicy(tracks, s.outdatedPolicy, s.clock.Now())
 	if err != nil {
 		return err
 	}
+	s.progress.startScrobbling(found)
+	s.progress.trackSkipped(found - len(tracks))
+	s.prefetch(tracks)
 
 	for idx, track := range tracks {
-		if err = s.lastfmClient.Scrobble(track); err != nil {
+		s.progress.clear()
+		skipped, err := s.submit(track, &Backfill{From: from, Until: until, Progress: track.PlayedAt})
+		s.progress.trackHandled(skipped, err)
+		if err != nil {
+			s.progress.finish()
 			return err
 		}
 		if idx%20 == 0 {
-			time.Sleep(time.Second)
+			s.clock.Sleep(time.Second)
 		}
 	}
+
+	s.progress.finish()
+	s.saveCheckpoint(func(file CheckpointFile) error {
+		return file.finishBackfill(from, until)
+	})
 	return nil
 }
 
+// resumeBackfill returns where a backfill from 'from' should start. A backfill
+// that was interrupted continues after the last play it handled.
+func (s Scrobbler) resumeBackfill(from time.Time, until time.Time) time.Time {
+	if s.checkpoint == nil {
+		return from
+	}
+
+	checkpoint, err := s.checkpoint.Load()
+	if err != nil {
+		slog.Warn(err.Error())
+		return from
+	}
+
+	start := checkpoint.resumeFrom(from, until)
+	if !start.Equal(from) {
+		slog.Info("Resuming the interrupted backfill from "+util.FormatTime(start), "from", from, "progress", start)
+	}
+	return start
+}
+
+// saveCheckpoint only warns when the checkpoint can't be saved, because that
+// doesn't affect the scrobbles themselves
+func (s Scrobbler) saveCheckpoint(save func(file CheckpointFile) error) {
+	if s.checkpoint == nil {
+		return
+	}
+	if err := save(*s.checkpoint); err != nil {
+		slog.Warn("failed to save checkpoint: " + err.Error())
+	}
+}
+
 func (s Scrobbler) ScrobbleIndefinitely() error {
-	return s.runUntilConditionIsMet(s.scrobbleCurrentTrack, func() bool {
+	return ignoreInterruption(s.runUntilConditionIsMet(s.scrobbleCurrentTrack(time.Time{}), func() bool {
 		return false
-	})
+	}))
 }
 
-func (s Scrobbler) runUntilConditionIsMet(executeTask func() error, conditionMet func() bool) error {
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+// runUntilConditionIsMet returns errInterrupted when the process is asked to
+// stop, which the exported functions treat as a normal way to finish. The task
+// returns how long to wait before it is executed again.
+func (s Scrobbler) runUntilConditionIsMet(executeTask func() (time.Duration, error), conditionMet func() bool) error {
+	sig := s.interrupt
+	if sig == nil {
+		notifications := make(chan os.Signal, 1)
+		signal.Notify(notifications, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(notifications)
+		sig = notifications
+	}
 
-	var remainingSleeps = 0
+	var remainingSleep time.Duration
 
 	for {
 		select {
 		case <-sig:
-			os.Exit(0)
+			return errInterrupted
 		default:
-			if remainingSleeps > 0 {
-				time.Sleep(500 * time.Millisecond)
-				remainingSleeps = remainingSleeps - 1
+			if remainingSleep > 0 {
+				step := min(remainingSleep, 500*time.Millisecond)
+				s.clock.Sleep(step)
+				remainingSleep -= step
 				continue
 			}
 
-			if err := executeTask(); err != nil {
+			delay, err := executeTask()
+			if err != nil {
 				return err
 			}
 
@@ -129,35 +263,185 @@ func (s Scrobbler) runUntilConditionIsMet(executeTask func() error, conditionMet
 				return nil
 			}
 
-			if remainingSleeps == 0 {
-				remainingSleeps = 30
-			}
+			remainingSleep = max(delay, 500*time.Millisecond)
 		}
 	}
 }
 
-func (s Scrobbler) waitUntil(from time.Time) {
-	_ = s.runUntilConditionIsMet(
-		func() error {
-			return nil
+func (s Scrobbler) waitUntil(from time.Time) error {
+	return s.runUntilConditionIsMet(
+		func() (time.Duration, error) {
+			return from.Sub(s.clock.Now()), nil
 		},
 		func() bool {
-			return !from.After(now())
+			return !from.After(s.clock.Now())
 		},
 	)
 }
 
-func (s Scrobbler) scrobbleCurrentTrack() error {
-	track, err := s.radioClient.FetchCurrent()
+func ignoreInterruption(err error) error {
+	if errors.Is(err, errInterrupted) {
+		return nil
+	}
+	return err
+}
+
+// scrobbleCurrentTrack creates a task for runUntilConditionIsMet that keeps
+// track of consecutive errors between polls. When much more time has passed
+// since the previous poll than the scrobbler waited, e.g. because the computer
+// was suspended, the plays that were missed in the meantime are backfilled.
+// Plays after until, if it is set, are left alone, as the task runs once more
+// before the scrobbler notices that the run is over.
+func (s Scrobbler) scrobbleCurrentTrack(until time.Time) func() (time.Duration, error) {
+	var consecutiveErrors = 0
+	var lastIteration time.Time
+	var expectedDelay time.Duration
+
+	return func() (time.Duration, error) {
+		now := s.clock.Now()
+
+		var err error
+		if !lastIteration.IsZero() {
+			err = s.backfillAfterJump(lastIteration, now, expectedDelay, until)
+		}
+
+		var latest *nporadio.Track
+		if err == nil {
+			// Measured once fetching and scrobbling are done, so that a slow
+			// response isn't mistaken for a jump. The gap is tried again after
+			// the next poll if the backfill failed.
+			defer func() {
+				lastIteration = s.clock.Now()
+			}()
+			latest, err = s.radioClient.FetchLatest()
+		}
+
+		now = s.clock.Now()
+		if err == nil && latest != nil && latest.IsCurrentAt(now) &&
+			(until.IsZero() || !latest.PlayedAt.After(until)) {
+			err = s.scrobble(*latest)
+		}
+
+		if err != nil {
+			if !s.polling.Adaptive {
+				return 0, err
+			}
+			consecutiveErrors++
+			slog.Warn(err.Error(), "errors", consecutiveErrors)
+			expectedDelay = s.polling.errorBackoff(consecutiveErrors)
+			return expectedDelay, nil
+		}
+
+		consecutiveErrors = 0
+		expectedDelay = s.polling.nextDelay(latest, now)
+		return expectedDelay, nil
+	}
+}
+
+// backfillAfterJump scrobbles the plays between the end of the previous
+// iteration and now (or until, if that comes first) if the wall clock jumped
+// ahead in between. The monotonic clock is ignored, because it stops while the
+// computer is suspended.
+func (s Scrobbler) backfillAfterJump(lastIteration time.Time, now time.Time, expectedDelay time.Duration, until time.Time) error {
+	elapsed := now.Round(0).Sub(lastIteration.Round(0))
+	if elapsed <= expectedDelay+clockJumpTolerance {
+		return nil
+	}
+
+	slog.Warn(
+		fmt.Sprintf(
+			"%v passed since %s while Npoleon waited %v, scrobbling the tracks played in the meantime",
+			elapsed.Round(time.Second),
+			util.FormatTime(lastIteration),
+			expectedDelay.Round(time.Second),
+		),
+		"since", lastIteration,
+		"duration", elapsed,
+	)
+
+	// The track that was playing during the previous poll may not have been
+	// scrobbleable yet. Plays that were already scrobbled are skipped.
+	end := now
+	if !until.IsZero() && until.Before(end) {
+		end = until
+	}
+	tracks, err := s.radioClient.FetchRange(lastIteration.Add(-jumpOverlap), end)
+	if err != nil {
+		s.progress.clear()
+		return err
+	}
+	found := len(tracks)
+	s.progress.clear()
+	tracks, err = applyOutdatedPolicy(tracks, s.outdatedPolicy, now)
 	if err != nil {
 		return err
 	}
+	s.progress.startScrobbling(found)
+	s.progress.trackSkipped(found - len(tracks))
+	defer s.progress.finish()
+	s.prefetch(tracks)
 
-	if track != nil {
-		if err = s.lastfmClient.Scrobble(*track); err != nil {
+	for _, track := range tracks {
+		if !track.IsScrobbleableAt(now) {
+			// Left to the live scrobbler
+			s.progress.trackSkipped(1)
+			continue
+		}
+		s.progress.clear()
+		skipped, err := s.submit(track, nil)
+		s.progress.trackHandled(skipped, err)
+		if err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
+
+// prefetch lets Last.fm look up the plays of a backfill that will actually be
+// scrobbled, before they are scrobbled one by one
+func (s Scrobbler) prefetch(tracks []nporadio.Track) {
+	var kept []nporadio.Track
+	for _, track := range tracks {
+		if keep, _ := s.filter.Check(track); keep {
+			kept = append(kept, track)
+		}
+	}
+	s.lastfmClient.Prefetch(kept)
+}
+
+// scrobble applies the filter and reports plays that Last.fm ignored without
+// aborting the run
+func (s Scrobbler) scrobble(track nporadio.Track) error {
+	_, err := s.submit(track, nil)
+	return err
+}
+
+// submit returns whether the play was skipped, either by the filter or by
+// Last.fm. The checkpoint is updated along with the backfill that the play is
+// part of, if any.
+func (s Scrobbler) submit(track nporadio.Track, backfill *Backfill) (bool, error) {
+	skipped, err := s.scrobbleOrSkip(track)
+
+	var ignored lastfm.IgnoredError
+	if errors.As(err, &ignored) {
+		slog.Warn(ignored.Error(), "play", track)
+		skipped, err = true, nil
+	} else if errors.Is(err, lastfm.ErrIgnoredBefore) {
+		// Already reported when Last.fm ignored it
+		skipped, err = true, nil
+	}
+
+	if err == nil {
+		s.saveCheckpoint(func(file CheckpointFile) error {
+			return file.recordHandled(track.PlayedAt, backfill)
+		})
+	}
+	return skipped, err
+}
+
+func (s Scrobbler) scrobbleOrSkip(track nporadio.Track) (bool, error) {
+	if keep, reason := s.filter.Check(track); !keep {
+		return true, s.lastfmClient.Skip(track, reason)
+	}
+	return false, s.lastfmClient.Scrobble(track)
+}
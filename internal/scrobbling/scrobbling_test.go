@@ -2,9 +2,18 @@ package scrobbling
 
 import (
 	"fmt"
+	nethttp "net/http"
+	"npoleon/internal/clock"
+	"npoleon/internal/filtering"
 	"npoleon/internal/http"
 	"npoleon/internal/lastfm"
+	lastfmserver "npoleon/internal/lastfm/fakeserver"
 	"npoleon/internal/nporadio"
+	"npoleon/internal/nporadio/fakeserver"
+	"npoleon/internal/rewriting"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -26,6 +35,86 @@ func createFakeHttpClient() http.ClientInterface {
 	return httpClient
 }
 
+// createChristmasEveHttpClient serves the playlist of 24 December 2023, on
+// which FELIZ NAVIDAD was played at 19:54
+func createChristmasEveHttpClient() http.ClientInterface {
+	httpClient := http.FakeClient{Responses: make(map[string][]byte)}
+	httpClient.MakeFetchReturn("https://www.npo3fm.nl/", `{"buildId":"buildId"}`)
+
+	fixture, _ := os.ReadFile("../nporadio/testdata/24-12-2023.json")
+	httpClient.MakeFetchReturn(
+		"https://www.npo3fm.nl/_next/data/buildId/gedraaid/24-12-2023.json?page=1&date=24-12-2023",
+		string(fixture),
+	)
+
+	return httpClient
+}
+
+func christmasEve(clockTime string) time.Time {
+	loc, _ := time.LoadLocation("Europe/Amsterdam")
+	res, _ := time.ParseInLocation("2006-01-02 15:04", "2023-12-24 "+clockTime, loc)
+	return res
+}
+
+// ----------------------------------------------------------------------------
+
+type fakeLastfmClient struct {
+	scrobbled   *[]nporadio.Track
+	onScrobble  func()
+	skipReasons *[]string
+	// failure is returned by Scrobble once it has been set
+	failure    *error
+	prefetched *[]nporadio.Track
+}
+
+func createFakeLastfmClient() fakeLastfmClient {
+	return fakeLastfmClient{
+		scrobbled:   &[]nporadio.Track{},
+		skipReasons: &[]string{},
+		onScrobble:  func() {},
+		failure:     new(error),
+		prefetched:  &[]nporadio.Track{},
+	}
+}
+
+func (f fakeLastfmClient) GetAuthTokenUrl() (string, string, error) { return "", "", nil }
+
+func (f fakeLastfmClient) Login(token string) error { return nil }
+
+func (f fakeLastfmClient) ResumeSession() {}
+
+func (f fakeLastfmClient) Scrobble(track nporadio.Track) error {
+	if *f.failure != nil {
+		return *f.failure
+	}
+	*f.scrobbled = append(*f.scrobbled, track)
+	f.onScrobble()
+	return nil
+}
+
+func (f fakeLastfmClient) Skip(track nporadio.Track, reason string) error {
+	*f.skipReasons = append(*f.skipReasons, reason)
+	return nil
+}
+
+func (f fakeLastfmClient) Enrich(track nporadio.Track) nporadio.Track { return track }
+
+func (f fakeLastfmClient) Prefetch(tracks []nporadio.Track) {
+	*f.prefetched = append(*f.prefetched, tracks...)
+}
+
+func (f fakeLastfmClient) WithRules(rules rewriting.Rules) lastfm.ClientInterface { return f }
+
+func (f fakeLastfmClient) WithFeaturingStrategy(strategy rewriting.FeaturingStrategy) lastfm.ClientInterface {
+	return f
+}
+
+func (f fakeLastfmClient) WithDryRun(dryRun bool) lastfm.ClientInterface { return f }
+
+func (f fakeLastfmClient) VerifySession() (string, error) { return "", nil }
+
+// ----------------------------------------------------------------------------
+
 func TestScrobbler_ScrobbleOnce(t *testing.T) {
 	// > Arrange
 	radioClient, _ := nporadio.CreateClient(createFakeHttpClient(), nporadio.NpoRadio3)
@@ -40,3 +129,520 @@ func TestScrobbler_ScrobbleOnce(t *testing.T) {
 		t.Errorf("Scrobbling failed")
 	}
 }
+
+func TestScrobbler_ScrobbleOnce_TooEarly(t *testing.T) {
+	// > Arrange
+	radioClient, _ := nporadio.CreateClient(createChristmasEveHttpClient(), nporadio.NpoRadio3)
+	lastfmClient := createFakeLastfmClient()
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+
+	scrobbleAt := func(clockTime string) []nporadio.Track {
+		*lastfmClient.scrobbled = nil
+		scrobbler.SetClock(clock.NewFake(christmasEve(clockTime)))
+		if err := scrobbler.ScrobbleOnce(); err != nil {
+			t.Fatalf("Scrobbling failed: %v", err)
+		}
+		return *lastfmClient.scrobbled
+	}
+
+	// > Act
+	early := scrobbleAt("19:55")
+	later := scrobbleAt("19:56")
+
+	// > Assert
+	if len(early) != 0 {
+		t.Errorf("Expected FELIZ NAVIDAD not to be scrobbled a minute after it started, got %v", early)
+	}
+	if len(later) != 1 || later[0].Title != "FELIZ NAVIDAD" {
+		t.Errorf("Expected FELIZ NAVIDAD to be scrobbled once it had been played long enough, got %v", later)
+	}
+}
+
+func TestScrobbler_ScrobbleUntil(t *testing.T) {
+	// > Arrange
+	fakeClock := clock.NewFake(christmasEve("19:50"))
+	radioClient, _ := nporadio.CreateClient(createChristmasEveHttpClient(), nporadio.NpoRadio3)
+	lastfmClient := createFakeLastfmClient()
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+	scrobbler.SetClock(fakeClock)
+	until := christmasEve("19:58")
+
+	// > Act
+	err := scrobbler.ScrobbleUntil(until)
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	if fakeClock.Now().Before(until) || fakeClock.Now().After(until.Add(15*time.Second)) {
+		t.Errorf("Expected scrobbler to stop shortly after %v, stopped at %v", until, fakeClock.Now())
+	}
+	if len(*lastfmClient.scrobbled) == 0 {
+		t.Fatalf("Expected FELIZ NAVIDAD to be scrobbled")
+	}
+	for _, track := range *lastfmClient.scrobbled {
+		if track.Title != "FELIZ NAVIDAD" {
+			t.Errorf("Expected only FELIZ NAVIDAD to be scrobbled, got %v", track.Title)
+		}
+	}
+}
+
+func TestScrobbler_ScrobbleFrom(t *testing.T) {
+	// > Arrange
+	fakeClock := clock.NewFake(christmasEve("19:30"))
+	radioClient, _ := nporadio.CreateClient(createChristmasEveHttpClient(), nporadio.NpoRadio3)
+	lastfmClient := createFakeLastfmClient()
+	interrupt := make(chan os.Signal, 1)
+	lastfmClient.onScrobble = func() {
+		if len(interrupt) == 0 {
+			interrupt <- os.Interrupt
+		}
+	}
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+	scrobbler.SetClock(fakeClock)
+	scrobbler.interrupt = interrupt
+
+	// > Act
+	err := scrobbler.ScrobbleFrom(christmasEve("19:50"))
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	if len(*lastfmClient.scrobbled) != 1 || (*lastfmClient.scrobbled)[0].Title != "FELIZ NAVIDAD" {
+		t.Errorf("Expected FELIZ NAVIDAD to be scrobbled once, got %v", *lastfmClient.scrobbled)
+	}
+	if fakeClock.Now().Before(christmasEve("19:55")) {
+		t.Errorf("FELIZ NAVIDAD was scrobbled before it had been played long enough")
+	}
+}
+
+func TestScrobbler_waitUntil(t *testing.T) {
+	// > Arrange
+	fakeClock := clock.NewFake(christmasEve("12:00"))
+	radioClient, _ := nporadio.CreateClient(createChristmasEveHttpClient(), nporadio.NpoRadio3)
+	scrobbler := CreateScrobbler(radioClient, createFakeLastfmClient())
+	scrobbler.SetClock(fakeClock)
+	from := christmasEve("12:10")
+
+	// > Act
+	err := scrobbler.waitUntil(from)
+
+	// > Assert
+	if err != nil {
+		t.Errorf("Waiting failed: %v", err)
+	}
+	if fakeClock.Now().Before(from) || fakeClock.Now().After(from.Add(15*time.Second)) {
+		t.Errorf("Expected to wait until %v, waited until %v", from, fakeClock.Now())
+	}
+}
+
+type countingHttpClient struct {
+	http.ClientInterface
+	requests *int
+}
+
+func (c countingHttpClient) Fetch(url string) ([]byte, error) {
+	*c.requests++
+	return c.ClientInterface.Fetch(url)
+}
+
+func TestScrobbler_ScrobbleUntil_Adaptive(t *testing.T) {
+	scrobbleWithPolling := func(polling Polling) (int, []nporadio.Track) {
+		fakeClock := clock.NewFake(christmasEve("19:50"))
+		httpClient := countingHttpClient{createChristmasEveHttpClient(), new(int)}
+		radioClient, _ := nporadio.CreateClient(httpClient, nporadio.NpoRadio3)
+		lastfmClient := createFakeLastfmClient()
+		scrobbler := CreateScrobbler(radioClient, lastfmClient)
+		scrobbler.SetClock(fakeClock)
+		scrobbler.SetPolling(polling)
+
+		_ = scrobbler.ScrobbleUntil(christmasEve("20:30"))
+		return *httpClient.requests, *lastfmClient.scrobbled
+	}
+
+	// > Act
+	fixedRequests, _ := scrobbleWithPolling(Polling{Interval: DefaultPollInterval})
+	adaptiveRequests, scrobbled := scrobbleWithPolling(Polling{Adaptive: true})
+
+	// > Assert
+	if len(scrobbled) == 0 || scrobbled[0].Title != "FELIZ NAVIDAD" {
+		t.Errorf("Expected FELIZ NAVIDAD to be scrobbled, got %v", scrobbled)
+	}
+	if adaptiveRequests >= fixedRequests/2 {
+		t.Errorf("Expected adaptive polling to need far fewer than %v requests, got %v", fixedRequests, adaptiveRequests)
+	}
+}
+
+func TestScrobbler_ScrobbleUntil_AdaptiveErrors(t *testing.T) {
+	// > Arrange
+	fakeClock := clock.NewFake(christmasEve("19:50"))
+	httpClient := http.FakeClient{Responses: make(map[string][]byte)}
+	httpClient.MakeFetchReturn("https://www.npo3fm.nl/", `{"buildId":"buildId"}`)
+	radioClient, _ := nporadio.CreateClient(httpClient, nporadio.NpoRadio3)
+	scrobbler := CreateScrobbler(radioClient, createFakeLastfmClient())
+	scrobbler.SetClock(fakeClock)
+	scrobbler.SetPolling(Polling{Adaptive: true})
+
+	// > Act
+	err := scrobbler.ScrobbleUntil(christmasEve("20:30"))
+
+	// > Assert
+	if err != nil {
+		t.Errorf("Adaptive polling should keep retrying after errors, got %v", err)
+	}
+}
+
+func TestScrobbler_ScrobblePeriod_Cassette(t *testing.T) {
+	// > Arrange
+	httpClient, err := http.CreateReplayingClient("testdata/27-10-2024.cassette.json")
+	if err != nil {
+		t.Fatalf("Loading cassette failed: %v", err)
+	}
+	radioClient, _ := nporadio.CreateClient(httpClient, nporadio.NpoRadio2)
+	lastfmClient := createFakeLastfmClient()
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+	loc, _ := time.LoadLocation("Europe/Amsterdam")
+	scrobbler.SetClock(clock.NewFake(time.Date(2024, 10, 28, 12, 0, 0, 0, loc)))
+
+	// > Act
+	err = scrobbler.ScrobblePeriod(
+		time.Date(2024, 10, 27, 0, 0, 0, 0, loc),
+		time.Date(2024, 10, 27, 4, 0, 0, 0, loc),
+	)
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	if len(*lastfmClient.scrobbled) != 6 {
+		t.Errorf("Expected 6 scrobbles, got %v", len(*lastfmClient.scrobbled))
+	}
+	if err = httpClient.Verify(); err != nil {
+		t.Errorf("Requests did not match cassette: %v", err)
+	}
+}
+
+func TestScrobbler_ScrobblePeriod_Prefetch(t *testing.T) {
+	// > Arrange
+	httpClient, _ := http.CreateReplayingClient("testdata/27-10-2024.cassette.json")
+	radioClient, _ := nporadio.CreateClient(httpClient, nporadio.NpoRadio2)
+	lastfmClient := createFakeLastfmClient()
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+	loc, _ := time.LoadLocation("Europe/Amsterdam")
+	scrobbler.SetClock(clock.NewFake(time.Date(2024, 10, 28, 12, 0, 0, 0, loc)))
+	filter, _ := filtering.ParseFilter([]byte(`{"exclude": [{"hours": "0-2"}]}`))
+	scrobbler.SetFilter(filter)
+
+	// > Act
+	err := scrobbler.ScrobblePeriod(
+		time.Date(2024, 10, 27, 0, 0, 0, 0, loc),
+		time.Date(2024, 10, 27, 4, 0, 0, 0, loc),
+	)
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	prefetched := *lastfmClient.prefetched
+	if len(prefetched) == 0 || len(prefetched) != len(*lastfmClient.scrobbled) {
+		t.Errorf("Expected the %v scrobbled tracks to be prefetched, got %v", len(*lastfmClient.scrobbled), prefetched)
+	}
+	for _, track := range prefetched {
+		if keep, _ := filter.Check(track); !keep {
+			t.Errorf("Expected excluded track not to be prefetched, got %v", track)
+		}
+	}
+}
+
+func TestScrobbler_ScrobbleUntil_RecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "christmas-eve.json")
+
+	run := func(httpClient http.ClientInterface) []nporadio.Track {
+		radioClient, _ := nporadio.CreateClient(httpClient, nporadio.NpoRadio3)
+		lastfmClient := createFakeLastfmClient()
+		scrobbler := CreateScrobbler(radioClient, lastfmClient)
+		scrobbler.SetClock(clock.NewFake(christmasEve("19:50")))
+		scrobbler.SetPolling(Polling{Interval: DefaultPollInterval, Adaptive: true})
+
+		if err := scrobbler.ScrobbleUntil(christmasEve("19:58")); err != nil {
+			t.Fatalf("Scrobbling failed: %v", err)
+		}
+		return *lastfmClient.scrobbled
+	}
+
+	// > Arrange
+	recorded := run(http.CreateRecordingClient(createChristmasEveHttpClient(), path))
+	replayer, err := http.CreateReplayingClient(path)
+	if err != nil {
+		t.Fatalf("Loading cassette failed: %v", err)
+	}
+
+	// > Act
+	replayed := run(replayer)
+
+	// > Assert
+	if len(recorded) == 0 || len(replayed) != len(recorded) {
+		t.Errorf("Expected %v scrobbles when replaying, got %v", len(recorded), len(replayed))
+	}
+	if err = replayer.Verify(); err != nil {
+		t.Errorf("Requests did not match cassette: %v", err)
+	}
+}
+
+func TestScrobbler_ScrobbleUntil_FakeServer(t *testing.T) {
+	// > Arrange
+	loc, _ := time.LoadLocation("Europe/Amsterdam")
+	start := time.Date(2024, 1, 6, 20, 0, 0, 0, loc)
+	var plays []fakeserver.Play
+	for idx := 0; idx < 10; idx++ {
+		plays = append(plays, fakeserver.Play{
+			Artist:   "Artist",
+			Title:    fmt.Sprintf("Track %d", idx+1),
+			PlayedAt: start.Add(time.Duration(idx) * 4 * time.Minute),
+		})
+	}
+
+	fakeClock := clock.NewFake(start)
+	server := fakeserver.Start(fakeClock, plays)
+	defer server.Close()
+	server.SetDelay(2 * time.Second)
+
+	radioClient, err := nporadio.CreateClientWithBaseUrl(&http.Client{}, nporadio.NpoRadio2, server.URL)
+	if err != nil {
+		t.Fatalf("Creating client failed: %v", err)
+	}
+	lastfmClient := createFakeLastfmClient()
+	scrobbled := 0
+	lastfmClient.onScrobble = func() {
+		scrobbled++
+		// NPO deploys a new version of its website and has a short outage
+		if scrobbled == 3 {
+			server.Redeploy()
+			server.FailNext(502, 502)
+		}
+	}
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+	scrobbler.SetClock(fakeClock)
+	scrobbler.SetPolling(Polling{Interval: DefaultPollInterval, Adaptive: true})
+
+	// > Act
+	err = scrobbler.ScrobbleUntil(start.Add(40 * time.Minute))
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	titles := make(map[string]bool)
+	for _, track := range *lastfmClient.scrobbled {
+		titles[track.Title] = true
+	}
+	for _, play := range plays {
+		if !titles[play.Title] {
+			t.Errorf("Expected %v to be scrobbled", play.Title)
+		}
+	}
+}
+
+// suspendingClock jumps ahead once it reaches a moment, like the wall clock of
+// a computer that resumes from suspend
+type suspendingClock struct {
+	clock.Fake
+	at       time.Time
+	duration time.Duration
+	resumed  *bool
+}
+
+func (c suspendingClock) Sleep(d time.Duration) {
+	c.Fake.Sleep(d)
+	if !*c.resumed && !c.Now().Before(c.at) {
+		*c.resumed = true
+		c.Advance(c.duration)
+	}
+}
+
+func TestScrobbler_ScrobbleUntil_Suspend(t *testing.T) {
+	// > Arrange
+	loc, _ := time.LoadLocation("Europe/Amsterdam")
+	start := time.Date(2024, 1, 6, 20, 0, 0, 0, loc)
+	var plays []fakeserver.Play
+	for idx := 0; idx < 10; idx++ {
+		plays = append(plays, fakeserver.Play{
+			Artist:   "Artist",
+			Title:    fmt.Sprintf("Track %d", idx+1),
+			PlayedAt: start.Add(time.Duration(idx) * 4 * time.Minute),
+		})
+	}
+
+	fakeClock := clock.NewFake(start)
+	server := fakeserver.Start(fakeClock, plays)
+	defer server.Close()
+
+	radioClient, err := nporadio.CreateClientWithBaseUrl(&http.Client{}, nporadio.NpoRadio2, server.URL)
+	if err != nil {
+		t.Fatalf("Creating client failed: %v", err)
+	}
+	lastfmClient := createFakeLastfmClient()
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+	scrobbler.SetClock(suspendingClock{
+		Fake:     fakeClock,
+		at:       start.Add(5 * time.Minute),
+		duration: 25 * time.Minute,
+		resumed:  new(bool),
+	})
+
+	// > Act
+	err = scrobbler.ScrobbleUntil(start.Add(40 * time.Minute))
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	titles := make(map[string]bool)
+	for _, track := range *lastfmClient.scrobbled {
+		titles[track.Title] = true
+	}
+	for _, play := range plays {
+		if !titles[play.Title] {
+			t.Errorf("Expected %v to be scrobbled", play.Title)
+		}
+	}
+}
+
+func TestScrobbler_ScrobbleUntil_SlowScrobble(t *testing.T) {
+	// > Arrange
+	fakeClock := clock.NewFake(christmasEve("19:50"))
+	radioClient, _ := nporadio.CreateClient(createChristmasEveHttpClient(), nporadio.NpoRadio3)
+	lastfmClient := createFakeLastfmClient()
+	lastfmClient.onScrobble = func() {
+		// Last.fm takes longer to respond than the clock jump tolerance
+		fakeClock.Advance(2 * time.Minute)
+	}
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+	scrobbler.SetClock(fakeClock)
+
+	// > Act
+	err := scrobbler.ScrobbleUntil(christmasEve("19:59"))
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	if len(*lastfmClient.scrobbled) == 0 {
+		t.Fatalf("Expected FELIZ NAVIDAD to be scrobbled")
+	}
+	if len(*lastfmClient.prefetched) != 0 {
+		t.Errorf("Expected a slow scrobble not to be mistaken for a clock jump, got a backfill of %v", *lastfmClient.prefetched)
+	}
+}
+
+func TestScrobbler_ScrobbleUntil_SuspendPastUntil(t *testing.T) {
+	// > Arrange
+	loc, _ := time.LoadLocation("Europe/Amsterdam")
+	start := time.Date(2024, 1, 6, 20, 0, 0, 0, loc)
+	var plays []fakeserver.Play
+	for idx := 0; idx < 30; idx++ {
+		plays = append(plays, fakeserver.Play{
+			Artist:   "Artist",
+			Title:    fmt.Sprintf("Track %d", idx+1),
+			PlayedAt: start.Add(time.Duration(idx) * 4 * time.Minute),
+		})
+	}
+	until := start.Add(20 * time.Minute)
+
+	fakeClock := clock.NewFake(start)
+	server := fakeserver.Start(fakeClock, plays)
+	defer server.Close()
+
+	radioClient, err := nporadio.CreateClientWithBaseUrl(&http.Client{}, nporadio.NpoRadio2, server.URL)
+	if err != nil {
+		t.Fatalf("Creating client failed: %v", err)
+	}
+	lastfmClient := createFakeLastfmClient()
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+	scrobbler.SetClock(suspendingClock{
+		Fake:     fakeClock,
+		at:       start.Add(5 * time.Minute),
+		duration: 2 * time.Hour,
+		resumed:  new(bool),
+	})
+
+	// > Act
+	err = scrobbler.ScrobbleUntil(until)
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	titles := make(map[string]bool)
+	for _, track := range *lastfmClient.scrobbled {
+		titles[track.Title] = true
+		if track.PlayedAt.After(until) {
+			t.Errorf("Expected %v to be left alone, as it was played after --until", track)
+		}
+	}
+	for _, play := range plays[:5] {
+		if !titles[play.Title] {
+			t.Errorf("Expected %v to be scrobbled", play.Title)
+		}
+	}
+}
+
+func TestScrobbler_ScrobbleUntil_Ignored(t *testing.T) {
+	// > Arrange
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	_ = os.MkdirAll(filepath.Join(home, ".npoleon"), 0700)
+
+	loc, _ := time.LoadLocation("Europe/Amsterdam")
+	start := time.Date(2024, 1, 6, 20, 0, 0, 0, loc)
+	fakeClock := clock.NewFake(start)
+	radioServer := fakeserver.Start(fakeClock, []fakeserver.Play{
+		{Artist: "Spam", Title: "Jingle", PlayedAt: start.Add(-2 * time.Minute)},
+	})
+	defer radioServer.Close()
+	lastfmServer := lastfmserver.Start(fakeClock, "key", "secret")
+	defer lastfmServer.Close()
+	lastfmServer.AddSession("session")
+	lastfmServer.IgnoreArtist("Spam")
+
+	createApi := lastfm.CreateApi
+	defer func() { lastfm.CreateApi = createApi }()
+	lastfm.CreateApi = func(key string, secret string) lastfm.ApiInterface {
+		return lastfm.CreateApiWithBaseUrl(key, secret, nethttp.DefaultClient, lastfmServer.URL)
+	}
+
+	radioClient, err := nporadio.CreateClientWithBaseUrl(&http.Client{}, nporadio.NpoRadio2, radioServer.URL)
+	if err != nil {
+		t.Fatalf("Creating client failed: %v", err)
+	}
+	lastfmClient, _ := lastfm.CreateAuthenticatedClient("key", "secret", "session")
+	scrobbler := CreateScrobbler(radioClient, lastfmClient)
+	scrobbler.SetClock(fakeClock)
+
+	// > Act
+	err = scrobbler.ScrobbleUntil(start.Add(DefaultPollInterval + time.Second))
+
+	// > Assert
+	if err != nil {
+		t.Fatalf("Scrobbling failed: %v", err)
+	}
+	polls := 0
+	submitted := 0
+	for _, method := range lastfmServer.Requests() {
+		if method == "track.scrobble" {
+			submitted++
+		}
+	}
+	for _, path := range radioServer.Requests() {
+		if strings.Contains(path, "/gedraaid/") {
+			polls++
+		}
+	}
+	if polls < 2 {
+		t.Fatalf("Expected at least 2 polls, got %v", polls)
+	}
+	if submitted != 1 {
+		t.Errorf("Expected the ignored play to be submitted once, got %v", submitted)
+	}
+}
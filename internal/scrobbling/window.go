@@ -0,0 +1,117 @@
+package scrobbling
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"npoleon/internal/nporadio"
+	"npoleon/internal/util"
+	"sort"
+	"time"
+)
+
+// Last.fm silently ignores scrobbles that are older than two weeks. The margin
+// prevents tracks near the edge from expiring while a backfill is running.
+const acceptanceWindow = 14 * 24 * time.Hour
+const acceptanceMargin = time.Hour
+
+type OutdatedPolicy string
+
+const (
+	SkipOutdated   OutdatedPolicy = "skip"
+	RefuseOutdated OutdatedPolicy = "refuse"
+	RetimeOutdated OutdatedPolicy = "retime"
+)
+
+func GetOutdatedPolicy(policy string) (OutdatedPolicy, error) {
+	switch policy {
+	case "skip", "":
+		return SkipOutdated, nil
+	case "refuse":
+		return RefuseOutdated, nil
+	case "retime", "import":
+		return RetimeOutdated, nil
+	}
+	return "", fmt.Errorf(`invalid policy "%s", use "skip", "refuse" or "retime"`, policy)
+}
+
+func windowStart(moment time.Time) time.Time {
+	return moment.Add(-acceptanceWindow).Add(acceptanceMargin)
+}
+
+func isOutdated(track nporadio.Track, moment time.Time) bool {
+	return track.PlayedAt.Before(windowStart(moment))
+}
+
+func applyOutdatedPolicy(tracks []nporadio.Track, policy OutdatedPolicy, moment time.Time) ([]nporadio.Track, error) {
+	var outdated int
+	for _, track := range tracks {
+		if isOutdated(track, moment) {
+			outdated++
+		}
+	}
+
+	if outdated == 0 {
+		return tracks, nil
+	}
+
+	switch policy {
+	case RefuseOutdated:
+		msg := fmt.Sprintf(
+			"%d track(s) were played before %s and would be ignored by Last.fm",
+			outdated,
+			util.FormatTime(windowStart(moment)),
+		)
+		return nil, errors.New(msg)
+	case RetimeOutdated:
+		return retimeOutdated(tracks, moment)
+	default:
+		var result []nporadio.Track
+		for _, track := range tracks {
+			if isOutdated(track, moment) {
+				slog.Warn("skipping "+track.String()+" because it is too old for Last.fm", "play", track)
+				continue
+			}
+			result = append(result, track)
+		}
+		return result, nil
+	}
+}
+
+// retimeOutdated places the outdated plays back to back at the start of the
+// acceptance window, in the order in which they were played. Each play keeps
+// its own length, but the gaps between them are left out, so that as many
+// plays as possible fit in before the plays that don't need to be moved. Plays
+// that would end up at the same time as one of those are refused.
+func retimeOutdated(tracks []nporadio.Track, moment time.Time) ([]nporadio.Track, error) {
+	result := make([]nporadio.Track, len(tracks))
+	copy(result, tracks)
+	sort.Stable(nporadio.ByPlayedAt(result))
+
+	// The first play inside the window, or the current time if there is none
+	limit := moment
+	for _, track := range result {
+		if !isOutdated(track, moment) && track.PlayedAt.Before(limit) {
+			limit = track.PlayedAt
+		}
+	}
+
+	next := windowStart(moment)
+	for idx, track := range result {
+		if !isOutdated(track, moment) {
+			continue
+		}
+		if !next.Before(limit) {
+			return nil, fmt.Errorf(
+				"the tracks played before %s don't fit between %s and %s without colliding with other plays, "+
+					"scrobble them in a separate run using --until, or use --outdated skip",
+				util.FormatTime(track.PlayedAt),
+				util.FormatTime(windowStart(moment)),
+				util.FormatTime(limit),
+			)
+		}
+		result[idx].ScrobbledAt = next
+		next = next.Add(track.End().Sub(track.PlayedAt))
+	}
+	return result, nil
+}
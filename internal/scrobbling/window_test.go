@@ -0,0 +1,117 @@
+package scrobbling
+
+import (
+	"github.com/google/uuid"
+	"npoleon/internal/nporadio"
+	"testing"
+	"time"
+)
+
+func TestApplyOutdatedPolicy(t *testing.T) {
+	moment := time.Date(2024, 2, 20, 12, 0, 0, 0, time.UTC)
+	tracks := []nporadio.Track{
+		{Id: uuid.New(), Artist: "Doe Maar", Title: "Smoorverliefd", PlayedAt: moment.AddDate(0, 0, -20)},
+		{Id: uuid.New(), Artist: "Golden Earring", Title: "Radar Love", PlayedAt: moment.AddDate(0, 0, -2)},
+	}
+
+	t.Run("Outdated tracks are skipped", func(t *testing.T) {
+		// > Act
+		res, err := applyOutdatedPolicy(tracks, SkipOutdated, moment)
+
+		// > Assert
+		if err != nil {
+			t.Errorf("Skipping outdated tracks should not fail: %v", err)
+		}
+		if len(res) != 1 || res[0].Title != "Radar Love" {
+			t.Errorf("Expected only the recent track, got %v", res)
+		}
+	})
+
+	t.Run("Outdated tracks refuse the run", func(t *testing.T) {
+		// > Act
+		_, err := applyOutdatedPolicy(tracks, RefuseOutdated, moment)
+
+		// > Assert
+		if err == nil {
+			t.Errorf("Outdated tracks should have been refused")
+		}
+	})
+
+	t.Run("Outdated tracks are moved into the window", func(t *testing.T) {
+		// > Act
+		res, _ := applyOutdatedPolicy(tracks, RetimeOutdated, moment)
+
+		// > Assert
+		if len(res) != 2 {
+			t.Fatalf("Expected 2 tracks, got %v", len(res))
+		}
+		if !res[0].IsImported() || isOutdated(nporadio.Track{PlayedAt: res[0].ScrobbleTime()}, moment) {
+			t.Errorf("Track was not moved into the window: %v", res[0].ScrobbleTime())
+		}
+		if res[1].IsImported() {
+			t.Errorf("Recent track should not be imported")
+		}
+	})
+}
+
+func TestApplyOutdatedPolicy_Retime(t *testing.T) {
+	moment := time.Date(2024, 2, 20, 12, 0, 0, 0, time.UTC)
+	twoPm := func(daysAgo int) time.Time {
+		return time.Date(2024, 2, 20-daysAgo, 14, 0, 0, 0, time.UTC)
+	}
+
+	t.Run("Plays from different days keep their order", func(t *testing.T) {
+		// > Arrange
+		tracks := []nporadio.Track{
+			{Id: uuid.New(), Title: "Smoorverliefd", PlayedAt: twoPm(27), Duration: 4 * time.Minute},
+			{Id: uuid.New(), Title: "Radar Love", PlayedAt: twoPm(20), Duration: 6 * time.Minute},
+			{Id: uuid.New(), Title: "Zing, Vecht, Huil, Bid", PlayedAt: twoPm(2)},
+		}
+
+		// > Act
+		res, err := applyOutdatedPolicy(tracks, RetimeOutdated, moment)
+
+		// > Assert
+		if err != nil {
+			t.Fatalf("Retiming should not fail: %v", err)
+		}
+		first, second := res[0].ScrobbleTime(), res[1].ScrobbleTime()
+		if !first.Equal(windowStart(moment)) {
+			t.Errorf("Expected the oldest play at the start of the window, got %v", first)
+		}
+		if !second.Equal(first.Add(4 * time.Minute)) {
+			t.Errorf("Expected the next play right after the first one, got %v", second)
+		}
+		if res[2].IsImported() {
+			t.Errorf("Recent track should not be imported")
+		}
+	})
+
+	t.Run("Plays that would collide with plays in the window are refused", func(t *testing.T) {
+		// > Arrange
+		tracks := []nporadio.Track{
+			{Id: uuid.New(), Title: "Smoorverliefd", PlayedAt: twoPm(27)},
+			{Id: uuid.New(), Title: "Radar Love", PlayedAt: twoPm(20)},
+			{Id: uuid.New(), Title: "Zing, Vecht, Huil, Bid", PlayedAt: windowStart(moment).Add(time.Minute)},
+		}
+
+		// > Act
+		_, err := applyOutdatedPolicy(tracks, RetimeOutdated, moment)
+
+		// > Assert
+		if err == nil {
+			t.Errorf("Expected the second play to be refused, as it would collide with the third")
+		}
+	})
+}
+
+func TestGetOutdatedPolicy(t *testing.T) {
+	for _, input := range []string{"skip", "refuse", "retime"} {
+		if _, err := GetOutdatedPolicy(input); err != nil {
+			t.Errorf("Policy '%v' should be valid", input)
+		}
+	}
+	if _, err := GetOutdatedPolicy("ignore"); err == nil {
+		t.Errorf("Policy 'ignore' should be invalid")
+	}
+}
@@ -0,0 +1,367 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// offsetUnits maps the (English and Dutch) names of units to their length.
+// Days and weeks are calendar days, so "3 days ago" is at the same time of
+// day, even when clocks have been changed in the meantime.
+var offsetUnits = map[string]struct {
+	duration time.Duration
+	days     int
+}{
+	"s":        {duration: time.Second},
+	"sec":      {duration: time.Second},
+	"secs":     {duration: time.Second},
+	"second":   {duration: time.Second},
+	"seconds":  {duration: time.Second},
+	"seconde":  {duration: time.Second},
+	"seconden": {duration: time.Second},
+	"m":        {duration: time.Minute},
+	"min":      {duration: time.Minute},
+	"mins":     {duration: time.Minute},
+	"minute":   {duration: time.Minute},
+	"minutes":  {duration: time.Minute},
+	"minuut":   {duration: time.Minute},
+	"minuten":  {duration: time.Minute},
+	"h":        {duration: time.Hour},
+	"hr":       {duration: time.Hour},
+	"hrs":      {duration: time.Hour},
+	"hour":     {duration: time.Hour},
+	"hours":    {duration: time.Hour},
+	"u":        {duration: time.Hour},
+	"uur":      {duration: time.Hour},
+	"uren":     {duration: time.Hour},
+	"d":        {days: 1},
+	"day":      {days: 1},
+	"days":     {days: 1},
+	"dag":      {days: 1},
+	"dagen":    {days: 1},
+	"w":        {days: 7},
+	"week":     {days: 7},
+	"weeks":    {days: 7},
+	"weken":    {days: 7},
+}
+
+var offsetPartRegex = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)\s*([a-z]+)$`)
+var offsetSplitRegex = regexp.MustCompile(`(\d+(?:[.,]\d+)?\s*[a-z]+)`)
+
+// offset is an amount of time that may consist of calendar days and a
+// duration, e.g. "1 day 2h"
+type offset struct {
+	days     int
+	duration time.Duration
+}
+
+// parseOffset parses amounts like "90m", "1h30m", "2 hours" and "1 uur en 30
+// minuten"
+func parseOffset(input string) (offset, bool) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return offset{}, false
+	}
+
+	remainder := offsetSplitRegex.ReplaceAllString(input, "")
+	for _, word := range strings.Fields(remainder) {
+		if word != "and" && word != "en" {
+			return offset{}, false
+		}
+	}
+
+	var res offset
+	for _, part := range offsetSplitRegex.FindAllString(input, -1) {
+		matches := offsetPartRegex.FindStringSubmatch(part)
+		if matches == nil {
+			return offset{}, false
+		}
+		unit, ok := offsetUnits[matches[2]]
+		if !ok {
+			return offset{}, false
+		}
+		amount, err := strconv.ParseFloat(strings.Replace(matches[1], ",", ".", 1), 64)
+		if err != nil {
+			return offset{}, false
+		}
+
+		if unit.days > 0 && amount == float64(int(amount)) {
+			res.days += int(amount) * unit.days
+			continue
+		}
+		if unit.days > 0 {
+			unit.duration = time.Duration(unit.days) * 24 * time.Hour
+		}
+		res.duration += time.Duration(amount * float64(unit.duration))
+	}
+	return res, true
+}
+
+// ParseDuration parses a positive duration, either in Go's notation ("1h30m")
+// or as an amount of time such as "90 minutes" or "2 uur". Days are always 24
+// hours long.
+func ParseDuration(input string) (time.Duration, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+
+	duration, err := time.ParseDuration(input)
+	if err != nil {
+		res, ok := parseOffset(input)
+		if !ok {
+			return 0, fmt.Errorf("failed to parse duration '%v'", input)
+		}
+		duration = time.Duration(res.days)*24*time.Hour + res.duration
+	}
+
+	if duration <= 0 {
+		return 0, errors.New(fmt.Sprintf("duration '%v' must be positive", input))
+	}
+	return duration, nil
+}
+
+// dayPart is a named part of the day, e.g. the evening from 18:00 to 24:00
+type dayPart struct {
+	from  int
+	until int
+}
+
+var dayParts = map[string]dayPart{
+	"night":     {from: 0, until: 6},
+	"nacht":     {from: 0, until: 6},
+	"morning":   {from: 6, until: 12},
+	"ochtend":   {from: 6, until: 12},
+	"afternoon": {from: 12, until: 18},
+	"middag":    {from: 12, until: 18},
+	"evening":   {from: 18, until: 24},
+	"avond":     {from: 18, until: 24},
+}
+
+// relativeDays are the days that are named relative to today
+var relativeDays = map[string]int{
+	"today":       0,
+	"vandaag":     0,
+	"yesterday":   -1,
+	"gisteren":    -1,
+	"eergisteren": -2,
+	"tomorrow":    1,
+	"morgen":      1,
+	"overmorgen":  2,
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"sun":       time.Sunday,
+	"zondag":    time.Sunday,
+	"monday":    time.Monday,
+	"mon":       time.Monday,
+	"maandag":   time.Monday,
+	"tuesday":   time.Tuesday,
+	"tue":       time.Tuesday,
+	"dinsdag":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"wed":       time.Wednesday,
+	"woensdag":  time.Wednesday,
+	"thursday":  time.Thursday,
+	"thu":       time.Thursday,
+	"donderdag": time.Thursday,
+	"friday":    time.Friday,
+	"fri":       time.Friday,
+	"vrijdag":   time.Friday,
+	"saturday":  time.Saturday,
+	"sat":       time.Saturday,
+	"zaterdag":  time.Saturday,
+}
+
+// compounds are (mostly Dutch) words and phrases that name a day and a part
+// of it
+var compounds = map[string][]string{
+	"tonight":        {"today", "evening"},
+	"vanochtend":     {"today", "morning"},
+	"vanmorgen":      {"today", "morning"},
+	"vanmiddag":      {"today", "afternoon"},
+	"vanavond":       {"today", "evening"},
+	"vannacht":       {"today", "night"},
+	"gisterochtend":  {"yesterday", "morning"},
+	"gistermorgen":   {"yesterday", "morning"},
+	"gistermiddag":   {"yesterday", "afternoon"},
+	"gisteravond":    {"yesterday", "evening"},
+	"gisternacht":    {"yesterday", "night"},
+	"morgenochtend":  {"tomorrow", "morning"},
+	"morgenvroeg":    {"tomorrow", "morning"},
+	"morgenmiddag":   {"tomorrow", "afternoon"},
+	"morgenavond":    {"tomorrow", "evening"},
+	"morgennacht":    {"tomorrow", "night"},
+	"this morning":   {"today", "morning"},
+	"this afternoon": {"today", "afternoon"},
+	"this evening":   {"today", "evening"},
+	"last night":     {"today", "night"},
+}
+
+var lastWords = map[string]bool{"last": true, "previous": true, "vorige": true, "afgelopen": true}
+var nextWords = map[string]bool{"next": true, "coming": true, "volgende": true, "komende": true}
+
+var clockTimeRegex = regexp.MustCompile(`^(\d{1,2})[:.](\d{2})(?:[:.](\d{2}))?$`)
+
+// parseExpression understands relative and natural-language expressions, in
+// English and Dutch, e.g. "2h ago", "in 30 minutes", "yesterday 18:00", "last
+// friday", "gisteravond" or "vanochtend". The result covers the whole period
+// that the expression refers to, so that "yesterday" starts at 00:00 when used
+// with --from, and ends at 23:59:59 when used with --until.
+func (p TimeParser) parseExpression(input string) (TimeParseResult, bool) {
+	input = strings.Join(strings.Fields(strings.ToLower(input)), " ")
+	now := p.clock.Now().In(p.location)
+
+	if input == "now" || input == "nu" {
+		return TimeParseResult{Time: now}, true
+	}
+
+	if res, ok := parseRelativeExpression(input, now); ok {
+		return TimeParseResult{Time: res}, true
+	}
+
+	return parseDayExpression(input, now)
+}
+
+// parseRelativeExpression parses offsets from now, e.g. "2h ago", "3 dagen
+// geleden", "in 10 minutes" or "over 2 uur"
+func parseRelativeExpression(input string, now time.Time) (time.Time, bool) {
+	sign := 0
+	for _, suffix := range []string{" ago", " geleden"} {
+		if strings.HasSuffix(input, suffix) {
+			input, sign = strings.TrimSuffix(input, suffix), -1
+		}
+	}
+	for _, prefix := range []string{"in ", "over "} {
+		if sign == 0 && strings.HasPrefix(input, prefix) {
+			input, sign = strings.TrimPrefix(input, prefix), 1
+		}
+	}
+	if sign == 0 {
+		return time.Time{}, false
+	}
+
+	res, ok := parseOffset(input)
+	if !ok {
+		duration, err := time.ParseDuration(input)
+		if err != nil {
+			return time.Time{}, false
+		}
+		res = offset{duration: duration}
+	}
+
+	return now.AddDate(0, 0, sign*res.days).Add(time.Duration(sign) * res.duration), true
+}
+
+// parseDayExpression parses a day, optionally followed by a part of the day or
+// a time, e.g. "yesterday", "last friday 08:00" or "zaterdag avond"
+func parseDayExpression(input string, now time.Time) (TimeParseResult, bool) {
+	for compound, expansion := range compounds {
+		if input == compound || strings.HasPrefix(input, compound+" ") {
+			input = strings.Join(expansion, " ") + strings.TrimPrefix(input, compound)
+			break
+		}
+	}
+	words := strings.Fields(input)
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	day, words, ok := parseDay(words, today)
+	if !ok {
+		// A part of the day on its own refers to today, e.g. "evening"
+		if len(words) != 1 {
+			return TimeParseResult{}, false
+		}
+		day = today
+	}
+
+	if len(words) == 0 {
+		return TimeParseResult{Time: day, end: day.AddDate(0, 0, 1)}, true
+	}
+	if len(words) != 1 {
+		return TimeParseResult{}, false
+	}
+
+	if part, found := dayParts[words[0]]; found {
+		return TimeParseResult{Time: atHour(day, part.from), end: atHour(day, part.until)}, true
+	}
+	if !ok {
+		// A time on its own is handled by ParseTime
+		return TimeParseResult{}, false
+	}
+
+	matches := clockTimeRegex.FindStringSubmatch(words[0])
+	if matches == nil {
+		return TimeParseResult{}, false
+	}
+	hour, _ := strconv.Atoi(matches[1])
+	minute, _ := strconv.Atoi(matches[2])
+	second, _ := strconv.Atoi(matches[3])
+	if hour > 23 || minute > 59 || second > 59 {
+		return TimeParseResult{}, false
+	}
+
+	res := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, second, 0, day.Location())
+	if matches[3] == "" {
+		return TimeParseResult{Time: res, end: res.Add(time.Minute)}, true
+	}
+	return TimeParseResult{Time: res, end: res.Add(time.Second)}, true
+}
+
+// parseDay consumes the words that name a day, e.g. "yesterday" or "last
+// friday", and returns the start of that day and the remaining words
+func parseDay(words []string, today time.Time) (time.Time, []string, bool) {
+	if len(words) == 0 {
+		return time.Time{}, words, false
+	}
+
+	if days, ok := relativeDays[words[0]]; ok {
+		return today.AddDate(0, 0, days), words[1:], true
+	}
+
+	direction := 0
+	if lastWords[words[0]] {
+		direction = -1
+	} else if nextWords[words[0]] {
+		direction = 1
+	}
+	if direction != 0 {
+		words = words[1:]
+		if len(words) == 0 {
+			return time.Time{}, words, false
+		}
+	}
+
+	weekday, ok := weekdays[words[0]]
+	if !ok {
+		return time.Time{}, words, false
+	}
+
+	// A weekday on its own refers to the most recent one, which may be today
+	if direction >= 0 {
+		days := (int(weekday) - int(today.Weekday()) + 7) % 7
+		if direction == 0 && days > 0 {
+			days -= 7
+		}
+		if direction == 1 && days == 0 {
+			days = 7
+		}
+		return today.AddDate(0, 0, days), words[1:], true
+	}
+
+	days := (int(today.Weekday()) - int(weekday) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	return today.AddDate(0, 0, -days), words[1:], true
+}
+
+// atHour returns the given hour on a day, where hour 24 is midnight at the end
+// of the day
+func atHour(day time.Time, hour int) time.Time {
+	if hour == 24 {
+		return day.AddDate(0, 0, 1)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, day.Location())
+}
@@ -1,34 +1,115 @@
 package util
 
 import (
-	"errors"
 	"fmt"
+	"npoleon/internal/clock"
+	"sort"
 	"strings"
 	"time"
 )
 
-var now = func() time.Time { return time.Now() }
+// NPO publishes its playlists in Amsterdam time
 var loc, _ = time.LoadLocation("Europe/Amsterdam")
 
+// userLoc is the time zone in which the user enters times, and in which times
+// are shown
+var userLoc = loc
+
+// displayFormat always includes the offset, so that times are unambiguous
+// for users outside the Netherlands
+const displayFormat = "2006-01-02 15:04:05 -07:00"
+
 type TimeParseResult struct {
 	Time        time.Time
 	isDateEmpty bool
 	isTimeEmpty bool
 	isSecsEmpty bool
+	// end is the (exclusive) end of the period that an expression such as
+	// "yesterday" or "vanavond" refers to
+	end time.Time
+}
+
+// TimeParser interprets times that are relative to the current moment, e.g.
+// a time without a date
+type TimeParser struct {
+	clock    clock.Clock
+	location *time.Location
+}
+
+// CreateTimeParser returns a parser for times in Amsterdam
+func CreateTimeParser(clock clock.Clock) TimeParser {
+	return TimeParser{clock: clock, location: loc}
+}
+
+// WithLocation returns a parser for times in another time zone
+func (p TimeParser) WithLocation(location *time.Location) TimeParser {
+	p.location = location
+	return p
+}
+
+var defaultParser = CreateTimeParser(clock.Real{})
+
+// LoadLocation accepts the name of a time zone, e.g. "Europe/London", "UTC"
+// or "Local"
+func LoadLocation(name string) (*time.Location, error) {
+	if strings.EqualFold(name, "local") {
+		return time.Local, nil
+	}
+	if strings.EqualFold(name, "utc") {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf(`unknown time zone "%s", use e.g. "Europe/Amsterdam", "UTC" or "Local"`, name)
+	}
+	return location, nil
+}
+
+// SetLocation changes the time zone in which ParseTimeFrom, ParseTimeUntil
+// and ParseTime interpret times, and in which FormatTime shows them
+func SetLocation(location *time.Location) {
+	userLoc = location
+	defaultParser = defaultParser.WithLocation(location)
+}
+
+// Location returns the time zone that was set with SetLocation, which is
+// Amsterdam unless the user chose another one
+func Location() *time.Location {
+	return userLoc
+}
+
+// FormatTime shows a time in the user's time zone, including its offset.
+// Every time that is shown to the user goes through it, so the format is not
+// exported.
+func FormatTime(moment time.Time) string {
+	return moment.In(userLoc).Format(displayFormat)
 }
 
 func ParseTimeFrom(input string) (time.Time, error) {
-	res, err := ParseTime(input)
+	return defaultParser.ParseTimeFrom(input)
+}
+
+func ParseTimeUntil(input string) (time.Time, error) {
+	return defaultParser.ParseTimeUntil(input)
+}
+
+func ParseTime(input string) (TimeParseResult, error) {
+	return defaultParser.ParseTime(input)
+}
+
+func (p TimeParser) ParseTimeFrom(input string) (time.Time, error) {
+	now := p.clock.Now
+	res, err := p.ParseTime(input)
 
 	if res.isDateEmpty {
 		timeString := res.Time.Format("15:04:05")
-		today := now().Format("2006-01-02")
+		today := now().In(p.location).Format("2006-01-02")
 
-		newRes, _ := time.ParseInLocation("2006-01-02 15:04:05", today+" "+timeString, loc)
+		newRes, _ := time.ParseInLocation("2006-01-02 15:04:05", today+" "+timeString, p.location)
 
 		if newRes.After(now()) {
-			yesterday := now().Add(-24 * time.Hour).Format("2006-01-02")
-			newRes, _ = time.ParseInLocation("2006-01-02 15:04:05", yesterday+" "+timeString, loc)
+			yesterday := now().In(p.location).AddDate(0, 0, -1).Format("2006-01-02")
+			newRes, _ = time.ParseInLocation("2006-01-02 15:04:05", yesterday+" "+timeString, p.location)
 		}
 
 		res.Time = newRes
@@ -40,18 +121,22 @@ func ParseTimeFrom(input string) (time.Time, error) {
 	return res.Time, err
 }
 
-func ParseTimeUntil(input string) (time.Time, error) {
-	res, err := ParseTime(input)
+func (p TimeParser) ParseTimeUntil(input string) (time.Time, error) {
+	now := p.clock.Now
+	res, err := p.ParseTime(input)
 
+	if !res.end.IsZero() {
+		return res.end.Add(-1 * time.Second), err
+	}
 	if res.isDateEmpty {
 		timeString := res.Time.Format("15:04:05")
-		today := now().Format("2006-01-02")
+		today := now().In(p.location).Format("2006-01-02")
 
-		newRes, _ := time.ParseInLocation("2006-01-02 15:04:05", today+" "+timeString, loc)
+		newRes, _ := time.ParseInLocation("2006-01-02 15:04:05", today+" "+timeString, p.location)
 
 		if newRes.Before(now()) {
-			tomorrow := now().Add(24 * time.Hour).Format("2006-01-02")
-			newRes, _ = time.ParseInLocation("2006-01-02 15:04:05", tomorrow+" "+timeString, loc)
+			tomorrow := now().In(p.location).AddDate(0, 0, 1).Format("2006-01-02")
+			newRes, _ = time.ParseInLocation("2006-01-02 15:04:05", tomorrow+" "+timeString, p.location)
 		}
 
 		res.Time = newRes
@@ -66,31 +151,34 @@ func ParseTimeUntil(input string) (time.Time, error) {
 	return res.Time, err
 }
 
-func ParseTime(input string) (TimeParseResult, error) {
+var dateFormats = []string{
+	"",
+	"2006-01-02",
+	"2006-1-02",
+	"02-01-2006",
+	"2-1-2006",
+	"02/01/2006",
+	"2/1/2006",
+}
+
+var timeFormats = []string{
+	"",
+	"15:04",
+	"15:04:05",
+	"3:04",
+	"3:04:05",
+}
+
+// ParseTime returns a *TimeError when the input can't be understood
+func (p TimeParser) ParseTime(input string) (TimeParseResult, error) {
 	if strings.TrimSpace(input) == "" {
 		return TimeParseResult{
-			Time:        time.Now(),
+			Time:        p.clock.Now(),
 			isDateEmpty: false,
 			isTimeEmpty: false,
 			isSecsEmpty: false,
 		}, nil
 	}
-	dateFormats := []string{
-		"",
-		"2006-01-02",
-		"2006-1-02",
-		"02-01-2006",
-		"2-1-2006",
-		"02/01/2006",
-		"2/1/2006",
-	}
-	timeFormats := []string{
-		"",
-		"15:04",
-		"15:04:05",
-		"3:04",
-		"3:04:05",
-	}
 	for _, dateFormat := range dateFormats {
 		for _, timeFormat := range timeFormats {
 			separator := func() string {
@@ -99,7 +187,7 @@ func ParseTime(input string) (TimeParseResult, error) {
 				}
 				return " "
 			}()
-			res, err := time.ParseInLocation(dateFormat+separator+timeFormat, input, loc)
+			res, err := time.ParseInLocation(dateFormat+separator+timeFormat, input, p.location)
 			if err == nil {
 				return TimeParseResult{
 					Time:        res,
@@ -111,5 +199,58 @@ func ParseTime(input string) (TimeParseResult, error) {
 		}
 	}
 
-	return TimeParseResult{}, errors.New(fmt.Sprintf("failed to parse Time '%v'", input))
+	if res, ok := p.parseExpression(input); ok {
+		return res, nil
+	}
+
+	return TimeParseResult{}, explainTimeError(input)
+}
+
+// ResolveLocalTime converts a wall clock time on a day in Amsterdam into an
+// instant. When clocks are set back, times between 02:00 and 03:00 occur
+// twice: the earliest instant that is not before 'after' is used, so that a
+// chronological list of times is resolved correctly. Times that are skipped
+// when clocks are set forward use the offset from before the transition, which
+// moves them forward by an hour.
+func ResolveLocalTime(date time.Time, hour int, minute int, after time.Time) time.Time {
+	year, month, day := date.Date()
+	candidates := localTimeCandidates(year, month, day, hour, minute)
+
+	if len(candidates) == 0 {
+		_, offset := time.Date(year, month, day, 0, 0, 0, 0, loc).Zone()
+		wallClock := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+		return wallClock.Add(-time.Duration(offset) * time.Second).In(loc)
+	}
+
+	for _, candidate := range candidates {
+		if !candidate.Before(after) {
+			return candidate
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// localTimeCandidates returns all instants at which the clock in Amsterdam
+// shows the given time, earliest first
+func localTimeCandidates(year int, month time.Month, day int, hour int, minute int) []time.Time {
+	wallClock := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	_, startOffset := time.Date(year, month, day, 0, 0, 0, 0, loc).Zone()
+	_, endOffset := time.Date(year, month, day, 23, 59, 0, 0, loc).Zone()
+
+	var candidates []time.Time
+	for _, offset := range []int{startOffset, endOffset} {
+		candidate := wallClock.Add(-time.Duration(offset) * time.Second).In(loc)
+		if candidate.Hour() != hour || candidate.Minute() != minute || candidate.Day() != day {
+			continue
+		}
+		if len(candidates) > 0 && candidates[0].Equal(candidate) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+	return candidates
 }
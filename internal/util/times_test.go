@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"npoleon/internal/clock"
 	"testing"
 	"time"
 )
@@ -52,10 +53,8 @@ var testDataParseTimeFrom = []struct {
 }
 
 func TestParseTimeFrom(t *testing.T) {
-	now = func() time.Time {
-		newNow, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-01-10 17:08:23", loc)
-		return newNow
-	}
+	newNow, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-01-10 17:08:23", loc)
+	parser := CreateTimeParser(clock.NewFake(newNow))
 
 	for _, data := range testDataParseTimeFrom {
 		t.Run(fmt.Sprintf("input=%s", data.input), func(t *testing.T) {
@@ -63,7 +62,7 @@ func TestParseTimeFrom(t *testing.T) {
 			expected, _ := time.ParseInLocation("2006-01-02 15:04:05", data.expected, loc)
 
 			// > Act
-			res, err := ParseTimeFrom(data.input)
+			res, err := parser.ParseTimeFrom(data.input)
 
 			// > Assert
 			if data.expected == "" && err == nil {
@@ -87,10 +86,8 @@ var testDataParseTimeUntil = []struct {
 }
 
 func TestParseTimeUntil(t *testing.T) {
-	now = func() time.Time {
-		newNow, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-01-10 17:08:23", loc)
-		return newNow
-	}
+	newNow, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-01-10 17:08:23", loc)
+	parser := CreateTimeParser(clock.NewFake(newNow))
 
 	for _, data := range testDataParseTimeUntil {
 		t.Run(fmt.Sprintf("input=%s", data.input), func(t *testing.T) {
@@ -98,7 +95,7 @@ func TestParseTimeUntil(t *testing.T) {
 			expected, _ := time.ParseInLocation("2006-01-02 15:04:05", data.expected, loc)
 
 			// > Act
-			res, err := ParseTimeUntil(data.input)
+			res, err := parser.ParseTimeUntil(data.input)
 
 			// > Assert
 			if data.expected == "" && err == nil {
@@ -110,3 +107,262 @@ func TestParseTimeUntil(t *testing.T) {
 		})
 	}
 }
+
+var testDataResolveLocalTime = []struct {
+	date     string
+	time     string
+	after    string
+	expected string
+}{
+	{"2024-03-31", "01:59", "", "2024-03-31T01:59:00+01:00"},
+	{"2024-03-31", "02:30", "", "2024-03-31T03:30:00+02:00"},
+	{"2024-03-31", "03:01", "", "2024-03-31T03:01:00+02:00"},
+	{"2024-10-27", "02:30", "", "2024-10-27T02:30:00+02:00"},
+	{"2024-10-27", "02:30", "2024-10-27T02:45:00+02:00", "2024-10-27T02:30:00+01:00"},
+	{"2024-10-27", "03:00", "2024-10-27T02:45:00+01:00", "2024-10-27T03:00:00+01:00"},
+}
+
+func TestResolveLocalTime(t *testing.T) {
+	for _, data := range testDataResolveLocalTime {
+		t.Run(fmt.Sprintf("date=%s time=%s after=%s", data.date, data.time, data.after), func(t *testing.T) {
+			// > Arrange
+			date, _ := time.ParseInLocation("2006-01-02", data.date, loc)
+			clock, _ := time.Parse("15:04", data.time)
+			after, _ := time.Parse(time.RFC3339, data.after)
+
+			// > Act
+			res := ResolveLocalTime(date, clock.Hour(), clock.Minute(), after)
+
+			// > Assert
+			if res.Format(time.RFC3339) != data.expected {
+				t.Errorf("Expected '%v', got '%v'", data.expected, res.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+var testDataParseExpression = []struct {
+	input string
+	from  string
+	until string
+}{
+	{"now", "2024-01-10 17:08:23", "2024-01-10 17:08:23"},
+	{"2h ago", "2024-01-10 15:08:23", "2024-01-10 15:08:23"},
+	{"90m ago", "2024-01-10 15:38:23", "2024-01-10 15:38:23"},
+	{"1h30m ago", "2024-01-10 15:38:23", "2024-01-10 15:38:23"},
+	{"3 days ago", "2024-01-07 17:08:23", "2024-01-07 17:08:23"},
+	{"1 uur en 15 minuten geleden", "2024-01-10 15:53:23", "2024-01-10 15:53:23"},
+	{"in 30 minutes", "2024-01-10 17:38:23", "2024-01-10 17:38:23"},
+	{"over 2 uur", "2024-01-10 19:08:23", "2024-01-10 19:08:23"},
+	{"yesterday", "2024-01-09 00:00:00", "2024-01-09 23:59:59"},
+	{"Gisteren", "2024-01-09 00:00:00", "2024-01-09 23:59:59"},
+	{"eergisteren", "2024-01-08 00:00:00", "2024-01-08 23:59:59"},
+	{"tomorrow", "2024-01-11 00:00:00", "2024-01-11 23:59:59"},
+	{"yesterday 18:00", "2024-01-09 18:00:00", "2024-01-09 18:00:59"},
+	{"gisteren 18:00:30", "2024-01-09 18:00:30", "2024-01-09 18:00:30"},
+	{"last friday 08:00", "2024-01-05 08:00:00", "2024-01-05 08:00:59"},
+	{"friday", "2024-01-05 00:00:00", "2024-01-05 23:59:59"},
+	{"wednesday", "2024-01-10 00:00:00", "2024-01-10 23:59:59"},
+	{"last wednesday", "2024-01-03 00:00:00", "2024-01-03 23:59:59"},
+	{"next monday", "2024-01-15 00:00:00", "2024-01-15 23:59:59"},
+	{"afgelopen zaterdag avond", "2024-01-06 18:00:00", "2024-01-06 23:59:59"},
+	{"vanochtend", "2024-01-10 06:00:00", "2024-01-10 11:59:59"},
+	{"this afternoon", "2024-01-10 12:00:00", "2024-01-10 17:59:59"},
+	{"gisteravond", "2024-01-09 18:00:00", "2024-01-09 23:59:59"},
+	{"vannacht", "2024-01-10 00:00:00", "2024-01-10 05:59:59"},
+	{"evening", "2024-01-10 18:00:00", "2024-01-10 23:59:59"},
+	{"yesterday 25:00", "", ""},
+	{"last", "", ""},
+	{"2 fortnights ago", "", ""},
+	{"ago", "", ""},
+}
+
+func TestParseExpression(t *testing.T) {
+	newNow, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-01-10 17:08:23", loc)
+	parser := CreateTimeParser(clock.NewFake(newNow))
+
+	for _, data := range testDataParseExpression {
+		t.Run(fmt.Sprintf("input=%s", data.input), func(t *testing.T) {
+			// > Arrange
+			expectedFrom, _ := time.ParseInLocation("2006-01-02 15:04:05", data.from, loc)
+			expectedUntil, _ := time.ParseInLocation("2006-01-02 15:04:05", data.until, loc)
+
+			// > Act
+			from, fromErr := parser.ParseTimeFrom(data.input)
+			until, untilErr := parser.ParseTimeUntil(data.input)
+
+			// > Assert
+			if data.from == "" {
+				if fromErr == nil || untilErr == nil {
+					t.Errorf("Parsing '%v' should have failed", data.input)
+				}
+				return
+			}
+			if fromErr != nil || untilErr != nil {
+				t.Fatalf("Expected no error, got '%v' and '%v'", fromErr, untilErr)
+			}
+			if !from.Equal(expectedFrom) {
+				t.Errorf("Expected from '%v', got '%v'", data.from, from)
+			}
+			if !until.Equal(expectedUntil) {
+				t.Errorf("Expected until '%v', got '%v'", data.until, until)
+			}
+		})
+	}
+}
+
+func TestParseExpression_DaylightSavingTime(t *testing.T) {
+	// > Arrange
+	newNow, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-03-31 12:00:00", loc)
+	parser := CreateTimeParser(clock.NewFake(newNow))
+
+	// > Act
+	from, _ := parser.ParseTimeFrom("vannacht")
+	until, _ := parser.ParseTimeUntil("vannacht")
+
+	// > Assert
+	if from.Format(time.RFC3339) != "2024-03-31T00:00:00+01:00" {
+		t.Errorf("Expected '2024-03-31T00:00:00+01:00', got '%v'", from.Format(time.RFC3339))
+	}
+	if until.Format(time.RFC3339) != "2024-03-31T05:59:59+02:00" {
+		t.Errorf("Expected '2024-03-31T05:59:59+02:00', got '%v'", until.Format(time.RFC3339))
+	}
+}
+
+var testDataParseDuration = []struct {
+	input    string
+	expected time.Duration
+}{
+	{"90m", 90 * time.Minute},
+	{"1h30m", 90 * time.Minute},
+	{"2 hours", 2 * time.Hour},
+	{"1,5 uur", 90 * time.Minute},
+	{"1 day", 24 * time.Hour},
+	{"0m", 0},
+	{"-1h", 0},
+	{"forever", 0},
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, data := range testDataParseDuration {
+		t.Run(fmt.Sprintf("input=%s", data.input), func(t *testing.T) {
+			// > Act
+			res, err := ParseDuration(data.input)
+
+			// > Assert
+			if data.expected == 0 && err == nil {
+				t.Errorf("Parsing '%v' should have failed", data.input)
+			}
+			if res != data.expected {
+				t.Errorf("Expected '%v', got '%v'", data.expected, res)
+			}
+		})
+	}
+}
+
+var testDataTimeError = []struct {
+	input   string
+	error   string
+	pointer string
+}{
+	{"yesterdy 18:00", "failed to parse time 'yesterdy 18:00': unknown word 'yesterdy'", "  yesterdy 18:00\n  ^^^^^^^^"},
+	{"yesterday 25:00", "failed to parse time 'yesterday 25:00': invalid time '25:00'", "  yesterday 25:00\n            ^^^^^"},
+	{"31/02/2024 10:00", "failed to parse time '31/02/2024 10:00': invalid date '31/02/2024'", "  31/02/2024 10:00\n  ^^^^^^^^^^"},
+	{"3 fortnights ago", "failed to parse time '3 fortnights ago': unknown word 'fortnights'", "  3 fortnights ago\n    ^^^^^^^^^^"},
+	{"3x ago", "failed to parse time '3x ago': unknown unit '3x'", "  3x ago\n  ^^"},
+	{"last", "failed to parse time 'last': not a date, time or expression that Npoleon understands", "  last\n  ^^^^"},
+}
+
+func TestParseTime_Error(t *testing.T) {
+	for _, data := range testDataTimeError {
+		t.Run(fmt.Sprintf("input=%s", data.input), func(t *testing.T) {
+			// > Act
+			_, err := ParseTime(data.input)
+
+			// > Assert
+			timeErr, ok := err.(*TimeError)
+			if !ok {
+				t.Fatalf("Expected a *TimeError, got '%v'", err)
+			}
+			if timeErr.Error() != data.error {
+				t.Errorf("Expected '%v', got '%v'", data.error, timeErr.Error())
+			}
+			if timeErr.Pointer() != data.pointer {
+				t.Errorf("Expected\n%v\ngot\n%v", data.pointer, timeErr.Pointer())
+			}
+		})
+	}
+}
+
+var testDataAmbiguityWarning = []struct {
+	input    string
+	expected string
+}{
+	{"02/03/2024", "'02/03/2024' is read as day/month/year, i.e. 2 March 2024. Write 2024-03-02 to avoid any doubt"},
+	{"2-3-2024 10:00", "'2-3-2024 10:00' is read as day/month/year, i.e. 2 March 2024. Write 2024-03-02 to avoid any doubt"},
+	{"14/03/2024", ""},
+	{"03/03/2024", ""},
+	{"2024-03-02", ""},
+	{"yesterday", ""},
+}
+
+func TestAmbiguityWarning(t *testing.T) {
+	for _, data := range testDataAmbiguityWarning {
+		t.Run(fmt.Sprintf("input=%s", data.input), func(t *testing.T) {
+			// > Act
+			res := AmbiguityWarning(data.input)
+
+			// > Assert
+			if res != data.expected {
+				t.Errorf("Expected '%v', got '%v'", data.expected, res)
+			}
+		})
+	}
+}
+
+func TestTimeParser_WithLocation(t *testing.T) {
+	london, _ := time.LoadLocation("Europe/London")
+	newNow, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-01-10 23:30:00", london)
+	parser := CreateTimeParser(clock.NewFake(newNow)).WithLocation(london)
+
+	t.Run("times are read in the given time zone", func(t *testing.T) {
+		// > Act
+		res, _ := parser.ParseTimeFrom("2024-01-10 18:00")
+
+		// > Assert
+		if res.Format(time.RFC3339) != "2024-01-10T18:00:00Z" {
+			t.Errorf("Expected '2024-01-10T18:00:00Z', got '%v'", res.Format(time.RFC3339))
+		}
+	})
+
+	t.Run("days follow the given time zone", func(t *testing.T) {
+		// > Act
+		// It is already the 11th in Amsterdam, but not yet in London
+		res, _ := parser.ParseTimeFrom("today")
+
+		// > Assert
+		if res.Format(time.RFC3339) != "2024-01-10T00:00:00Z" {
+			t.Errorf("Expected '2024-01-10T00:00:00Z', got '%v'", res.Format(time.RFC3339))
+		}
+	})
+}
+
+func TestFormatTime(t *testing.T) {
+	// > Arrange
+	moment := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	// > Act
+	amsterdam := FormatTime(moment)
+	SetLocation(tokyo)
+	defer SetLocation(loc)
+	res := FormatTime(moment)
+
+	// > Assert
+	if amsterdam != "2024-07-01 14:00:00 +02:00" {
+		t.Errorf("Expected '2024-07-01 14:00:00 +02:00', got '%v'", amsterdam)
+	}
+	if res != "2024-07-01 21:00:00 +09:00" {
+		t.Errorf("Expected '2024-07-01 21:00:00 +09:00', got '%v'", res)
+	}
+}
@@ -0,0 +1,164 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TimeError describes which part of a time could not be understood
+type TimeError struct {
+	Input  string
+	Part   string
+	Reason string
+	offset int
+}
+
+func (e *TimeError) Error() string {
+	if e.Part == e.Input {
+		return fmt.Sprintf("failed to parse time '%v': %v", e.Input, e.Reason)
+	}
+	return fmt.Sprintf("failed to parse time '%v': %v '%v'", e.Input, e.Reason, e.Part)
+}
+
+// Pointer shows the input with the offending part underlined, e.g.
+//
+//	yesterdy 18:00
+//	^^^^^^^^
+func (e *TimeError) Pointer() string {
+	return fmt.Sprintf(
+		"  %v\n  %v%v",
+		e.Input,
+		strings.Repeat(" ", e.offset),
+		strings.Repeat("^", max(1, utf8.RuneCountInString(e.Part))),
+	)
+}
+
+var dateLikeRegex = regexp.MustCompile(`^\d+[-/]\d+[-/]\d+$`)
+var timeLikeRegex = regexp.MustCompile(`^\d+[:.]\d+(?:[:.]\d+)?$`)
+var amountLikeRegex = regexp.MustCompile(`^\d+(?:[.,]\d+)?([a-z]*)$`)
+var wordRegex = regexp.MustCompile(`\S+`)
+
+var fillerWords = map[string]bool{
+	"now": true, "nu": true, "ago": true, "geleden": true, "in": true,
+	"over": true, "and": true, "en": true, "this": true,
+}
+
+// explainTimeError finds the first part of the input that makes it invalid
+func explainTimeError(input string) *TimeError {
+	for _, bounds := range wordRegex.FindAllStringIndex(input, -1) {
+		part := input[bounds[0]:bounds[1]]
+		if reason := checkTimePart(strings.ToLower(part)); reason != "" {
+			return &TimeError{
+				Input:  input,
+				Part:   part,
+				Reason: reason,
+				offset: utf8.RuneCountInString(input[:bounds[0]]),
+			}
+		}
+	}
+
+	return &TimeError{
+		Input:  input,
+		Part:   input,
+		Reason: "not a date, time or expression that Npoleon understands",
+	}
+}
+
+// checkTimePart returns why a single word can't be part of a time, if any
+func checkTimePart(part string) string {
+	if dateLikeRegex.MatchString(part) {
+		if _, err := parseDate(part); err != nil {
+			return "invalid date"
+		}
+		return ""
+	}
+
+	if timeLikeRegex.MatchString(part) {
+		numbers := strings.FieldsFunc(part, func(r rune) bool { return r == ':' || r == '.' })
+		for idx, limit := range []int{23, 59, 59}[:len(numbers)] {
+			if value, _ := strconv.Atoi(numbers[idx]); value > limit {
+				return "invalid time"
+			}
+		}
+		return ""
+	}
+
+	if matches := amountLikeRegex.FindStringSubmatch(part); matches != nil {
+		if _, ok := offsetUnits[matches[1]]; matches[1] != "" && !ok {
+			return "unknown unit"
+		}
+		return ""
+	}
+	if _, err := time.ParseDuration(part); err == nil {
+		return ""
+	}
+
+	if !isKnownWord(part) {
+		return "unknown word"
+	}
+	return ""
+}
+
+func isKnownWord(word string) bool {
+	if _, ok := offsetUnits[word]; ok {
+		return true
+	}
+	if _, ok := relativeDays[word]; ok {
+		return true
+	}
+	if _, ok := weekdays[word]; ok {
+		return true
+	}
+	if _, ok := dayParts[word]; ok {
+		return true
+	}
+	if _, ok := compounds[word]; ok {
+		return true
+	}
+	return lastWords[word] || nextWords[word] || fillerWords[word]
+}
+
+func parseDate(input string) (time.Time, error) {
+	var err error
+	for _, format := range dateFormats[1:] {
+		var res time.Time
+		if res, err = time.ParseInLocation(format, input, loc); err == nil {
+			return res, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+var ambiguousDateRegex = regexp.MustCompile(`^(\d{1,2})[-/](\d{1,2})[-/]\d{4}\b`)
+
+// AmbiguityWarning explains how a date that could be read either as
+// day/month or as month/day is interpreted. It returns an empty string for
+// dates that are unambiguous.
+func AmbiguityWarning(input string) string {
+	input = strings.TrimSpace(input)
+	matches := ambiguousDateRegex.FindStringSubmatch(input)
+	if matches == nil {
+		return ""
+	}
+
+	day, _ := strconv.Atoi(matches[1])
+	month, _ := strconv.Atoi(matches[2])
+	if day > 12 || month > 12 || day == month {
+		return ""
+	}
+
+	date, err := parseDate(matches[0])
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(
+		"'%v' is read as day/month/year, i.e. %v. Write %v to avoid any doubt",
+		input,
+		date.Format("2 January 2006"),
+		date.Format("2006-01-02"),
+	)
+}